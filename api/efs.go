@@ -0,0 +1,6 @@
+package api
+
+import "embed"
+
+//go:embed "openapi.json"
+var Files embed.FS
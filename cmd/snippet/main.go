@@ -0,0 +1,329 @@
+// The snippet command is a command-line client for Snippetbox. It talks to
+// the JSON API, authenticating with a personal access token from its
+// configuration file.
+//
+// Usage:
+//
+//	snippet [-config path] post [file] [--title title] [--expires 7d]
+//	snippet [-config path] get <id> [--file name]
+//	snippet [-config path] ls [--page n]
+//	snippet [-config path] rm <id>
+//
+// If no file is given to post, or the file is "-", the snippet is read from
+// standard input.
+//
+// The get command prints a snippet's content followed by each of its files,
+// with a header line like "==> main.go <==" before each file. With --file it
+// prints just the named file, exactly as it was stored.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"snippetbox.example.com/internal/client"
+)
+
+// The errUsage error is returned when the command line is invalid, so that
+// main() can exit with status 2 like the flag package does.
+var errUsage = errors.New("usage: snippet [-config path] post|get|ls|rm ...")
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "snippet:", err)
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	defaultConfig, err := client.DefaultConfigPath()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("snippet", flag.ContinueOnError)
+	configPath := fs.String("config", defaultConfig, "path to the configuration file")
+
+	err = fs.Parse(args)
+	if err != nil {
+		return errUsage
+	}
+	if fs.NArg() == 0 {
+		return errUsage
+	}
+
+	cfg, err := client.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", *configPath, err)
+	}
+
+	c, err := client.New(cfg.URL, cfg.Token, cfg.CACert)
+	if err != nil {
+		return err
+	}
+
+	command, args := fs.Arg(0), fs.Args()[1:]
+
+	switch command {
+	case "post":
+		return post(c, args, stdin, stdout)
+	case "get":
+		return get(c, args, stdout)
+	case "ls":
+		return list(c, args, stdout)
+	case "rm":
+		return remove(c, args, stdout)
+	default:
+		return fmt.Errorf("unknown command %q: %w", command, errUsage)
+	}
+}
+
+// The parseInterspersed() helper parses flags which may come before, after or
+// in between positional arguments, so that both "post --expires 7d main.go"
+// and "post main.go --expires 7d" work. The positional arguments are returned.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, errUsage
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// The parseExpires() helper converts an expiry like "7d", "1w" or "1y" into
+// the number of days the server expects, which must be 1, 7 or 365.
+func parseExpires(s string) (int, error) {
+	unit := 1
+	number := s
+
+	switch {
+	case strings.HasSuffix(s, "d"):
+		number = strings.TrimSuffix(s, "d")
+	case strings.HasSuffix(s, "w"):
+		unit, number = 7, strings.TrimSuffix(s, "w")
+	case strings.HasSuffix(s, "y"):
+		unit, number = 365, strings.TrimSuffix(s, "y")
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid expiry %q", s)
+	}
+
+	days := n * unit
+	if days != 1 && days != 7 && days != 365 {
+		return 0, fmt.Errorf("invalid expiry %q: must be 1d, 7d or 365d", s)
+	}
+
+	return days, nil
+}
+
+func post(c *client.Client, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("post", flag.ContinueOnError)
+	title := fs.String("title", "", "snippet title (defaults to the file name)")
+	expires := fs.String("expires", "7d", "time until the snippet expires: 1d, 7d or 365d")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return errUsage
+	}
+
+	days, err := parseExpires(*expires)
+	if err != nil {
+		return err
+	}
+
+	r := stdin
+	name := "stdin"
+
+	if len(positional) == 1 && positional[0] != "-" {
+		f, err := os.Open(positional[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+		name = filepath.Base(positional[0])
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if *title == "" {
+		*title = name
+	}
+
+	s, err := c.Create(*title, string(content), days)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, c.SnippetURL(s.ID))
+	return nil
+}
+
+// The parseID() helper reads the single snippet ID argument taken by the get
+// and rm commands.
+func parseID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errUsage
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid snippet ID %q", args[0])
+	}
+
+	return id, nil
+}
+
+func get(c *client.Client, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	file := fs.String("file", "", "print only the file with this name")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	id, err := parseID(positional)
+	if err != nil {
+		return err
+	}
+
+	s, err := c.Get(id)
+	if err != nil {
+		return err
+	}
+
+	return printSnippet(stdout, s, *file)
+}
+
+// The printSnippet() helper writes a snippet's content and files. If file
+// isn't empty, only that file is written, exactly as it was stored, so that
+// the output can be redirected straight back into a file. The same goes for
+// the content of a snippet which doesn't have any files.
+func printSnippet(w io.Writer, s client.Snippet, file string) error {
+	if file != "" {
+		var names []string
+		for _, f := range s.Files {
+			if f.Name == file {
+				_, err := io.WriteString(w, f.Content)
+				return err
+			}
+			names = append(names, f.Name)
+		}
+
+		if len(names) == 0 {
+			return fmt.Errorf("snippet %d has no files", s.ID)
+		}
+		return fmt.Errorf("snippet %d has no file %q; its files are %s", s.ID, file, strings.Join(names, ", "))
+	}
+
+	_, err := io.WriteString(w, s.Content)
+	if err != nil {
+		return err
+	}
+
+	// Separate each file from whatever came before it with a blank line,
+	// making sure that the header doesn't run on from the last line.
+	prev := s.Content
+
+	for _, f := range s.Files {
+		if prev != "" {
+			separator := "\n"
+			if !strings.HasSuffix(prev, "\n") {
+				separator = "\n\n"
+			}
+
+			_, err = io.WriteString(w, separator)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = fmt.Fprintf(w, "==> %s <==\n%s", f.Name, f.Content)
+		if err != nil {
+			return err
+		}
+		prev = f.Content
+	}
+
+	return nil
+}
+
+func list(c *client.Client, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	page := fs.Int("page", 1, "page number")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return errUsage
+	}
+
+	snippets, total, err := c.List(*page, 20)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tEXPIRES")
+	for _, s := range snippets {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", s.ID, s.Title, s.Expires.Local().Format("2006-01-02 15:04"))
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	if shown := (*page-1)*20 + len(snippets); shown < total {
+		fmt.Fprintf(stdout, "\n%d more; use --page %d to see them\n", total-shown, *page+1)
+	}
+
+	return nil
+}
+
+func remove(c *client.Client, args []string, stdout io.Writer) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	err = c.Delete(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "deleted snippet %d\n", id)
+	return nil
+}
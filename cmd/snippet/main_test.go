@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/internal/client"
+)
+
+func TestParseExpires(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantDays int
+		wantErr  bool
+	}{
+		{input: "1d", wantDays: 1},
+		{input: "7d", wantDays: 7},
+		{input: "1w", wantDays: 7},
+		{input: "365d", wantDays: 365},
+		{input: "1y", wantDays: 365},
+		{input: "7", wantDays: 7},
+		{input: "2d", wantErr: true},
+		{input: "0d", wantErr: true},
+		{input: "-7d", wantErr: true},
+		{input: "week", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			days, err := parseExpires(tt.input)
+
+			assert.Equal(t, err != nil, tt.wantErr)
+			assert.Equal(t, days, tt.wantDays)
+		})
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("post", flag.ContinueOnError)
+	expires := fs.String("expires", "7d", "")
+	title := fs.String("title", "", "")
+
+	positional, err := parseInterspersed(fs, []string{"--title", "Hello", "main.go", "--expires", "1d"})
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(positional), 1)
+	assert.Equal(t, positional[0], "main.go")
+	assert.Equal(t, *expires, "1d")
+	assert.Equal(t, *title, "Hello")
+}
+
+func TestPrintSnippet(t *testing.T) {
+	files := []client.File{
+		{Name: "main.go", Language: "go", Content: "package main\n"},
+		{Name: "go.mod", Content: "module repro"},
+	}
+
+	tests := []struct {
+		name    string
+		snippet client.Snippet
+		file    string
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "Content only",
+			snippet: client.Snippet{ID: 1, Content: "An old silent pond..."},
+			want:    "An old silent pond...",
+		},
+		{
+			name:    "Files only",
+			snippet: client.Snippet{ID: 5, Files: files},
+			want:    "==> main.go <==\npackage main\n\n==> go.mod <==\nmodule repro",
+		},
+		{
+			name:    "Content and files",
+			snippet: client.Snippet{ID: 5, Content: "Run it", Files: files},
+			want:    "Run it\n\n==> main.go <==\npackage main\n\n==> go.mod <==\nmodule repro",
+		},
+		{
+			name:    "One file",
+			snippet: client.Snippet{ID: 5, Content: "Run it", Files: files},
+			file:    "go.mod",
+			want:    "module repro",
+		},
+		{
+			name:    "Missing file",
+			snippet: client.Snippet{ID: 5, Files: files},
+			file:    "go.sum",
+			wantErr: `snippet 5 has no file "go.sum"; its files are main.go, go.mod`,
+		},
+		{
+			name:    "No files",
+			snippet: client.Snippet{ID: 1, Content: "An old silent pond..."},
+			file:    "go.mod",
+			wantErr: "snippet 1 has no files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+
+			err := printSnippet(&out, tt.snippet, tt.file)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatal("got nil error")
+				}
+				assert.Equal(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, out.String(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.example.com/api"
+	"snippetbox.example.com/internal/models"
+	"snippetbox.example.com/internal/validator"
+)
+
+// The envelope type wraps JSON responses in a top-level object, like
+// {"snippet": {...}}, which leaves room to add fields later without breaking
+// clients.
+type envelope map[string]any
+
+// The snippetResponse struct defines how a snippet is represented in the API.
+// We use a separate type rather than adding struct tags to models.Snippet so
+// that the shape of the API can't change by accident.
+//
+// A snippet's files and tags are left out of lists of snippets, because they
+// aren't loaded for those, so the Files and Tags fields are left out when
+// they're empty.
+type snippetResponse struct {
+	ID         int                   `json:"id"`
+	Title      string                `json:"title"`
+	Content    string                `json:"content"`
+	Format     string                `json:"format"`
+	Files      []snippetFileResponse `json:"files,omitempty"`
+	Tags       []string              `json:"tags,omitempty"`
+	ForkedFrom int                   `json:"forked_from,omitempty"`
+	Created    time.Time             `json:"created"`
+	Expires    time.Time             `json:"expires"`
+	OwnerID    int                   `json:"owner_id"`
+}
+
+type snippetFileResponse struct {
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+func newSnippetResponse(s models.Snippet) snippetResponse {
+	rs := snippetResponse{
+		ID:         s.ID,
+		Title:      s.Title,
+		Content:    s.Content,
+		Format:     s.Format,
+		Tags:       s.Tags,
+		ForkedFrom: s.ForkedFrom,
+		Created:    s.Created,
+		Expires:    s.Expires,
+		OwnerID:    s.UserID,
+	}
+
+	for _, f := range s.Files {
+		rs.Files = append(rs.Files, snippetFileResponse{Name: f.Name, Language: f.Language, Content: f.Content})
+	}
+
+	return rs
+}
+
+// The writeJSON() helper sends a JSON response with the given status code.
+func (app *application) writeJSON(w http.ResponseWriter, status int, data any) error {
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+
+	return nil
+}
+
+// The readJSON() helper decodes a JSON request body into dst. It limits the
+// size of the body, rejects unknown fields and trailing data, and returns
+// errors with messages which are safe to send back to the client.
+func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		default:
+			return err
+		}
+	}
+
+	err = dec.Decode(&struct{}{})
+	if !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// The errorJSON() helper sends a JSON error response in the form
+// {"error": "message"}. Server errors also include the request ID, like
+// {"error": "message", "request_id": "..."}, so that they can be reported.
+func (app *application) errorJSON(w http.ResponseWriter, r *http.Request, status int, message string) {
+	data := envelope{"error": message}
+	if status >= http.StatusInternalServerError {
+		if requestID := requestIDFromContext(r); requestID != "" {
+			data["request_id"] = requestID
+		}
+	}
+
+	err := app.writeJSON(w, status, data)
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// The serverErrorJSON() helper is the API equivalent of serverError().
+func (app *application) serverErrorJSON(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.ErrorContext(r.Context(), err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	app.errorJSON(w, r, http.StatusInternalServerError, "the server encountered a problem and could not process your request")
+}
+
+// The validationErrorJSON() helper sends a 422 response with the field errors
+// collected by a validator.Validator, like:
+//
+//	{"error": "...", "fields": {"title": "This field cannot be blank"}}
+//
+// The field errors are translated according to the Accept-Language header.
+func (app *application) validationErrorJSON(w http.ResponseWriter, r *http.Request, v validator.Validator) {
+	catalog := app.i18n.Catalog(app.locale(r))
+
+	fields := map[string]string{}
+	for field, e := range v.FieldErrors {
+		fields[field] = catalog.T(e.Key, e.Args...)
+	}
+
+	err := app.writeJSON(w, http.StatusUnprocessableEntity, envelope{
+		"error":  "the request contained invalid fields",
+		"fields": fields,
+	})
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+	}
+}
+
+// Returns true if the request is for one of the JSON API endpoints.
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// The readSnippetForAPI() helper fetches the snippet whose ID is in the URL,
+// sending a JSON error response and returning ok=false if it can't.
+func (app *application) readSnippetForAPI(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.errorJSON(w, r, http.StatusNotFound, "the requested resource could not be found")
+		return models.Snippet{}, false
+	}
+
+	snippet, err = app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorJSON(w, r, http.StatusNotFound, "the requested resource could not be found")
+		} else {
+			app.serverErrorJSON(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// The requireAPIAuthentication middleware is the API equivalent of
+// requireAuthentication: instead of redirecting to the login page, it sends
+// a 401 response.
+func (app *application) requireAPIAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAuthenticated(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.errorJSON(w, r, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The apiSpec handler serves the OpenAPI specification for the API, which is
+// embedded in the binary in the same way as our HTML templates and static
+// files.
+func apiSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFileFS(w, r, api.Files, "openapi.json")
+}
+
+func (app *application) apiSnippetList(w http.ResponseWriter, r *http.Request) {
+	// Read the page and page_size query string parameters, using sensible
+	// defaults if they aren't provided.
+	var v validator.Validator
+
+	page, pageSize := 1, 20
+	query := r.URL.Query()
+
+	if s := query.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		v.CheckField(err == nil && n >= 1 && n <= 10_000, "page", "validation.between", 1, 10_000)
+		page = n
+	}
+	if s := query.Get("page_size"); s != "" {
+		n, err := strconv.Atoi(s)
+		v.CheckField(err == nil && n >= 1 && n <= 100, "page_size", "validation.between", 1, 100)
+		pageSize = n
+	}
+
+	if !v.Valid() {
+		app.validationErrorJSON(w, r, v)
+		return
+	}
+
+	snippets, total, err := app.snippets.Page(r.Context(), page, pageSize)
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+		return
+	}
+
+	// Always return an array, even if it's empty, rather than null.
+	data := make([]snippetResponse, 0, len(snippets))
+	for _, s := range snippets {
+		data = append(data, newSnippetResponse(s))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"snippets": data,
+		"metadata": envelope{
+			"page":      page,
+			"page_size": pageSize,
+			"total":     total,
+		},
+	})
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+	}
+}
+
+func (app *application) apiSnippetGet(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippetForAPI(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"snippet": newSnippetResponse(snippet)})
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+	}
+}
+
+func (app *application) apiSnippetCreate(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+
+	err := app.readJSON(w, r, &form)
+	if err != nil {
+		app.errorJSON(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form.validate()
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form.Validator)
+		return
+	}
+
+	id, err := app.snippets.Insert(r.Context(), app.authenticatedUserID(r), form.Title, form.Content, form.Format, form.snippetFiles(), form.Tags, form.Expires)
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+		return
+	}
+
+	// Send back the new snippet as it was saved, in the same way as
+	// apiSnippetUpdate, so that the response has the values which the
+	// database filled in (like the format, file languages and timestamps).
+	snippet, err := app.snippets.Get(r.Context(), id)
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"snippet": newSnippetResponse(snippet)})
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+	}
+}
+
+// The snippetUpdateInput struct holds the fields which can be changed with a
+// PATCH request. We use pointers so that we can tell the difference between
+// a field which wasn't provided and one which was set to its zero value.
+type snippetUpdateInput struct {
+	Title   *string            `json:"title"`
+	Content *string            `json:"content"`
+	Format  *string            `json:"format"`
+	Files   *[]snippetFileForm `json:"files"`
+	Tags    *[]string          `json:"tags"`
+	Expires *int               `json:"expires"`
+}
+
+func (app *application) apiSnippetUpdate(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippetForAPI(w, r)
+	if !ok {
+		return
+	}
+
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.errorJSON(w, r, http.StatusForbidden, "you can only change your own snippets")
+		return
+	}
+
+	var input snippetUpdateInput
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.errorJSON(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Start with the current values and overlay the fields which were
+	// provided, then validate the result in the same way as a new snippet.
+	form := snippetCreateForm{
+		Title:   snippet.Title,
+		Content: snippet.Content,
+		Format:  snippet.Format,
+		Tags:    snippet.Tags,
+	}
+	for _, f := range snippet.Files {
+		form.Files = append(form.Files, snippetFileForm{Name: f.Name, Language: f.Language, Content: f.Content})
+	}
+	if input.Title != nil {
+		form.Title = *input.Title
+	}
+	if input.Content != nil {
+		form.Content = *input.Content
+	}
+	if input.Format != nil {
+		form.Format = *input.Format
+	}
+	if input.Files != nil {
+		form.Files = *input.Files
+	}
+	if input.Tags != nil {
+		form.Tags = *input.Tags
+	}
+
+	form.validateContent()
+	if input.Expires != nil {
+		form.Expires = *input.Expires
+		form.validateExpires()
+	}
+
+	if !form.Valid() {
+		app.validationErrorJSON(w, r, form.Validator)
+		return
+	}
+
+	err = app.snippets.Update(r.Context(), snippet.ID, form.Title, form.Content, form.Format, form.snippetFiles(), form.Tags, form.Expires)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorJSON(w, r, http.StatusNotFound, "the requested resource could not be found")
+		} else {
+			app.serverErrorJSON(w, r, err)
+		}
+		return
+	}
+
+	snippet, err = app.snippets.Get(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"snippet": newSnippetResponse(snippet)})
+	if err != nil {
+		app.serverErrorJSON(w, r, err)
+	}
+}
+
+func (app *application) apiSnippetDelete(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippetForAPI(w, r)
+	if !ok {
+		return
+	}
+
+	if snippet.UserID != app.authenticatedUserID(r) {
+		app.errorJSON(w, r, http.StatusForbidden, "you can only delete your own snippets")
+		return
+	}
+
+	err := app.snippets.Delete(r.Context(), snippet.ID, nil)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.errorJSON(w, r, http.StatusNotFound, "the requested resource could not be found")
+		} else {
+			app.serverErrorJSON(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+// The apiRequest() helper sends a request to the API, authenticated with the
+// given personal access token (if any), and decodes the JSON response body
+// into a map.
+func (ts *testServer) apiRequest(t *testing.T, method, urlPath, token, body string) (int, http.Header, map[string]any) {
+	t.Helper()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	code, rsHeader, rsBody := ts.do(t, method, urlPath, header, strings.NewReader(body))
+
+	var data map[string]any
+	if rsBody != "" {
+		err := json.Unmarshal([]byte(rsBody), &data)
+		if err != nil {
+			t.Fatalf("invalid JSON response %q: %v", rsBody, err)
+		}
+	}
+
+	return code, rsHeader, data
+}
+
+func TestAPISnippetList(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name      string
+		urlPath   string
+		wantCode  int
+		wantCount int
+		wantError string
+	}{
+		{
+			name:      "Default page",
+			urlPath:   "/api/v1/snippets",
+			wantCode:  http.StatusOK,
+			wantCount: 1,
+		},
+		{
+			name:      "Empty page",
+			urlPath:   "/api/v1/snippets?page=2&page_size=10",
+			wantCode:  http.StatusOK,
+			wantCount: 0,
+		},
+		{
+			name:      "Invalid page",
+			urlPath:   "/api/v1/snippets?page=0",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "page",
+		},
+		{
+			name:      "Invalid page size",
+			urlPath:   "/api/v1/snippets?page_size=foo",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "page_size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, data := ts.apiRequest(t, http.MethodGet, tt.urlPath, "", "")
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Content-Type"), "application/json")
+
+			if tt.wantError != "" {
+				fields, _ := data["fields"].(map[string]any)
+				_, ok := fields[tt.wantError]
+				assert.Equal(t, ok, true)
+				return
+			}
+
+			snippets, ok := data["snippets"].([]any)
+			assert.Equal(t, ok, true)
+			assert.Equal(t, len(snippets), tt.wantCount)
+		})
+	}
+}
+
+func TestAPISnippetGet(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, data := ts.apiRequest(t, http.MethodGet, "/api/v1/snippets/1", "", "")
+	assert.Equal(t, code, http.StatusOK)
+
+	snippet, _ := data["snippet"].(map[string]any)
+	assert.Equal(t, snippet["id"], any(float64(1)))
+	assert.Equal(t, snippet["content"], any("An old silent pond..."))
+	assert.Equal(t, snippet["format"], any("plain"))
+
+	_, ok := snippet["forked_from"]
+	assert.Equal(t, ok, false)
+
+	code, _, data = ts.apiRequest(t, http.MethodGet, "/api/v1/snippets/6", "", "")
+	assert.Equal(t, code, http.StatusOK)
+
+	snippet, _ = data["snippet"].(map[string]any)
+	assert.Equal(t, snippet["forked_from"], any(float64(1)))
+
+	for _, urlPath := range []string{"/api/v1/snippets/2", "/api/v1/snippets/-1", "/api/v1/snippets/foo"} {
+		code, _, data := ts.apiRequest(t, http.MethodGet, urlPath, "", "")
+		assert.Equal(t, code, http.StatusNotFound)
+		assert.Equal(t, data["error"], any("the requested resource could not be found"))
+	}
+}
+
+func TestAPISnippetCreate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		token        string
+		body         string
+		wantCode     int
+		wantLocation string
+		wantTitle    string
+		wantTags     string
+		wantFields   []string
+	}{
+		{
+			name:         "Valid snippet",
+			token:        "sbx_WRITETOKEN",
+			body:         `{"title": "Deploy log", "content": "All good", "expires": 7}`,
+			wantCode:     http.StatusCreated,
+			wantLocation: "/api/v1/snippets/2",
+			wantTitle:    "Deploy log",
+		},
+		{
+			name:       "Invalid fields",
+			token:      "sbx_WRITETOKEN",
+			body:       `{"title": "", "content": "", "expires": 3}`,
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"title", "content", "expires"},
+		},
+		{
+			name:         "Markdown",
+			token:        "sbx_WRITETOKEN",
+			body:         `{"title": "Runbook", "content": "# Restart", "format": "markdown", "expires": 7}`,
+			wantCode:     http.StatusCreated,
+			wantLocation: "/api/v1/snippets/2",
+			wantTitle:    "Runbook",
+		},
+		{
+			name:       "Invalid format",
+			token:      "sbx_WRITETOKEN",
+			body:       `{"title": "Runbook", "content": "# Restart", "format": "html", "expires": 7}`,
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"format"},
+		},
+		{
+			name:         "Files",
+			token:        "sbx_WRITETOKEN",
+			body:         `{"title": "Repro", "files": [{"name": "main.go", "content": "package main"}, {"name": "go.mod", "language": "go", "content": "module repro"}], "expires": 7}`,
+			wantCode:     http.StatusCreated,
+			wantLocation: "/api/v1/snippets/2",
+			wantTitle:    "Repro",
+		},
+		{
+			name:         "Tags",
+			token:        "sbx_WRITETOKEN",
+			body:         `{"title": "Deploy log", "content": "All good", "tags": ["Ops", "deploy, ops"], "expires": 7}`,
+			wantCode:     http.StatusCreated,
+			wantLocation: "/api/v1/snippets/2",
+			wantTitle:    "Deploy log",
+			wantTags:     "deploy ops",
+		},
+		{
+			name:       "Invalid tags",
+			token:      "sbx_WRITETOKEN",
+			body:       `{"title": "Deploy log", "content": "All good", "tags": ["c++"], "expires": 7}`,
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"tags"},
+		},
+		{
+			name:       "Invalid files",
+			token:      "sbx_WRITETOKEN",
+			body:       `{"title": "Repro", "files": [{"name": "cmd/main.go", "content": "package main"}, {"name": "go.mod", "language": "nosuchlanguage", "content": ""}], "expires": 7}`,
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"files.0.name", "files.1.language", "files.1.content"},
+		},
+		{
+			name:       "Long title",
+			token:      "sbx_WRITETOKEN",
+			body:       `{"title": "` + strings.Repeat("a", 101) + `", "content": "All good", "expires": 1}`,
+			wantCode:   http.StatusUnprocessableEntity,
+			wantFields: []string{"title"},
+		},
+		{
+			name:     "Badly-formed JSON",
+			token:    "sbx_WRITETOKEN",
+			body:     `{"title": "Deploy log",`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Unknown field",
+			token:    "sbx_WRITETOKEN",
+			body:     `{"title": "Deploy log", "content": "All good", "expires": 7, "owner_id": 3}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Wrong type",
+			token:    "sbx_WRITETOKEN",
+			body:     `{"title": "Deploy log", "content": "All good", "expires": "7"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "No token",
+			body:     `{"title": "Deploy log", "content": "All good", "expires": 7}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Read token",
+			token:    "sbx_READTOKEN",
+			body:     `{"title": "Deploy log", "content": "All good", "expires": 7}`,
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, data := ts.apiRequest(t, http.MethodPost, "/api/v1/snippets", tt.token, tt.body)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+
+			// The new snippet is read back from the model and sent in the
+			// response.
+			if tt.wantTitle != "" {
+				snippet, _ := data["snippet"].(map[string]any)
+				assert.Equal(t, snippet["id"], any(float64(2)))
+				assert.Equal(t, snippet["title"], any(tt.wantTitle))
+
+				var tags []string
+				list, _ := snippet["tags"].([]any)
+				for _, tag := range list {
+					tags = append(tags, tag.(string))
+				}
+				assert.Equal(t, strings.Join(tags, " "), tt.wantTags)
+			}
+
+			if tt.wantFields != nil {
+				fields, _ := data["fields"].(map[string]any)
+				assert.Equal(t, len(fields), len(tt.wantFields))
+				for _, field := range tt.wantFields {
+					_, ok := fields[field]
+					assert.Equal(t, ok, true)
+				}
+			}
+		})
+	}
+}
+
+func TestAPISnippetUpdate(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "Owner",
+			urlPath:  "/api/v1/snippets/1",
+			token:    "sbx_WRITETOKEN",
+			body:     `{"title": "A new title"}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Change expiry",
+			urlPath:  "/api/v1/snippets/1",
+			token:    "sbx_WRITETOKEN",
+			body:     `{"expires": 365}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Invalid expiry",
+			urlPath:  "/api/v1/snippets/1",
+			token:    "sbx_WRITETOKEN",
+			body:     `{"expires": 2}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Blank content",
+			urlPath:  "/api/v1/snippets/1",
+			token:    "sbx_WRITETOKEN",
+			body:     `{"content": "  "}`,
+			wantCode: http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "Not the owner",
+			urlPath:  "/api/v1/snippets/1",
+			token:    "sbx_CAROLTOKEN",
+			body:     `{"title": "A new title"}`,
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/api/v1/snippets/2",
+			token:    "sbx_WRITETOKEN",
+			body:     `{"title": "A new title"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "No token",
+			urlPath:  "/api/v1/snippets/1",
+			body:     `{"title": "A new title"}`,
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.apiRequest(t, http.MethodPatch, tt.urlPath, tt.token, tt.body)
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
+
+func TestAPISnippetDelete(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		token    string
+		wantCode int
+	}{
+		{
+			name:     "Owner",
+			urlPath:  "/api/v1/snippets/1",
+			token:    "sbx_WRITETOKEN",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "Not the owner",
+			urlPath:  "/api/v1/snippets/1",
+			token:    "sbx_CAROLTOKEN",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/api/v1/snippets/2",
+			token:    "sbx_WRITETOKEN",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "No token",
+			urlPath:  "/api/v1/snippets/1",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, _ := ts.apiRequest(t, http.MethodDelete, tt.urlPath, tt.token, "")
+			assert.Equal(t, code, tt.wantCode)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"snippetbox.example.com/ui"
+)
+
+// The assetManifest type maps each static file to a fingerprinted name which
+// includes a hash of its contents, like "static/css/main.3b1f0c9a2d4e5f60.css".
+// A fingerprinted URL always refers to exactly the same content, so browsers
+// can cache it forever; when the file changes, so does its URL.
+type assetManifest struct {
+	hashed   map[string]string // "static/css/main.css" -> "static/css/main.<hash>.css"
+	original map[string]string // "static/css/main.<hash>.css" -> "static/css/main.css"
+}
+
+// The newAssetManifest() function hashes every file under the static
+// directory of fsys. The precompressed ".gz" copies aren't listed
+// separately, since they're just another encoding of the same file.
+func newAssetManifest(fsys fs.FS) (*assetManifest, error) {
+	m := &assetManifest{
+		hashed:   map[string]string{},
+		original: map[string]string{},
+	}
+
+	err := fs.WalkDir(fsys, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(name, ".gz") {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:8])
+
+		ext := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, ext) + "." + hash + ext
+
+		m.hashed[name] = hashedName
+		m.original[hashedName] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// The url() method returns the fingerprinted URL for a static file, given its
+// path relative to the static directory, like "css/main.css". It's used by
+// the asset template function, and returns an error for a file which
+// doesn't exist so that a typo in a template is noticed straight away.
+func (m *assetManifest) url(name string) (string, error) {
+	hashedName, ok := m.hashed[path.Join("static", name)]
+	if !ok {
+		return "", fmt.Errorf("unknown static asset %q", name)
+	}
+	return "/" + hashedName, nil
+}
+
+// The resolve() method returns the real name of a file given its
+// fingerprinted name, and whether name was fingerprinted at all.
+func (m *assetManifest) resolve(name string) (string, bool) {
+	original, ok := m.original[name]
+	return original, ok
+}
+
+// The staticAssets manifest is built once when the application starts. The
+// files are embedded in the binary, so they can't change while it's running.
+var staticAssets = mustNewAssetManifest(ui.Files)
+
+func mustNewAssetManifest(fsys fs.FS) *assetManifest {
+	m, err := newAssetManifest(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// The staticFiles() function returns a handler like http.FileServerFS(fsys),
+// with two additions:
+//
+//   - Fingerprinted URLs from the assets manifest are served with a
+//     Cache-Control header which lets browsers cache them for a year without
+//     checking back. The plain URLs still work, but without that header.
+//   - If a client accepts gzip and there's a precompressed ".gz" copy of the
+//     requested file, that's served instead. The ".gz" files are generated by
+//     "go generate ./ui", so they cost nothing to serve.
+func staticFiles(fsys fs.FS, assets *assetManifest) http.Handler {
+	fileServer := http.FileServerFS(fsys)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+
+		// By default the file server takes care of everything, including
+		// directory listings and 404s.
+		serve := func() { fileServer.ServeHTTP(w, r) }
+
+		if original, ok := assets.resolve(name); ok {
+			name = original
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			serve = func() { http.ServeFileFS(w, r, fsys, name) }
+		}
+
+		gzName := name + ".gz"
+		if _, err := fs.Stat(fsys, gzName); err != nil {
+			serve()
+			return
+		}
+
+		addVary(w.Header(), "Accept-Encoding")
+
+		if !acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip") {
+			serve()
+			return
+		}
+
+		// Set the Content-Type from the original file name, otherwise it
+		// would be taken from the ".gz" extension.
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Encoding", "gzip")
+
+		http.ServeFileFS(w, r, fsys, gzName)
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/ui"
+)
+
+func TestAssetURL(t *testing.T) {
+	url, err := staticAssets.url("css/main.css")
+	assert.NilError(t, err)
+
+	if !regexp.MustCompile(`^/static/css/main\.[0-9a-f]{16}\.css$`).MatchString(url) {
+		t.Errorf("got %q; want fingerprinted URL", url)
+	}
+
+	_, err = staticAssets.url("css/missing.css")
+	if err == nil {
+		t.Error("got nil error; want error for unknown asset")
+	}
+}
+
+func TestStaticFilesFingerprinted(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	hashedURL, err := staticAssets.url("css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		urlPath          string
+		wantCode         int
+		wantCacheControl string
+	}{
+		{
+			name:             "Fingerprinted",
+			urlPath:          hashedURL,
+			wantCode:         http.StatusOK,
+			wantCacheControl: "public, max-age=31536000, immutable",
+		},
+		{
+			name:             "Unhashed",
+			urlPath:          "/static/css/main.css",
+			wantCode:         http.StatusOK,
+			wantCacheControl: "",
+		},
+		{
+			name:             "Wrong hash",
+			urlPath:          "/static/css/main.0000000000000000.css",
+			wantCode:         http.StatusNotFound,
+			wantCacheControl: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Cache-Control"), tt.wantCacheControl)
+
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, header.Get("Content-Type"), "text/css; charset=utf-8")
+				assert.StringContains(t, body, "body")
+			}
+		})
+	}
+}
+
+// The TestTemplateAssets test checks that every asset referenced from the
+// templates exists and is served, and that the templates don't link to any
+// static files without fingerprinting them.
+func TestTemplateAssets(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	assetCall := regexp.MustCompile(`\{\{\s*asset\s+"([^"]+)"\s*\}\}`)
+	staticLink := regexp.MustCompile(`["']/static/`)
+
+	templates, err := fs.Glob(ui.Files, "html/*/*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates = append(templates, "html/base.tmpl")
+
+	found := 0
+	for _, name := range templates {
+		src, err := fs.ReadFile(ui.Files, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if staticLink.Match(src) {
+			t.Errorf("%s: links to /static/ directly; use the asset function", name)
+		}
+
+		for _, match := range assetCall.FindAllSubmatch(src, -1) {
+			found++
+			asset := string(match[1])
+
+			url, err := staticAssets.url(asset)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+
+			code, header, _ := ts.get(t, url)
+			if code != http.StatusOK {
+				t.Errorf("%s: GET %s: got status %d; want %d", name, url, code, http.StatusOK)
+			}
+			assert.Equal(t, header.Get("Cache-Control"), "public, max-age=31536000, immutable")
+		}
+	}
+
+	if found == 0 {
+		t.Error("found no asset references in the templates")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/internal/client"
+)
+
+// The newTestClient() helper returns an API client for the test server. The
+// test server uses a self-signed certificate, just like the development
+// server, so we write it to a PEM file and pass that to the client in the
+// same way a user would with the ca_cert setting.
+func newTestClient(t *testing.T, ts *testServer, token string) *client.Client {
+	t.Helper()
+
+	caFile := filepath.Join(t.TempDir(), "cert.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}
+
+	err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := client.New(ts.URL, token, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestClient(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Untrusted certificate", func(t *testing.T) {
+		c, err := client.New(ts.URL, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Get(1)
+		if err == nil {
+			t.Fatal("got nil error; want certificate error")
+		}
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		c := newTestClient(t, ts, "sbx_WRITETOKEN")
+
+		s, err := c.Create("main.go", "package main\n", 7)
+		assert.NilError(t, err)
+		assert.Equal(t, s.ID, 2)
+		assert.Equal(t, s.Content, "package main\n")
+		assert.Equal(t, c.SnippetURL(s.ID), ts.URL+"/snippet/view/2")
+	})
+
+	t.Run("Create with read token", func(t *testing.T) {
+		c := newTestClient(t, ts, "sbx_READTOKEN")
+
+		_, err := c.Create("main.go", "package main\n", 7)
+
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("got %v; want *client.Error", err)
+		}
+		assert.Equal(t, apiErr.StatusCode, http.StatusForbidden)
+	})
+
+	t.Run("Create invalid", func(t *testing.T) {
+		c := newTestClient(t, ts, "sbx_WRITETOKEN")
+
+		_, err := c.Create("", "package main\n", 7)
+
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("got %v; want *client.Error", err)
+		}
+		assert.Equal(t, apiErr.StatusCode, http.StatusUnprocessableEntity)
+		assert.StringContains(t, apiErr.Fields["title"], "cannot be blank")
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		c := newTestClient(t, ts, "")
+
+		s, err := c.Get(1)
+		assert.NilError(t, err)
+		assert.Equal(t, s.Title, "An old silent Pond")
+		assert.Equal(t, s.Content, "An old silent pond...")
+	})
+
+	t.Run("Get with files", func(t *testing.T) {
+		c := newTestClient(t, ts, "")
+
+		s, err := c.Get(5)
+		assert.NilError(t, err)
+		assert.Equal(t, len(s.Files), 3)
+		assert.Equal(t, s.Files[0].Name, "main.go")
+		assert.StringContains(t, s.Files[0].Content, "package main")
+		assert.Equal(t, s.Files[2].Language, "text")
+	})
+
+	t.Run("Get missing", func(t *testing.T) {
+		c := newTestClient(t, ts, "")
+
+		_, err := c.Get(99)
+		assert.Equal(t, errors.Is(err, client.ErrNotFound), true)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		c := newTestClient(t, ts, "")
+
+		snippets, total, err := c.List(1, 20)
+		assert.NilError(t, err)
+		assert.Equal(t, total, 1)
+		assert.Equal(t, len(snippets), 1)
+		assert.Equal(t, snippets[0].ID, 1)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		c := newTestClient(t, ts, "sbx_WRITETOKEN")
+
+		err := c.Delete(1)
+		assert.NilError(t, err)
+
+		err = c.Delete(99)
+		assert.Equal(t, errors.Is(err, client.ErrNotFound), true)
+	})
+
+	t.Run("Delete without token", func(t *testing.T) {
+		c := newTestClient(t, ts, "")
+
+		err := c.Delete(1)
+
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("got %v; want *client.Error", err)
+		}
+		assert.Equal(t, apiErr.StatusCode, http.StatusUnauthorized)
+	})
+}
+
+// TestClientMatchesOpenAPI checks that every field which the client decodes
+// is one which the API documents, and that the client's File type has all of
+// the fields of a file in the spec.
+func TestClientMatchesOpenAPI(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+
+	properties := func(schema string) map[string]any {
+		s, _ := spec.Components.Schemas[schema].(map[string]any)
+		p, _ := s["properties"].(map[string]any)
+		if len(p) == 0 {
+			t.Fatalf("openapi.json has no properties for %s", schema)
+		}
+		return p
+	}
+
+	snippetFields := jsonFields(reflect.TypeFor[client.Snippet]())
+	for _, field := range snippetFields {
+		if _, ok := properties("Snippet")[field]; !ok {
+			t.Errorf("client.Snippet has field %q which isn't in the Snippet schema", field)
+		}
+	}
+	if !slices.Contains(snippetFields, "files") {
+		t.Error("client.Snippet doesn't have the files field")
+	}
+
+	fileFields := jsonFields(reflect.TypeFor[client.File]())
+	for field := range properties("SnippetFile") {
+		if !slices.Contains(fileFields, field) {
+			t.Errorf("client.File doesn't have the %q field from the SnippetFile schema", field)
+		}
+	}
+	for _, field := range fileFields {
+		if _, ok := properties("SnippetFile")[field]; !ok {
+			t.Errorf("client.File has field %q which isn't in the SnippetFile schema", field)
+		}
+	}
+}
+
+// The jsonFields() helper returns the JSON names of a struct's fields.
+func jsonFields(typ reflect.Type) []string {
+	var fields []string
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// The minCompressSize is the smallest response body worth compressing.
+// Below this the compression headers and framing cost more than they save.
+const minCompressSize = 1024
+
+// The encoders we support, in order of preference when the client accepts
+// more than one of them.
+var supportedEncodings = []string{"br", "gzip"}
+
+// The parseAcceptEncoding() function returns the quality value for each
+// content coding in an Accept-Encoding header, like "gzip, br;q=0.9".
+func parseAcceptEncoding(acceptEncoding string) map[string]float64 {
+	qualities := map[string]float64{}
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[coding] = q
+	}
+
+	return qualities
+}
+
+// The encodingQuality() helper returns the quality value for a coding, using
+// the "*" wildcard if the coding isn't listed. A value of 0 means the coding
+// isn't acceptable.
+func encodingQuality(qualities map[string]float64, coding string) float64 {
+	if q, ok := qualities[coding]; ok {
+		return q
+	}
+	return qualities["*"]
+}
+
+// The negotiateEncoding() function picks the content coding to use for a
+// request's Accept-Encoding header. It returns "" if the response should be
+// sent uncompressed.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := parseAcceptEncoding(acceptEncoding)
+
+	best, bestQ := "", 0.0
+	for _, coding := range supportedEncodings {
+		if q := encodingQuality(qualities, coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// The acceptsEncoding() function reports whether a request's Accept-Encoding
+// header allows the given coding.
+func acceptsEncoding(acceptEncoding, coding string) bool {
+	return encodingQuality(parseAcceptEncoding(acceptEncoding), coding) > 0
+}
+
+// The isCompressibleType() function reports whether a Content-Type is worth
+// compressing. Images, fonts and archives are already compressed, so we only
+// compress text-based formats.
+func isCompressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml", "image/x-icon", "image/vnd.microsoft.icon":
+		return true
+	}
+	return false
+}
+
+// The addVary() helper adds a header name to the Vary header, unless it's
+// already there.
+func addVary(h http.Header, name string) {
+	for _, line := range h.Values("Vary") {
+		for _, v := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+// Encoders are pooled, because creating them allocates large buffers.
+var (
+	gzipPool   = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	brotliPool = sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, 5) }}
+)
+
+// The compressWriter type wraps a http.ResponseWriter, buffering the start of
+// the response until it knows enough to decide whether to compress it: the
+// Content-Type and Content-Encoding headers, the status code and whether the
+// body is at least minCompressSize bytes long.
+//
+// The status code passed to WriteHeader() is held back too, since the
+// headers can't be sent until the decision is made. That fits the way
+// render() writes the status and then the whole page in one go.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+
+	// Informational responses are sent straight away, and don't count as
+	// the real status.
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.status = status
+
+	// Responses which can't have a body are passed straight through.
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf.Write(b)
+		if cw.buf.Len() < minCompressSize {
+			return len(b), nil
+		}
+		err := cw.decide(true)
+		if err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// The decide() method makes the decision to compress or not, sends the
+// headers and writes out anything buffered so far. The large argument says
+// whether the body is big enough to be worth compressing.
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+
+	h := cw.Header()
+
+	// Set the Content-Type now, if the handler didn't, since it can't be
+	// sniffed from the body once that's compressed.
+	if cw.buf.Len() > 0 && h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(cw.buf.Bytes()))
+	}
+
+	eligible := large &&
+		cw.status != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" &&
+		isCompressibleType(h.Get("Content-Type"))
+
+	if eligible {
+		// The response depends on the Accept-Encoding header, whether or not
+		// this particular client gets it compressed.
+		addVary(h, "Accept-Encoding")
+	}
+
+	if eligible && cw.encoding != "" {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+
+		// The compressed body is a different sequence of bytes, so a strong
+		// ETag no longer applies to it.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		switch cw.encoding {
+		case "br":
+			bw := brotliPool.Get().(*brotli.Writer)
+			bw.Reset(cw.ResponseWriter)
+			cw.encoder = bw
+		case "gzip":
+			gw := gzipPool.Get().(*gzip.Writer)
+			gw.Reset(cw.ResponseWriter)
+			cw.encoder = gw
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// The close() method finishes the response once the handler has returned,
+// sending a small buffered body as it is, or flushing the encoder.
+func (cw *compressWriter) close() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			// The handler didn't write anything at all.
+			return nil
+		}
+		return cw.decide(false)
+	}
+
+	if cw.encoder == nil {
+		return nil
+	}
+
+	err := cw.encoder.Close()
+	switch e := cw.encoder.(type) {
+	case *gzip.Writer:
+		e.Reset(io.Discard)
+		gzipPool.Put(e)
+	case *brotli.Writer:
+		e.Reset(io.Discard)
+		brotliPool.Put(e)
+	}
+	cw.encoder = nil
+	return err
+}
+
+// The FlushError() method sends everything written so far to the client.
+// If the decision to compress hasn't been made yet, it's made now based on
+// the type alone, since a handler which flushes is probably streaming.
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		err := cw.decide(true)
+		if err != nil {
+			return err
+		}
+	}
+
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		err := f.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Flush() {
+	cw.FlushError()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// The compress middleware compresses responses with brotli or gzip, if the
+// client supports it and the response is large enough and of a suitable
+// type. Responses which already have a Content-Encoding, like precompressed
+// static files, are left alone.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: negotiateEncoding(r.Header.Get("Accept-Encoding"))}
+		next.ServeHTTP(cw, r)
+
+		// This isn't deferred, so that if the handler panics, whatever it
+		// buffered is thrown away and recoverPanic can send its own response.
+		cw.close()
+	})
+}
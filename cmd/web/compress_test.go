@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/ui"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{
+			name:           "Empty",
+			acceptEncoding: "",
+			want:           "",
+		},
+		{
+			name:           "Gzip",
+			acceptEncoding: "gzip, deflate",
+			want:           "gzip",
+		},
+		{
+			name:           "Brotli preferred",
+			acceptEncoding: "gzip, deflate, br",
+			want:           "br",
+		},
+		{
+			name:           "Quality values",
+			acceptEncoding: "br;q=0.5, gzip;q=0.8",
+			want:           "gzip",
+		},
+		{
+			name:           "Refused",
+			acceptEncoding: "gzip;q=0",
+			want:           "",
+		},
+		{
+			name:           "Wildcard",
+			acceptEncoding: "*",
+			want:           "br",
+		},
+		{
+			name:           "Wildcard refused",
+			acceptEncoding: "identity, *;q=0",
+			want:           "",
+		},
+		{
+			name:           "Case insensitive",
+			acceptEncoding: "GZIP",
+			want:           "gzip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, negotiateEncoding(tt.acceptEncoding), tt.want)
+		})
+	}
+}
+
+// The decompress() helper decodes a response body according to its
+// Content-Encoding.
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var r io.Reader = bytes.NewReader(body)
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(r)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompress(t *testing.T) {
+	page := "<!doctype html><html><body>" + strings.Repeat("<p>Snippetbox</p>", 200) + "</body></html>"
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantEncoding   string
+		wantVary       bool
+		wantStatus     int
+		wantBody       string
+	}{
+		{
+			name:           "Buffered page",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// Like render(), with no Content-Type.
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write([]byte(page))
+			},
+			wantEncoding: "gzip",
+			wantVary:     true,
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantBody:     page,
+		},
+		{
+			name:           "Many small writes",
+			acceptEncoding: "br",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				for range 200 {
+					w.Write([]byte("<p>Snippetbox</p>"))
+				}
+			},
+			wantEncoding: "br",
+			wantVary:     true,
+			wantStatus:   http.StatusOK,
+			wantBody:     strings.Repeat("<p>Snippetbox</p>", 200),
+		},
+		{
+			name:           "Client doesn't accept compression",
+			acceptEncoding: "",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(page))
+			},
+			wantEncoding: "",
+			wantVary:     true,
+			wantStatus:   http.StatusOK,
+			wantBody:     page,
+		},
+		{
+			name:           "Small response",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			},
+			wantEncoding: "",
+			wantVary:     false,
+			wantStatus:   http.StatusOK,
+			wantBody:     "OK",
+		},
+		{
+			name:           "Already compressed type",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte(page))
+			},
+			wantEncoding: "",
+			wantVary:     false,
+			wantStatus:   http.StatusOK,
+			wantBody:     page,
+		},
+		{
+			name:           "Already encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "identity")
+				w.Write([]byte(page))
+			},
+			wantEncoding: "identity",
+			wantVary:     false,
+			wantStatus:   http.StatusOK,
+			wantBody:     page,
+		},
+		{
+			name:           "No body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			wantEncoding: "",
+			wantVary:     false,
+			wantStatus:   http.StatusNoContent,
+			wantBody:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			compress(tt.handler).ServeHTTP(rr, r)
+
+			rs := rr.Result()
+			encoding := rs.Header.Get("Content-Encoding")
+
+			assert.Equal(t, rs.StatusCode, tt.wantStatus)
+			assert.Equal(t, encoding, tt.wantEncoding)
+			assert.Equal(t, rs.Header.Get("Vary") == "Accept-Encoding", tt.wantVary)
+			assert.Equal(t, decompress(t, encoding, rr.Body.Bytes()), tt.wantBody)
+
+			if encoding == "gzip" || encoding == "br" {
+				assert.Equal(t, rs.Header.Get("Content-Length"), "")
+				if rr.Body.Len() >= len(tt.wantBody) {
+					t.Errorf("compressed body is %d bytes; want less than %d", rr.Body.Len(), len(tt.wantBody))
+				}
+			}
+		})
+	}
+}
+
+func TestCompressPages(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, want := ts.do(t, http.MethodGet, "/", http.Header{"Accept-Encoding": {"identity"}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, rs.Header.Get("Content-Encoding"), "gzip")
+	assert.Equal(t, rs.Header.Get("Content-Type"), "text/html; charset=utf-8")
+	// The CSRF token in the language menu is masked differently every time,
+	// so leave it out of the comparison.
+	csrfToken := regexp.MustCompile(`name='csrf_token' value='[^']*'`)
+	got := strings.TrimSpace(decompress(t, "gzip", body))
+	assert.Equal(t, csrfToken.ReplaceAllString(got, ""), csrfToken.ReplaceAllString(want, ""))
+}
+
+func TestStaticFilesPrecompressed(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	original, err := ui.Files.ReadFile("static/css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	precompressed, err := ui.Files.ReadFile("static/css/main.css.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+		wantBody       []byte
+	}{
+		{
+			name:           "Gzip accepted",
+			acceptEncoding: "gzip, br",
+			wantEncoding:   "gzip",
+			wantBody:       precompressed,
+		},
+		{
+			name:           "Gzip not accepted",
+			acceptEncoding: "identity",
+			wantEncoding:   "",
+			wantBody:       original,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/static/css/main.css", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+
+			rs, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Body.Close()
+
+			body, err := io.ReadAll(rs.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, rs.StatusCode, http.StatusOK)
+			assert.Equal(t, rs.Header.Get("Content-Type"), "text/css; charset=utf-8")
+			assert.Equal(t, rs.Header.Get("Content-Encoding"), tt.wantEncoding)
+			assert.Equal(t, strings.Join(rs.Header.Values("Vary"), ", "), "Accept-Encoding")
+			assert.Equal(t, bytes.Equal(body, tt.wantBody), true)
+		})
+	}
+
+	// The precompressed file decompresses to the original.
+	assert.Equal(t, decompress(t, "gzip", precompressed), string(original))
+}
@@ -2,4 +2,16 @@ package main
 
 type contextKey string
 
-const isAuthenticatedContextKey = contextKey("isAuthenticated")
+const (
+	isAuthenticatedContextKey      = contextKey("isAuthenticated")
+	authenticatedUserIDContextKey  = contextKey("authenticatedUserID")
+	userRoleContextKey             = contextKey("userRole")
+	isTokenAuthenticatedContextKey = contextKey("isTokenAuthenticated")
+	requestIDContextKey            = contextKey("requestID")
+	requestSchemeContextKey        = contextKey("requestScheme")
+	fromTrustedProxyContextKey     = contextKey("fromTrustedProxy")
+	sessionLoadedContextKey        = contextKey("sessionLoaded")
+	muxErrorStatusContextKey       = contextKey("muxErrorStatus")
+	userLanguageContextKey         = contextKey("userLanguage")
+	userTimezoneContextKey         = contextKey("userTimezone")
+)
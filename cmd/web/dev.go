@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"snippetbox.example.com/internal/i18n"
+)
+
+// The devUI type is used in development mode (the -dev flag) instead of the
+// embedded ui.Files. It reads the templates and static files from the ui
+// directory on disk, and parses the templates again whenever they change, so
+// that changes show up without rebuilding and restarting the application.
+type devUI struct {
+	fsys   fs.FS
+	bundle *i18n.Bundle
+
+	mu        sync.Mutex
+	signature string
+	cache     map[string]map[string]*template.Template
+	err       error
+}
+
+// The message catalogs in the bundle are the embedded ones, so changes to
+// them still need a restart.
+func newDevUI(dir string, bundle *i18n.Bundle) *devUI {
+	return &devUI{fsys: os.DirFS(dir), bundle: bundle}
+}
+
+// The templates() method returns the template cache, parsing the templates
+// again first if any of them has been added, removed or modified since last
+// time. If they don't parse, the error is returned until they're fixed.
+func (d *devUI) templates() (map[string]map[string]*template.Template, error) {
+	signature, err := d.templateSignature()
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if signature != d.signature {
+		d.cache, d.err = newTemplateCache(d.fsys, d.functions(), d.bundle)
+		d.signature = signature
+	}
+
+	return d.cache, d.err
+}
+
+// The templateSignature() method returns a string which changes whenever
+// a template file is added, removed or modified. Checking the file sizes and
+// modification times on every request is cheap enough for development.
+func (d *devUI) templateSignature() (string, error) {
+	var sig strings.Builder
+
+	err := fs.WalkDir(d.fsys, "html", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sig, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+
+	return sig.String(), err
+}
+
+// The functions() method returns the template functions for development.
+// Static files aren't fingerprinted, since they can change at any time, so
+// the asset function just checks that the file exists and returns its plain
+// URL.
+func (d *devUI) functions() template.FuncMap {
+	funcs := template.FuncMap{}
+	for name, fn := range functions {
+		funcs[name] = fn
+	}
+
+	funcs["asset"] = func(name string) (string, error) {
+		_, err := fs.Stat(d.fsys, path.Join("static", name))
+		if err != nil {
+			return "", fmt.Errorf("unknown static asset %q", name)
+		}
+		return "/static/" + name, nil
+	}
+
+	return funcs
+}
+
+// The staticFiles() method returns a handler which serves the static files
+// from disk. The precompressed ".gz" copies are ignored, since they would be
+// out of date as soon as a file was edited.
+func (d *devUI) staticFiles() http.Handler {
+	return http.FileServerFS(d.fsys)
+}
+
+// Template errors look like "template: view.tmpl:12:5: executing ...", and
+// the templateErrorLocation regular expression picks out the file name and
+// line number.
+var templateErrorLocation = regexp.MustCompile(`template: ([^:\s]+):(\d+)`)
+
+// The sourceLine type is one line of template source on the error page.
+type sourceLine struct {
+	Number    int
+	Text      string
+	Highlight bool
+}
+
+// The sourceContext() method returns the lines of template source around the
+// location given in a template error, if it can find them.
+func (d *devUI) sourceContext(err error) (string, []sourceLine) {
+	match := templateErrorLocation.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "", nil
+	}
+	name := match[1]
+	lineNumber, _ := strconv.Atoi(match[2])
+
+	// The template name is the base name of the file, so look for it in
+	// each of the template directories.
+	for _, pattern := range []string{"html/" + name, "html/*/" + name} {
+		files, _ := fs.Glob(d.fsys, pattern)
+		if len(files) == 0 {
+			continue
+		}
+
+		src, err := fs.ReadFile(d.fsys, files[0])
+		if err != nil {
+			return "", nil
+		}
+
+		var lines []sourceLine
+		for i, text := range strings.Split(string(src), "\n") {
+			n := i + 1
+			if n >= lineNumber-5 && n <= lineNumber+5 {
+				lines = append(lines, sourceLine{Number: n, Text: text, Highlight: n == lineNumber})
+			}
+		}
+		return files[0], lines
+	}
+
+	return "", nil
+}
+
+var devErrorPage = template.Must(template.New("error").Parse(`<!doctype html>
+<html lang='en'>
+<head>
+<meta charset='utf-8'>
+<title>Template error - Snippetbox</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #34495E; }
+h1 { color: #c0392b; }
+pre { background: #f5f5f5; padding: 1em; overflow-x: auto; }
+.highlight { background: #fadbd8; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Template error</h1>
+<p>{{.Method}} {{.URI}}{{with .Page}} rendering <code>{{.}}</code>{{end}}</p>
+<pre>{{.Error}}</pre>
+{{with .Lines}}
+<h2>{{$.File}}</h2>
+<pre>{{range .}}<span{{if .Highlight}} class='highlight'{{end}}>{{printf "%4d" .Number}}  {{.Text}}</span>
+{{end}}</pre>
+{{end}}
+<p>This page is only shown in development mode.</p>
+</body>
+</html>
+`))
+
+// The devTemplateError() method logs a template error and sends a page
+// describing it, with the template source around where it happened. It's
+// only ever called in development mode; in production, template errors are
+// reported with serverError() like any other.
+func (app *application) devTemplateError(w http.ResponseWriter, r *http.Request, page string, err error) {
+	app.logger.ErrorContext(r.Context(), err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+
+	file, lines := app.dev.sourceContext(err)
+
+	data := map[string]any{
+		"Method": r.Method,
+		"URI":    r.URL.RequestURI(),
+		"Page":   page,
+		"Error":  err.Error(),
+		"File":   file,
+		"Lines":  lines,
+	}
+
+	buf := new(bytes.Buffer)
+	if execErr := devErrorPage.Execute(buf, data); execErr != nil {
+		app.serverError(w, r, execErr)
+		return
+	}
+
+	// The page has its own inline styles, which the normal policy blocks.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	buf.WriteTo(w)
+}
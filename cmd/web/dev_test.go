@@ -0,0 +1,156 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/ui"
+)
+
+// The newDevTestApplication() helper returns an application in development
+// mode, using a copy of the ui directory which the test can modify.
+func newDevTestApplication(t *testing.T) (*application, string) {
+	dir := t.TempDir()
+	err := os.CopyFS(dir, ui.Files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication(t)
+	app.templateCache = nil
+	app.dev = newDevUI(dir, app.i18n)
+
+	return app, dir
+}
+
+// The editFile() helper changes a file, making sure that its modification
+// time moves on even if the filesystem's clock is coarse.
+func editFile(t *testing.T, name string, edit func(string) string) {
+	t.Helper()
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(name, []byte(edit(string(src))), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := info.ModTime().Add(time.Second)
+	err = os.Chtimes(name, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDevTemplateReload(t *testing.T) {
+	app, dir := newDevTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Latest Snippets")
+
+	// Static files aren't fingerprinted in development mode.
+	assert.StringContains(t, body, "href='/static/css/main.css'")
+
+	home := filepath.Join(dir, "html", "pages", "home.tmpl")
+	editFile(t, home, func(src string) string {
+		return strings.Replace(src, `{{T "home.latest"}}`, "Freshly Edited Snippets", 1)
+	})
+
+	code, _, body = ts.get(t, "/")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "Freshly Edited Snippets")
+}
+
+func TestDevStaticFiles(t *testing.T) {
+	app, dir := newDevTestApplication(t)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	css := filepath.Join(dir, "static", "css", "main.css")
+	editFile(t, css, func(src string) string {
+		return src + "\n/* edited */\n"
+	})
+
+	code, _, body := ts.get(t, "/static/css/main.css")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "/* edited */")
+}
+
+func TestDevTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		edit     func(string) string
+		wantBody []string
+	}{
+		{
+			name: "Parse error",
+			edit: func(src string) string {
+				return strings.Replace(src, "{{end}}", "{{end", 1)
+			},
+			wantBody: []string{"Template error", "home.tmpl", "html/pages/home.tmpl", "class='highlight'"},
+		},
+		{
+			name: "Execution error",
+			edit: func(src string) string {
+				return strings.Replace(src, "{{if .Snippets}}", "{{if .NoSuchField}}", 1)
+			},
+			wantBody: []string{"Template error", "can&#39;t evaluate field NoSuchField", "rendering <code>home.tmpl</code>", "class='highlight'"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, dir := newDevTestApplication(t)
+
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			editFile(t, filepath.Join(dir, "html", "pages", "home.tmpl"), tt.edit)
+
+			code, header, body := ts.get(t, "/")
+			assert.Equal(t, code, http.StatusInternalServerError)
+			assert.Equal(t, header.Get("Content-Type"), "text/html; charset=utf-8")
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+}
+
+// Outside development mode, template errors are reported like any other
+// server error, without any details.
+func TestTemplateErrorsInProduction(t *testing.T) {
+	app := newTestApplication(t)
+
+	ts, err := template.New("home.tmpl").Parse(`{{define "base"}}{{.NoSuchField}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.templateCache = map[string]map[string]*template.Template{"en": {"home.tmpl": ts}}
+
+	srv := newTestServer(t, app.routes())
+	defer srv.Close()
+
+	code, _, body := srv.get(t, "/")
+	assert.Equal(t, code, http.StatusInternalServerError)
+	assert.Equal(t, body, "Internal Server Error")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The wantsJSON() helper reports whether an error response should be JSON
+// rather than an HTML page: for requests to the API, and for clients which
+// prefer application/json to text/html in their Accept header.
+func wantsJSON(r *http.Request) bool {
+	if isAPIRequest(r) {
+		return true
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+
+	var jsonQ, htmlQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+
+	return jsonQ > htmlQ
+}
+
+// The errorResponse() method sends an error response with the given status
+// code. Browsers get an HTML page using the base layout, so that it has the
+// same look and navigation as the rest of the site; API clients get JSON
+// like {"error": "not found"}. For server errors, the response includes the
+// request ID, which lets us find the matching entry in the logs.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int) {
+
+	if wantsJSON(r) {
+		app.errorJSON(w, r, status, strings.ToLower(http.StatusText(status)))
+		return
+	}
+
+	// The status text and explanation come from the message catalog, with
+	// keys like "status.404" and "error.404". A status code without any
+	// messages just gets the standard status text.
+	data := app.newTemplateData(r)
+	catalog := app.i18n.Catalog(data.Locale)
+	data.StatusCode = status
+	data.StatusText = http.StatusText(status)
+	if key := fmt.Sprintf("status.%d", status); catalog.Has(key) {
+		data.StatusText = catalog.T(key)
+	}
+	if key := fmt.Sprintf("error.%d", status); catalog.Has(key) {
+		data.ErrorMessage = catalog.T(key)
+	}
+	if status >= http.StatusInternalServerError {
+		data.RequestID = requestIDFromContext(r)
+	}
+
+	// Unlike render(), a problem here can't be reported with serverError(),
+	// since that would try to render an error page again. Instead we fall
+	// back to a plain text response.
+	templateCache := app.templateCache
+	if app.dev != nil {
+		templateCache, _ = app.dev.templates()
+	}
+
+	ts, ok := templateCache[data.Locale]["error.tmpl"]
+	if !ok {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	err := ts.ExecuteTemplate(buf, "base", data)
+	if err != nil {
+		app.logger.ErrorContext(r.Context(), err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// The notFound() helper sends a 404 Not Found error page.
+func (app *application) notFound(w http.ResponseWriter, r *http.Request) {
+	app.errorResponse(w, r, http.StatusNotFound)
+}
+
+// The muxErrorWriter type stands in for the real http.ResponseWriter while
+// the servemux's own "404 page not found" or "405 method not allowed"
+// handler runs. It records the status code and throws the plain text body
+// away, but leaves any other response, like a redirect to the canonical
+// path, alone.
+type muxErrorWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (mw *muxErrorWriter) WriteHeader(status int) {
+	if status == http.StatusNotFound || status == http.StatusMethodNotAllowed {
+		mw.status = status
+
+		// http.Error() has already set these for its plain text body.
+		mw.Header().Del("Content-Type")
+		mw.Header().Del("X-Content-Type-Options")
+		return
+	}
+	mw.ResponseWriter.WriteHeader(status)
+}
+
+func (mw *muxErrorWriter) Write(b []byte) (int, error) {
+	if mw.status != 0 {
+		return len(b), nil
+	}
+	return mw.ResponseWriter.Write(b)
+}
+
+// The handleMuxErrors() method wraps the servemux so that requests which
+// don't match any route get our error pages instead of its plain text
+// responses. They are passed on to the errorPage handler, with the status
+// code in the request context.
+//
+// The servemux doesn't say whether it found a route, so we ask it first
+// with mux.Handler(). If there's a match, the request is passed straight to
+// mux.ServeHTTP(), which is what sets r.Pattern and the path values.
+func (app *application) handleMuxErrors(mux *http.ServeMux, errorPage http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// Run the servemux's own handler, which also sets the Allow header
+		// for a 405 response.
+		mw := &muxErrorWriter{ResponseWriter: w}
+		h.ServeHTTP(mw, r)
+
+		if mw.status != 0 {
+			ctx := context.WithValue(r.Context(), muxErrorStatusContextKey, mw.status)
+			errorPage.ServeHTTP(w, r.WithContext(ctx))
+		}
+	})
+}
+
+// The muxError() handler sends the error page for a request which didn't
+// match any route. It's used by handleMuxErrors().
+func (app *application) muxError(w http.ResponseWriter, r *http.Request) {
+	status, ok := r.Context().Value(muxErrorStatusContextKey).(int)
+	if !ok {
+		status = http.StatusNotFound
+	}
+	app.errorResponse(w, r, status)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		urlPath string
+		accept  string
+		want    bool
+	}{
+		{"Browser", "/snippet/view/2", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"No Accept header", "/snippet/view/2", "", false},
+		{"JSON", "/snippet/view/2", "application/json", true},
+		{"JSON preferred", "/snippet/view/2", "text/html;q=0.5, application/json", true},
+		{"HTML preferred", "/snippet/view/2", "application/json;q=0.5, text/html", false},
+		{"API", "/api/v1/snippets/2", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, tt.urlPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			assert.Equal(t, wantsJSON(r), tt.want)
+		})
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Without the view.tmpl template, viewing a snippet is a server error.
+	for _, pages := range app.templateCache {
+		delete(pages, "view.tmpl")
+	}
+
+	// Trust the test client as a proxy, so that it can set the request ID.
+	app.trustedProxies, _ = parseTrustedProxies("127.0.0.0/8, ::1")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		method          string
+		urlPath         string
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        []string
+		wantAllow       string
+	}{
+		{
+			name:            "Not found",
+			method:          http.MethodGet,
+			urlPath:         "/snippet/view/2",
+			wantCode:        http.StatusNotFound,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        []string{"<h2>404 Not Found</h2>", "<nav>"},
+		},
+		{
+			name:            "Unknown route",
+			method:          http.MethodGet,
+			urlPath:         "/no/such/page",
+			wantCode:        http.StatusNotFound,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        []string{"<h2>404 Not Found</h2>", "<nav>"},
+		},
+		{
+			name:            "Unknown route with POST",
+			method:          http.MethodPost,
+			urlPath:         "/no/such/page",
+			wantCode:        http.StatusNotFound,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        []string{"<h2>404 Not Found</h2>"},
+		},
+		{
+			name:            "Method not allowed",
+			method:          http.MethodDelete,
+			urlPath:         "/snippet/view/1",
+			wantCode:        http.StatusMethodNotAllowed,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        []string{"<h2>405 Method Not Allowed</h2>"},
+			wantAllow:       "GET, HEAD",
+		},
+		{
+			name:            "Server error",
+			method:          http.MethodGet,
+			urlPath:         "/snippet/view/1",
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        []string{"<h2>500 Internal Server Error</h2>", "Request ID: <code>test-request-id</code>"},
+		},
+		{
+			name:            "Not found as JSON",
+			method:          http.MethodGet,
+			urlPath:         "/snippet/view/2",
+			accept:          "application/json",
+			wantCode:        http.StatusNotFound,
+			wantContentType: "application/json",
+			wantBody:        []string{`"error": "not found"`},
+		},
+		{
+			name:            "Server error as JSON",
+			method:          http.MethodGet,
+			urlPath:         "/snippet/view/1",
+			accept:          "application/json",
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: "application/json",
+			wantBody:        []string{`"error": "internal server error"`, `"request_id": "test-request-id"`},
+		},
+		{
+			name:            "Unknown API route",
+			method:          http.MethodGet,
+			urlPath:         "/api/v1/nothing",
+			wantCode:        http.StatusNotFound,
+			wantContentType: "application/json",
+			wantBody:        []string{`"error": "not found"`},
+		},
+		{
+			name:            "API method not allowed",
+			method:          http.MethodPut,
+			urlPath:         "/api/v1/snippets/1",
+			wantCode:        http.StatusMethodNotAllowed,
+			wantContentType: "application/json",
+			wantBody:        []string{`"error": "method not allowed"`},
+			wantAllow:       "DELETE, GET, HEAD, PATCH",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Request-ID", "test-request-id")
+			if tt.accept != "" {
+				header.Set("Accept", tt.accept)
+			}
+
+			code, rsHeader, body := ts.do(t, tt.method, tt.urlPath, header, nil)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, rsHeader.Get("Content-Type"), tt.wantContentType)
+			assert.Equal(t, rsHeader.Get("Allow"), tt.wantAllow)
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+		})
+	}
+}
+
+// Error pages show the navigation bar for the logged-in user, including on
+// URLs which don't match any route.
+func TestErrorPagesLoggedIn(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+	ts.login(t)
+
+	for _, urlPath := range []string{"/admin/users", "/no/such/page"} {
+		_, _, body := ts.get(t, urlPath)
+		assert.StringContains(t, body, "<button>Logout</button>")
+
+		// The logout form needs a CSRF token to work.
+		if extractCSRFToken(t, body) == "" {
+			t.Errorf("%s: got no CSRF token in the logout form", urlPath)
+		}
+	}
+
+	code, _, body := ts.get(t, "/admin/users")
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.StringContains(t, body, "<h2>403 Forbidden</h2>")
+	assert.Equal(t, strings.Contains(body, "Request ID"), false)
+}
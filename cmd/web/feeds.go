@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"snippetbox.example.com/internal/models"
+)
+
+// A feed holds everything we need to know to render a list of snippets as
+// either an Atom or an RSS document.
+type feed struct {
+	title    string
+	author   string
+	selfPath string
+	htmlPath string
+	snippets []models.Snippet
+}
+
+// The atomFeed and related types describe an Atom 1.0 document (RFC 4287).
+// The encoding/xml package takes care of escaping the snippet title and
+// content, so there's no way for a snippet to break out of its element.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// The rssFeed and related types describe an RSS 2.0 document.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// The updated() method returns the time the feed last changed, which is the
+// time the most recently created or edited snippet in it was saved. An empty
+// feed returns the zero time, because there's nothing to say when it last
+// changed.
+//
+// Snippets which are deleted or expire drop out of a feed without changing
+// this time, so feed readers which only send If-Modified-Since may not notice
+// them until the next new or edited snippet. Those which send If-None-Match
+// notice straight away, because the ETag changes.
+func (f *feed) updated() time.Time {
+	var t time.Time
+	for _, s := range f.snippets {
+		if s.Updated.After(t) {
+			t = s.Updated
+		}
+	}
+	if t.IsZero() {
+		return t
+	}
+	return t.UTC().Truncate(time.Second)
+}
+
+// The atomUpdated() method returns the time for the <updated> element of an
+// Atom feed, which is required. An empty feed has no snippets to take the
+// time from, so it uses the current time instead.
+func (f *feed) atomUpdated() time.Time {
+	t := f.updated()
+	if t.IsZero() {
+		return time.Now().UTC().Truncate(time.Second)
+	}
+	return t
+}
+
+// The feedBaseURL() helper returns the scheme and host which links in a feed
+// should use. Feed readers need absolute URLs, so we use the scheme that the
+// client used, which may have been forwarded by a proxy.
+func feedBaseURL(r *http.Request) string {
+	return requestScheme(r) + "://" + r.Host
+}
+
+// The defaultFeedHost is the host name used in the IDs of feed entries if
+// the -feed-host flag is left blank.
+const defaultFeedHost = "snippetbox.example.com"
+
+// The feedIDHost() method returns the host name to use in the IDs of feed
+// entries. It comes from configuration rather than the request, so that an
+// entry keeps the same ID however a feed reader reached us.
+func (app *application) feedIDHost() string {
+	if app.feedHost == "" {
+		return defaultFeedHost
+	}
+	return app.feedHost
+}
+
+// The snippetTagURI() helper returns a stable, globally unique ID for a
+// snippet in the form of a tag URI (RFC 4151), like
+// "tag:snippetbox.example.com,2024-03-17:snippet/1". Unlike the snippet's
+// URL, it doesn't change if a feed reader fetched it with a different scheme
+// or host name.
+func snippetTagURI(host string, s models.Snippet) string {
+	return fmt.Sprintf("tag:%s,%s:snippet/%d", host, s.Created.UTC().Format("2006-01-02"), s.ID)
+}
+
+// The feedContent() helper returns the text of a snippet for a feed entry,
+// which is its content followed by each of its files, with a header line like
+// "==> main.go <==" above each one. That way snippets which are made up only
+// of files don't have empty entries.
+func feedContent(s models.Snippet) string {
+	var b strings.Builder
+	b.WriteString(s.Content)
+
+	for _, f := range s.Files {
+		// Leave a blank line between a file and whatever came before it.
+		if b.Len() > 0 {
+			if !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString("\n")
+			}
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "==> %s <==\n%s", f.Name, f.Content)
+	}
+
+	return b.String()
+}
+
+func (f *feed) atom(r *http.Request, idHost string) any {
+	base := feedBaseURL(r)
+
+	doc := atomFeed{
+		ID:      base + f.selfPath,
+		Title:   f.title,
+		Updated: f.atomUpdated().Format(time.RFC3339),
+		Author:  atomAuthor{Name: f.author},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: base + f.selfPath},
+			{Rel: "alternate", Type: "text/html", Href: base + f.htmlPath},
+		},
+	}
+
+	for _, s := range f.snippets {
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:      snippetTagURI(idHost, s),
+			Title:   s.Title,
+			Updated: s.Updated.UTC().Format(time.RFC3339),
+			Link:    atomLink{Rel: "alternate", Type: "text/html", Href: fmt.Sprintf("%s/snippet/view/%d", base, s.ID)},
+			Content: atomContent{Type: "text", Body: feedContent(s)},
+		})
+	}
+
+	return doc
+}
+
+func (f *feed) rss(r *http.Request, idHost string) any {
+	base := feedBaseURL(r)
+
+	doc := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.title,
+			Link:        base + f.htmlPath,
+			Description: f.title,
+		},
+	}
+
+	if len(f.snippets) > 0 {
+		doc.Channel.LastBuildDate = f.updated().Format(time.RFC1123Z)
+	}
+
+	for _, s := range f.snippets {
+		link := fmt.Sprintf("%s/snippet/view/%d", base, s.ID)
+
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       s.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: false, Value: snippetTagURI(idHost, s)},
+			PubDate:     s.Created.UTC().Format(time.RFC1123Z),
+			Description: feedContent(s),
+		})
+	}
+
+	return doc
+}
+
+// The serveFeed() helper encodes a feed document and writes it to the
+// response. The ETag is a hash of the encoded document, so it changes
+// whenever anything in the feed does. We then hand over to
+// http.ServeContent(), which compares the ETag and the Last-Modified time
+// against the If-None-Match and If-Modified-Since request headers, and sends
+// a 304 Not Modified response to feed readers which are already up to date.
+// If the feed is empty then updated() returns the zero time, and
+// http.ServeContent() leaves out the Last-Modified header altogether.
+func (app *application) serveFeed(w http.ResponseWriter, r *http.Request, contentType string, f *feed, doc any) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	err := enc.Encode(doc)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+
+	http.ServeContent(w, r, "", f.updated(), bytes.NewReader(buf.Bytes()))
+}
+
+// The latestFeed() helper builds the feed of the latest snippets from
+// everyone.
+func (app *application) latestFeed(r *http.Request, selfPath string) (*feed, error) {
+	snippets, err := app.snippets.Latest(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return &feed{
+		title:    "Latest snippets - Snippetbox",
+		author:   "Snippetbox",
+		selfPath: selfPath,
+		htmlPath: "/",
+		snippets: snippets,
+	}, nil
+}
+
+// The userFeed() helper builds the feed of the latest snippets from the user
+// whose ID is in the request path.
+func (app *application) userFeed(r *http.Request, selfPath string) (*feed, error) {
+	user, snippets, err := app.latestByUser(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &feed{
+		title:    fmt.Sprintf("Snippets by %s - Snippetbox", user.Name),
+		author:   user.Name,
+		selfPath: fmt.Sprintf(selfPath, user.ID),
+		htmlPath: fmt.Sprintf("/user/%d", user.ID),
+		snippets: snippets,
+	}, nil
+}
+
+// The tagFeed() helper builds the feed of the latest snippets with the tag
+// whose name is in the request path.
+func (app *application) tagFeed(r *http.Request, selfPath string) (*feed, error) {
+	tag, snippets, err := app.latestByTag(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &feed{
+		title:    fmt.Sprintf("Snippets tagged %s - Snippetbox", tag),
+		author:   "Snippetbox",
+		selfPath: fmt.Sprintf(selfPath, tag),
+		htmlPath: "/tag/" + tag,
+		snippets: snippets,
+	}, nil
+}
+
+func (app *application) feedAtom(w http.ResponseWriter, r *http.Request) {
+	f, err := app.latestFeed(r, "/feed.atom")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.serveFeed(w, r, "application/atom+xml; charset=utf-8", f, f.atom(r, app.feedIDHost()))
+}
+
+func (app *application) feedRSS(w http.ResponseWriter, r *http.Request) {
+	f, err := app.latestFeed(r, "/feed.rss")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.serveFeed(w, r, "application/rss+xml; charset=utf-8", f, f.rss(r, app.feedIDHost()))
+}
+
+func (app *application) userFeedAtom(w http.ResponseWriter, r *http.Request) {
+	f, err := app.userFeed(r, "/user/%d/feed.atom")
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.serveFeed(w, r, "application/atom+xml; charset=utf-8", f, f.atom(r, app.feedIDHost()))
+}
+
+func (app *application) userFeedRSS(w http.ResponseWriter, r *http.Request) {
+	f, err := app.userFeed(r, "/user/%d/feed.rss")
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.serveFeed(w, r, "application/rss+xml; charset=utf-8", f, f.rss(r, app.feedIDHost()))
+}
+
+func (app *application) tagFeedAtom(w http.ResponseWriter, r *http.Request) {
+	f, err := app.tagFeed(r, "/tag/%s/feed.atom")
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.serveFeed(w, r, "application/atom+xml; charset=utf-8", f, f.atom(r, app.feedIDHost()))
+}
+
+func (app *application) tagFeedRSS(w http.ResponseWriter, r *http.Request) {
+	f, err := app.tagFeed(r, "/tag/%s/feed.rss")
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.serveFeed(w, r, "application/rss+xml; charset=utf-8", f, f.rss(r, app.feedIDHost()))
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/internal/models"
+)
+
+// The wellFormedXML() helper reads every token in an XML document, failing
+// the test if the document isn't well-formed.
+func wellFormedXML(t *testing.T, body string) {
+	t.Helper()
+
+	dec := xml.NewDecoder(strings.NewReader(body))
+	for {
+		_, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			t.Fatalf("invalid XML: %v\n%s", err, body)
+		}
+	}
+}
+
+func TestFeeds(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantContentType string
+		wantTitle       string
+		wantEntryTitle  string
+		wantEntryBody   string
+	}{
+		{
+			name:            "Latest Atom",
+			urlPath:         "/feed.atom",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantTitle:       "Latest snippets - Snippetbox",
+			wantEntryTitle:  "An old silent Pond",
+			wantEntryBody:   "An old silent pond...",
+		},
+		{
+			name:            "Latest RSS",
+			urlPath:         "/feed.rss",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/rss+xml; charset=utf-8",
+			wantTitle:       "Latest snippets - Snippetbox",
+			wantEntryTitle:  "An old silent Pond",
+			wantEntryBody:   "An old silent pond...",
+		},
+		{
+			name:            "User Atom",
+			urlPath:         "/user/3/feed.atom",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantTitle:       "Snippets by Carol Smith - Snippetbox",
+			wantEntryTitle:  "Fish & <chips>",
+			wantEntryBody:   "if a < b && b > c {\n\t\"]]>\"\n}",
+		},
+		{
+			name:            "User RSS",
+			urlPath:         "/user/3/feed.rss",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/rss+xml; charset=utf-8",
+			wantTitle:       "Snippets by Carol Smith - Snippetbox",
+			wantEntryTitle:  "Fish & <chips>",
+			wantEntryBody:   "if a < b && b > c {\n\t\"]]>\"\n}",
+		},
+		{
+			name:     "Disabled user",
+			urlPath:  "/user/4/feed.atom",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent user",
+			urlPath:  "/user/99/feed.rss",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid user ID",
+			urlPath:  "/user/foo/feed.atom",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:            "Tag Atom",
+			urlPath:         "/tag/ops/feed.atom",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantTitle:       "Snippets tagged ops - Snippetbox",
+			wantEntryTitle:  "Restarting the web server",
+			wantEntryBody:   "# Restart\n\nRun **this** on the server:\n\n```bash\nsudo systemctl restart web\n```\n\n<script>alert(1)</script>\n",
+		},
+		{
+			name:            "Tag RSS",
+			urlPath:         "/tag/runbook/feed.rss",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/rss+xml; charset=utf-8",
+			wantTitle:       "Snippets tagged runbook - Snippetbox",
+			wantEntryTitle:  "Restarting the web server",
+			wantEntryBody:   "# Restart\n\nRun **this** on the server:\n\n```bash\nsudo systemctl restart web\n```\n\n<script>alert(1)</script>\n",
+		},
+		{
+			name:            "Files Atom",
+			urlPath:         "/tag/go/feed.atom",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/atom+xml; charset=utf-8",
+			wantTitle:       "Snippets tagged go - Snippetbox",
+			wantEntryTitle:  "Nil map panic",
+			wantEntryBody:   "Run `go run .` to see the panic.\n\n==> main.go <==\npackage main\n\nfunc main() {\n\tvar m map[string]int\n\tm[\"a\"] = 1\n}\n\n==> go.mod <==\nmodule repro\n\ngo 1.23\n\n==> notes <1>.txt <==\n</pre><script>alert(1)</script>",
+		},
+		{
+			name:            "Files RSS",
+			urlPath:         "/tag/go/feed.rss",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/rss+xml; charset=utf-8",
+			wantTitle:       "Snippets tagged go - Snippetbox",
+			wantEntryTitle:  "Nil map panic",
+			wantEntryBody:   "Run `go run .` to see the panic.\n\n==> main.go <==\npackage main\n\nfunc main() {\n\tvar m map[string]int\n\tm[\"a\"] = 1\n}\n\n==> go.mod <==\nmodule repro\n\ngo 1.23\n\n==> notes <1>.txt <==\n</pre><script>alert(1)</script>",
+		},
+		{
+			name:     "Tag with capital letters",
+			urlPath:  "/tag/Ops/feed.atom",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Invalid tag",
+			urlPath:  "/tag/-ops/feed.rss",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, header.Get("Content-Type"), tt.wantContentType)
+			wellFormedXML(t, body)
+
+			// Markup in a snippet must never appear unescaped in the feed.
+			if strings.Contains(body, "<chips>") || strings.Contains(body, "<script>") {
+				t.Errorf("got unescaped snippet markup in %q", body)
+			}
+
+			var title, entryTitle, entryBody, entryID string
+
+			if strings.HasSuffix(tt.urlPath, ".atom") {
+				var doc atomFeed
+				err := xml.Unmarshal([]byte(body), &doc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(doc.Entries) != 1 {
+					t.Fatalf("got %d entries; want 1", len(doc.Entries))
+				}
+
+				assert.Equal(t, doc.XMLName.Space, "http://www.w3.org/2005/Atom")
+				assert.StringContains(t, doc.Updated, "T")
+
+				title = doc.Title
+				entryTitle = doc.Entries[0].Title
+				entryBody = doc.Entries[0].Content.Body
+				entryID = doc.Entries[0].ID
+			} else {
+				var doc rssFeed
+				err := xml.Unmarshal([]byte(body), &doc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(doc.Channel.Items) != 1 {
+					t.Fatalf("got %d items; want 1", len(doc.Channel.Items))
+				}
+
+				assert.Equal(t, doc.Version, "2.0")
+
+				title = doc.Channel.Title
+				entryTitle = doc.Channel.Items[0].Title
+				entryBody = doc.Channel.Items[0].Description
+				entryID = doc.Channel.Items[0].GUID.Value
+			}
+
+			assert.Equal(t, title, tt.wantTitle)
+			assert.Equal(t, entryTitle, tt.wantEntryTitle)
+			assert.Equal(t, entryBody, tt.wantEntryBody)
+
+			// The entry ID must be the same every time the feed is fetched.
+			_, _, again := ts.get(t, tt.urlPath)
+			assert.StringContains(t, again, entryID)
+		})
+	}
+}
+
+// TestFeedAlternateLinks checks that each feed links to the HTML page which
+// lists the same snippets.
+func TestFeedAlternateLinks(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		urlPath string
+		want    string
+	}{
+		{"Latest", "/feed", "/"},
+		{"User", "/user/1/feed", "/user/1"},
+		{"Tag", "/tag/runbook/feed", "/tag/runbook"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, body := ts.get(t, tt.urlPath+".atom")
+
+			var atom atomFeed
+			err := xml.Unmarshal([]byte(body), &atom)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var alternate string
+			for _, link := range atom.Links {
+				if link.Rel == "alternate" {
+					alternate = link.Href
+				}
+			}
+			assert.Equal(t, alternate, ts.URL+tt.want)
+
+			_, _, body = ts.get(t, tt.urlPath+".rss")
+
+			var rss rssFeed
+			err = xml.Unmarshal([]byte(body), &rss)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, rss.Channel.Link, ts.URL+tt.want)
+		})
+	}
+}
+
+func TestFeedContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet models.Snippet
+		want    string
+	}{
+		{
+			name:    "Content only",
+			snippet: models.Snippet{Content: "An old silent pond..."},
+			want:    "An old silent pond...",
+		},
+		{
+			name: "Files only",
+			snippet: models.Snippet{Files: []models.SnippetFile{
+				{Name: "main.go", Content: "package main\n"},
+				{Name: "go.mod", Content: "module repro"},
+			}},
+			want: "==> main.go <==\npackage main\n\n==> go.mod <==\nmodule repro",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, feedContent(tt.snippet), tt.want)
+		})
+	}
+}
+
+// TestFeedEntryIDs checks that the IDs of feed entries use the configured
+// host name, and don't change with the host name that the feed was fetched
+// from.
+func TestFeedEntryIDs(t *testing.T) {
+	f := &feed{snippets: []models.Snippet{
+		{ID: 1, Title: "An old silent Pond", Created: time.Date(2024, 3, 17, 6, 15, 0, 0, time.UTC)},
+	}}
+
+	app := &application{}
+	assert.Equal(t, app.feedIDHost(), defaultFeedHost)
+
+	app.feedHost = "snippets.example.org"
+	want := "tag:snippets.example.org,2024-03-17:snippet/1"
+
+	for _, host := range []string{"localhost:4000", "snippets.example.net"} {
+		r := httptest.NewRequest(http.MethodGet, "/feed.atom", nil)
+		r.Host = host
+
+		atom := f.atom(r, app.feedIDHost()).(atomFeed)
+		assert.Equal(t, atom.Entries[0].ID, want)
+
+		rss := f.rss(r, app.feedIDHost()).(rssFeed)
+		assert.Equal(t, rss.Channel.Items[0].GUID.Value, want)
+		assert.Equal(t, rss.Channel.Items[0].GUID.IsPermaLink, false)
+		assert.Equal(t, rss.Channel.Items[0].Link, "http://"+host+"/snippet/view/1")
+	}
+}
+
+// TestTagFeedEmpty checks that a valid tag which no snippets have still has
+// a feed, which is empty.
+func TestTagFeedEmpty(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.get(t, "/tag/nosuchtag/feed.atom")
+	assert.Equal(t, code, http.StatusOK)
+	wellFormedXML(t, body)
+
+	var doc atomFeed
+	err := xml.Unmarshal([]byte(body), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, doc.Title, "Snippets tagged nosuchtag - Snippetbox")
+	assert.Equal(t, len(doc.Entries), 0)
+
+	// There's nothing to say when an empty feed last changed, so it has no
+	// Last-Modified header, but it still needs a sensible <updated> time.
+	assert.Equal(t, header.Get("Last-Modified"), "")
+
+	updated, err := time.Parse(time.RFC3339, doc.Updated)
+	assert.NilError(t, err)
+	if updated.Year() < 2024 {
+		t.Errorf("got <updated> %q; want the current time", doc.Updated)
+	}
+}
+
+// TestFeedUpdated checks that feeds use the time that snippets were last
+// edited, rather than when they were created.
+func TestFeedUpdated(t *testing.T) {
+	f := &feed{snippets: []models.Snippet{
+		{
+			ID:      2,
+			Title:   "Frog",
+			Created: time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC),
+			Updated: time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:      1,
+			Title:   "An old silent Pond",
+			Created: time.Date(2024, 3, 17, 6, 15, 0, 0, time.UTC),
+			Updated: time.Date(2024, 3, 19, 12, 30, 0, 0, time.UTC),
+		},
+	}}
+
+	assert.Equal(t, f.updated(), time.Date(2024, 3, 19, 12, 30, 0, 0, time.UTC))
+
+	r := httptest.NewRequest(http.MethodGet, "/feed.atom", nil)
+
+	atom := f.atom(r, defaultFeedHost).(atomFeed)
+	assert.Equal(t, atom.Updated, "2024-03-19T12:30:00Z")
+	assert.Equal(t, atom.Entries[0].Updated, "2024-03-18T09:00:00Z")
+	assert.Equal(t, atom.Entries[1].Updated, "2024-03-19T12:30:00Z")
+
+	rss := f.rss(r, defaultFeedHost).(rssFeed)
+	assert.Equal(t, rss.Channel.LastBuildDate, "Tue, 19 Mar 2024 12:30:00 +0000")
+
+	// The publication date of an RSS item is still when it was created.
+	assert.Equal(t, rss.Channel.Items[1].PubDate, "Sun, 17 Mar 2024 06:15:00 +0000")
+}
+
+func TestFeedConditionalRequests(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, _ := ts.get(t, "/feed.atom")
+	assert.Equal(t, code, http.StatusOK)
+
+	etag := header.Get("ETag")
+	lastModified := header.Get("Last-Modified")
+
+	if etag == "" || lastModified == "" {
+		t.Fatalf("got ETag %q and Last-Modified %q; want both to be set", etag, lastModified)
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		value    string
+		wantCode int
+	}{
+		{"Matching ETag", "If-None-Match", etag, http.StatusNotModified},
+		{"Stale ETag", "If-None-Match", `"stale"`, http.StatusOK},
+		{"Not modified since", "If-Modified-Since", lastModified, http.StatusNotModified},
+		{"Modified since", "If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(tt.header, tt.value)
+
+			code, _, body := ts.do(t, http.MethodGet, "/feed.atom", h, nil)
+
+			assert.Equal(t, code, tt.wantCode)
+			if code == http.StatusNotModified {
+				assert.Equal(t, body, "")
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"snippetbox.example.com/internal/markdown"
+	"snippetbox.example.com/internal/models"
+	"snippetbox.example.com/internal/validator"
+)
+
+// A snippet can have up to maxSnippetFiles files, and its content and files
+// together can be up to maxSnippetSize bytes.
+const (
+	maxSnippetFiles = 10
+	maxSnippetSize  = 512 * 1024
+)
+
+// The snippetFileForm struct holds one of the files in a snippetCreateForm.
+// In the HTML form its fields are named like "files[0].name".
+type snippetFileForm struct {
+	Name     string `form:"name" json:"name"`
+	Language string `form:"language" json:"language"`
+	Content  string `form:"content" json:"content"`
+}
+
+// The validateFiles() method checks the files in a snippet. Files which have
+// been left completely empty are dropped first, so that it doesn't matter if
+// the "Add file" button is pressed one time too many, or if removing a file
+// with JavaScript leaves a gap in the numbering.
+//
+// Errors for a file's fields are recorded against keys like "files.0.name",
+// and errors about the files as a whole against "files".
+func (form *snippetCreateForm) validateFiles() {
+	for i := range form.Files {
+		form.Files[i].Name = strings.TrimSpace(form.Files[i].Name)
+		form.Files[i].Language = strings.TrimSpace(form.Files[i].Language)
+	}
+	form.Files = slices.DeleteFunc(form.Files, func(f snippetFileForm) bool {
+		return f.Name == "" && f.Language == "" && f.Content == ""
+	})
+
+	form.CheckField(len(form.Files) <= maxSnippetFiles, "files", "validation.max_files", maxSnippetFiles)
+
+	size := len(form.Content)
+	names := make(map[string]bool)
+
+	for i, f := range form.Files {
+		nameKey := fmt.Sprintf("files.%d.name", i)
+		form.CheckField(validator.NotBlank(f.Name), nameKey, "validation.blank")
+		form.CheckField(validator.MaxChars(f.Name, 100), nameKey, "validation.max_chars", 100)
+		form.CheckField(validator.Matches(f.Name, validator.FileNameRX), nameKey, "validation.file_name")
+		form.CheckField(!names[f.Name], nameKey, "validation.file_name_taken")
+		names[f.Name] = true
+
+		languageKey := fmt.Sprintf("files.%d.language", i)
+		form.CheckField(f.Language == "" || markdown.KnownLanguage(f.Language), languageKey, "validation.language")
+		form.CheckField(validator.MaxChars(f.Language, 50), languageKey, "validation.max_chars", 50)
+
+		form.CheckField(validator.NotBlank(f.Content), fmt.Sprintf("files.%d.content", i), "validation.blank")
+		size += len(f.Content)
+	}
+
+	form.CheckField(size <= maxSnippetSize, "files", "validation.snippet_size", maxSnippetSize/1024)
+}
+
+// The editFiles() method carries out the "Add file" and "Remove" buttons on
+// the create snippet page. Without JavaScript these submit the whole form,
+// and the page is shown again with the file added or removed.
+func (form *snippetCreateForm) editFiles() {
+	if form.RemoveFile != nil {
+		i := *form.RemoveFile
+		if i >= 0 && i < len(form.Files) {
+			form.Files = slices.Delete(form.Files, i, i+1)
+		}
+	}
+
+	if form.AddFile && len(form.Files) < maxSnippetFiles {
+		form.Files = append(form.Files, snippetFileForm{})
+	}
+}
+
+// The snippetFiles() method returns the files in the form, ready to be
+// saved.
+func (form *snippetCreateForm) snippetFiles() []models.SnippetFile {
+	var files []models.SnippetFile
+	for _, f := range form.Files {
+		files = append(files, models.SnippetFile{Name: f.Name, Language: f.Language, Content: f.Content})
+	}
+	return files
+}
+
+// The readSnippet() helper fetches the snippet whose ID is in the URL,
+// sending an error page and returning ok=false if it can't.
+func (app *application) readSnippet(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return models.Snippet{}, false
+	}
+
+	snippet, err = app.snippets.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// The snippetRaw handler sends one of a snippet's files as plain text. The
+// file name in the URL has been unescaped by the time we see it, so names
+// with spaces or other special characters work as they should.
+func (app *application) snippetRaw(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	i := slices.IndexFunc(snippet.Files, func(f models.SnippetFile) bool {
+		return f.Name == r.PathValue("name")
+	})
+	if i == -1 {
+		app.notFound(w, r)
+		return
+	}
+	f := snippet.Files[i]
+
+	// The file is always sent as text/plain, whatever it contains, and the
+	// X-Content-Type-Options header set by commonHeaders stops browsers from
+	// deciding that it's really HTML.
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": f.Name}))
+	w.Write([]byte(f.Content))
+}
+
+// The snippetDownload handler sends all of a snippet's files as a zip file.
+// The zip file is built in memory, which is fine because snippets are limited
+// to maxSnippetSize, and means that we can still send an error page if
+// something goes wrong.
+func (app *application) snippetDownload(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.readSnippet(w, r)
+	if !ok {
+		return
+	}
+
+	if len(snippet.Files) == 0 {
+		app.notFound(w, r)
+		return
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, f := range snippet.Files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.Name,
+			Method:   zip.Deflate,
+			Modified: snippet.Created,
+		})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		_, err = fw.Write([]byte(f.Content))
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err := zw.Close()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	filename := fmt.Sprintf("snippet-%d.zip", snippet.ID)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
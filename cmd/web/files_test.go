@@ -0,0 +1,281 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestSnippetFiles(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The files are shown in order, highlighted using the language worked out
+	// from their names, with links to their raw contents and to the zip file.
+	code, _, body := ts.get(t, "/snippet/view/5")
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, body, "<strong>main.go</strong>")
+	assert.StringContains(t, body, `<span class="kd">func</span>`)
+	assert.StringContains(t, body, "<a href='/snippet/raw/5/notes%20%3C1%3E.txt'>Raw</a>")
+	assert.StringContains(t, body, "<a href='/snippet/download/5'>Download all files as .zip</a>")
+	if strings.Index(body, "main.go") > strings.Index(body, "go.mod") {
+		t.Errorf("got main.go after go.mod; want the files in order")
+	}
+	if strings.Contains(body, "<script>alert") {
+		t.Errorf("got %q; want no <script> element", body)
+	}
+
+	// A snippet without any files doesn't link to a zip file.
+	_, _, body = ts.get(t, "/snippet/view/1")
+	if strings.Contains(body, "/snippet/download/") {
+		t.Errorf("got %q; want no download link", body)
+	}
+}
+
+func TestSnippetRaw(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name            string
+		urlPath         string
+		wantCode        int
+		wantBody        string
+		wantDisposition string
+	}{
+		{
+			name:            "Valid file",
+			urlPath:         "/snippet/raw/5/go.mod",
+			wantCode:        http.StatusOK,
+			wantBody:        "module repro\n\ngo 1.23",
+			wantDisposition: "inline; filename=go.mod",
+		},
+		{
+			name:            "Escaped name",
+			urlPath:         "/snippet/raw/5/notes%20%3C1%3E.txt",
+			wantCode:        http.StatusOK,
+			wantBody:        "</pre><script>alert(1)</script>",
+			wantDisposition: `inline; filename="notes <1>.txt"`,
+		},
+		{
+			name:     "Non-existent file",
+			urlPath:  "/snippet/raw/5/main.rs",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "Non-existent snippet",
+			urlPath:  "/snippet/raw/2/main.go",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "String ID",
+			urlPath:  "/snippet/raw/foo/main.go",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+
+			if tt.wantCode == http.StatusOK {
+				assert.Equal(t, body, tt.wantBody)
+				assert.Equal(t, header.Get("Content-Type"), "text/plain; charset=utf-8")
+				assert.Equal(t, header.Get("Content-Disposition"), tt.wantDisposition)
+				assert.Equal(t, header.Get("X-Content-Type-Options"), "nosniff")
+			}
+		})
+	}
+}
+
+func TestSnippetDownload(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, header, body := ts.get(t, "/snippet/download/5")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, header.Get("Content-Type"), "application/zip")
+	assert.Equal(t, header.Get("Content-Disposition"), "attachment; filename=snippet-5.zip")
+
+	zr, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	assert.NilError(t, err)
+
+	wantFiles := []string{"main.go", "go.mod", "notes <1>.txt"}
+	assert.Equal(t, len(zr.File), len(wantFiles))
+
+	for i, f := range zr.File {
+		assert.Equal(t, f.Name, wantFiles[i])
+	}
+
+	rc, err := zr.File[1].Open()
+	assert.NilError(t, err)
+	defer rc.Close()
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, rc)
+	assert.NilError(t, err)
+	assert.Equal(t, buf.String(), "module repro\n\ngo 1.23\n")
+
+	// Snippets without files, and snippets which don't exist, have no zip
+	// file.
+	code, _, _ = ts.get(t, "/snippet/download/1")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	code, _, _ = ts.get(t, "/snippet/download/2")
+	assert.Equal(t, code, http.StatusNotFound)
+}
+
+func TestSnippetCreateFiles(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.login(t)
+
+	_, _, body := ts.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		content      string
+		files        [][3]string
+		extra        url.Values
+		wantCode     int
+		wantLocation string
+		wantBody     []string
+		notWantBody  string
+	}{
+		{
+			name:         "Files only",
+			files:        [][3]string{{"main.go", "", "package main"}, {"go.mod", "", "module repro"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/2",
+		},
+		{
+			name:         "Empty files dropped",
+			content:      "Run it",
+			files:        [][3]string{{"", "", ""}, {"main.go", "go", "package main"}},
+			wantCode:     http.StatusSeeOther,
+			wantLocation: "/snippet/view/2",
+		},
+		{
+			name:     "Add file",
+			files:    [][3]string{{"main.go", "", "package main"}},
+			extra:    url.Values{"add_file": {"true"}},
+			wantCode: http.StatusOK,
+			wantBody: []string{"value='main.go'", "name='files[1].name' value=''", "data-next-file='2'"},
+		},
+		{
+			name:        "Remove file",
+			files:       [][3]string{{"main.go", "", "package main"}, {"go.mod", "", "module repro"}},
+			extra:       url.Values{"remove_file": {"0"}},
+			wantCode:    http.StatusOK,
+			wantBody:    []string{"name='files[0].name' value='go.mod'", "data-next-file='1'"},
+			notWantBody: "value='main.go'",
+		},
+		{
+			name:     "No content or files",
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"This field cannot be blank"},
+		},
+		{
+			name:     "Duplicate names",
+			files:    [][3]string{{"main.go", "", "package main"}, {"main.go", "", "package main"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"Another file already has this name"},
+		},
+		{
+			name:     "Slash in name",
+			files:    [][3]string{{"cmd/main.go", "", "package main"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"This field cannot contain slashes or control characters"},
+		},
+		{
+			name:     "Dots name",
+			files:    [][3]string{{"..", "", "package main"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"This field cannot contain slashes or control characters"},
+		},
+		{
+			name:     "Unknown language",
+			files:    [][3]string{{"main.go", "nosuchlanguage", "package main"}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"This field must be a language name, like go or yaml"},
+		},
+		{
+			name:     "Blank file content",
+			files:    [][3]string{{"main.go", "", ""}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"This field cannot be blank"},
+		},
+		{
+			name:     "Too many files",
+			files:    manyFiles(maxSnippetFiles + 1),
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"A snippet cannot have more than 10 files"},
+		},
+		{
+			name:     "Too big",
+			files:    [][3]string{{"big.txt", "", strings.Repeat("a", maxSnippetSize+1)}},
+			wantCode: http.StatusUnprocessableEntity,
+			wantBody: []string{"A snippet cannot be more than 512 KB in total"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("title", "Nil map panic")
+			form.Add("content", tt.content)
+			form.Add("expires", "7")
+			form.Add("csrf_token", csrfToken)
+			for i, f := range tt.files {
+				form.Add(fileField(i, "name"), f[0])
+				form.Add(fileField(i, "language"), f[1])
+				form.Add(fileField(i, "content"), f[2])
+			}
+			for k, v := range tt.extra {
+				form[k] = v
+			}
+
+			code, header, body := ts.postForm(t, "/snippet/create", form)
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Location"), tt.wantLocation)
+
+			for _, want := range tt.wantBody {
+				assert.StringContains(t, body, want)
+			}
+			if tt.notWantBody != "" && strings.Contains(body, tt.notWantBody) {
+				t.Errorf("got body containing %q", tt.notWantBody)
+			}
+		})
+	}
+}
+
+// The fileField() helper returns the name of a file's field in the create
+// snippet form, like "files[0].name".
+func fileField(i int, field string) string {
+	return "files[" + strconv.Itoa(i) + "]." + field
+}
+
+// The manyFiles() helper returns n valid files with different names.
+func manyFiles(n int) [][3]string {
+	var files [][3]string
+	for i := range n {
+		files = append(files, [3]string{"file" + strconv.Itoa(i) + ".txt", "", "x"})
+	}
+	return files
+}
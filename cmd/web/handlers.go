@@ -1,18 +1,23 @@
 package main
 
 import (
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"unicode"
 
 	"snippetbox.example.com/internal/models"
+	"snippetbox.example.com/internal/oidc"
 	"snippetbox.example.com/internal/validator"
 )
 
 func (app *application) home(w http.ResponseWriter, r *http.Request) {
 
-	snippets, err := app.snippets.Latest()
+	snippets, err := app.snippets.Latest(r.Context())
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -30,27 +35,162 @@ func (app *application) home(w http.ResponseWriter, r *http.Request) {
 func (app *application) snippetView(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil || id < 1 {
-		http.NotFound(w, r)
+		app.notFound(w, r)
 		return
 	}
-	snippet, err := app.snippets.Get(id)
+	snippet, err := app.snippets.Get(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
-			http.NotFound(w, r)
+			app.notFound(w, r)
 		} else {
 			app.serverError(w, r, err)
 		}
 		return
 	}
+	// If the snippet is a fork, check whether the original is still around
+	// before linking to it. It may have expired or been deleted since.
+	parentAvailable := false
+	if snippet.ForkedFrom != 0 {
+		_, err = app.snippets.Get(r.Context(), snippet.ForkedFrom)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		parentAvailable = err == nil
+	}
+
+	forkCount, err := app.snippets.ForkCount(r.Context(), snippet.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	// added code to helper function to automatically load "flash" banner when
 	// templateData is initially created.
 	data := app.newTemplateData(r)
 	data.Snippet = snippet
+	data.ParentAvailable = parentAvailable
+	data.ForkCount = forkCount
 
 	// Use the new render helper
 	app.render(w, r, http.StatusOK, "view.tmpl", data)
 }
 
+// The latestByUser() helper returns the user whose ID is in the request path
+// and their latest snippets. Users who don't exist or have been disabled are
+// treated as not found. It's shared by the user's page and feeds.
+func (app *application) latestByUser(r *http.Request) (models.User, []models.Snippet, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		return models.User{}, nil, models.ErrNoRecord
+	}
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+	if user.Disabled {
+		return models.User{}, nil, models.ErrNoRecord
+	}
+
+	snippets, err := app.snippets.LatestByUser(r.Context(), id)
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	return user, snippets, nil
+}
+
+// The latestByTag() helper returns the tag whose name is in the request path
+// and the latest snippets with that tag. Tags are always stored in lowercase,
+// so a name which isn't a valid tag (including one with capital letters in
+// it) is treated as not found, but any valid tag is found, even if no
+// snippets have it. It's shared by the tag's page and feeds.
+func (app *application) latestByTag(r *http.Request) (string, []models.Snippet, error) {
+	tag := r.PathValue("tag")
+	if !validator.Matches(tag, validator.TagRX) || !validator.MaxChars(tag, 30) {
+		return "", nil, models.ErrNoRecord
+	}
+
+	snippets, err := app.snippets.LatestByTag(r.Context(), tag)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tag, snippets, nil
+}
+
+// The userView handler shows a user's latest snippets, with links to the
+// feeds of them.
+func (app *application) userView(w http.ResponseWriter, r *http.Request) {
+	user, snippets, err := app.latestByUser(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Heading = app.i18n.Catalog(data.Locale).T("list.by_user", user.Name)
+	data.FeedPath = fmt.Sprintf("/user/%d/feed", user.ID)
+
+	app.render(w, r, http.StatusOK, "list.tmpl", data)
+}
+
+// The tagView handler shows the latest snippets with a tag, with links to the
+// feeds of them.
+func (app *application) tagView(w http.ResponseWriter, r *http.Request) {
+	tag, snippets, err := app.latestByTag(r)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Snippets = snippets
+	data.Heading = app.i18n.Catalog(data.Locale).T("list.tagged", tag)
+	data.FeedPath = fmt.Sprintf("/tag/%s/feed", tag)
+
+	app.render(w, r, http.StatusOK, "list.tmpl", data)
+}
+
+// Forks are kept for a year, the longest that any snippet can be kept for,
+// because there's nowhere to choose an expiry time when forking.
+const forkExpires = 365
+
+// The snippetFork handler copies a snippet, with its files, into a new
+// snippet owned by the logged-in user, and redirects to the copy. Anybody
+// can fork any snippet they can see, including their own.
+func (app *application) snippetFork(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	forkID, err := app.snippets.Fork(r.Context(), id, app.authenticatedUserID(r), forkExpires)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "flash.snippet_forked")
+
+	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", forkID), http.StatusSeeOther)
+}
+
 func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 
@@ -59,6 +199,7 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 	// 'initial' values for the form --- here we set the initial value for the
 	// snippet expiry to 365 days.
 	data.Form = snippetCreateForm{
+		Format:  models.FormatCode,
 		Expires: 365,
 	}
 
@@ -70,11 +211,81 @@ func (app *application) snippetCreate(w http.ResponseWriter, r *http.Request) {
 // example, here we're telling the decoder to store the value from the HTML form
 // input with the name "title" in the Title field. The struct tag `form:"-"`
 // tells the decoder to completely ignore a field during decoding.
+//
+// The same struct is used to decode JSON requests to the API, which is what
+// the json struct tags are for. The HTML form sends the tags as a single
+// string, like "go, http", which ends up as the only item in Tags, while the
+// API can send a list. The Tab, AddFile and RemoveFile fields are
+// only used by the HTML form: Tab says whether the editor or the preview
+// should be shown, and the other two are set by the buttons for adding and
+// removing files.
 type snippetCreateForm struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
-	validator.Validator `form:"expires"`
+	Title               string            `form:"title" json:"title"`
+	Content             string            `form:"content" json:"content"`
+	Format              string            `form:"format" json:"format"`
+	Files               []snippetFileForm `form:"files" json:"files"`
+	Tags                []string          `form:"tags" json:"tags"`
+	Expires             int               `form:"expires" json:"expires"`
+	Tab                 string            `form:"tab" json:"-"`
+	AddFile             bool              `form:"add_file" json:"-"`
+	RemoveFile          *int              `form:"remove_file" json:"-"`
+	validator.Validator `form:"-" json:"-"`
+}
+
+// The validate() method checks the form fields, recording any problems in the
+// embedded Validator. It is shared by the HTML form and the JSON API so that
+// both apply exactly the same rules.
+//
+// The format is optional, and defaults to code, which is how snippets were
+// always shown before there was a choice.
+func (form *snippetCreateForm) validate() {
+	if form.Format == "" {
+		form.Format = models.FormatCode
+	}
+
+	form.validateContent()
+	form.validateExpires()
+}
+
+// The content can be left blank if the snippet has some files instead.
+func (form *snippetCreateForm) validateContent() {
+	form.CheckField(validator.NotBlank(form.Title), "title", "validation.blank")
+	form.CheckField(validator.MaxChars(form.Title, 100), "title", "validation.max_chars", 100)
+	form.validateFiles()
+	form.CheckField(validator.NotBlank(form.Content) || len(form.Files) > 0, "content", "validation.blank")
+	form.validateFormat()
+	form.validateTags()
+}
+
+func (form *snippetCreateForm) validateFormat() {
+	form.CheckField(validator.PermittedValue(form.Format, models.FormatPlain, models.FormatCode, models.FormatMarkdown), "format", "validation.snippet_format")
+}
+
+// A snippet can have up to maxSnippetTags tags.
+const maxSnippetTags = 10
+
+// The validateTags() method splits the tags on commas and spaces, and tidies
+// them up into a sorted list of unique lowercase tags, which is how they're
+// stored. Then it checks them.
+func (form *snippetCreateForm) validateTags() {
+	var tags []string
+	for _, t := range form.Tags {
+		tags = append(tags, strings.FieldsFunc(strings.ToLower(t), func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})...)
+	}
+	slices.Sort(tags)
+	form.Tags = slices.Compact(tags)
+
+	form.CheckField(len(form.Tags) <= maxSnippetTags, "tags", "validation.max_tags", maxSnippetTags)
+	for _, tag := range form.Tags {
+		form.CheckField(validator.MaxChars(tag, 30), "tags", "validation.max_chars", 30)
+		form.CheckField(validator.Matches(tag, validator.TagRX), "tags", "validation.tag")
+	}
+}
+
+func (form *snippetCreateForm) validateExpires() {
+	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "validation.snippet_expires")
 }
 
 func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request) {
@@ -82,14 +293,22 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	// If one of the buttons for adding or removing a file was used, show the
+	// form again with the change made, rather than publishing the snippet.
+	if form.AddFile || form.RemoveFile != nil {
+		form.editFiles()
+
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusOK, "create.tmpl", data)
 		return
 	}
 
-	form.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
-	form.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannot be more than 100 characters long")
-	form.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
-	form.CheckField(validator.PermittedValue(form.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+	form.validate()
 
 	// Use the Valid() method to see if any of the checks failed.
 	if !form.Valid() {
@@ -100,18 +319,51 @@ func (app *application) snippetCreatePost(w http.ResponseWriter, r *http.Request
 	}
 
 	// Pass the data to the SnippetModel.Insert() method, returning the ID of the new record
-	id, err := app.snippets.Insert(form.Title, form.Content, form.Expires)
+	id, err := app.snippets.Insert(r.Context(), app.authenticatedUserID(r), form.Title, form.Content, form.Format, form.snippetFiles(), form.Tags, form.Expires)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 	// Use the Put() method to add a string value and corresponding key to the session data.
-	app.sessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
+	app.sessionManager.Put(r.Context(), "flash", "flash.snippet_created")
 
 	// Redirect the user to the relevant page for the snippet.
 	http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
 }
 
+// The snippetPreviewPost handler is used by the Write and Preview tabs on the
+// create snippet page. Both tabs submit the whole form here, and we show it
+// again on the chosen tab, so that nothing that has been typed is lost. The
+// preview is rendered in exactly the same way as the snippet page, so it's
+// as safe as that is.
+func (app *application) snippetPreviewPost(w http.ResponseWriter, r *http.Request) {
+	var form snippetCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if form.Tab != "preview" {
+		form.Tab = "write"
+	}
+
+	// Only the format matters for the preview. The other fields are checked
+	// when the snippet is published.
+	form.validateFormat()
+
+	status := http.StatusOK
+	if !form.Valid() {
+		form.Tab = "write"
+		status = http.StatusUnprocessableEntity
+	}
+
+	data := app.newTemplateData(r)
+	data.Form = form
+	app.render(w, r, status, "create.tmpl", data)
+}
+
 // Create a new userSignupForm struct.
 type userSignupForm struct {
 	Name                string `form:"name"`
@@ -133,16 +385,16 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 	// Parse the form data into the userSignupForm struct
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 	// Validate the form contents user our helpers.
-	form.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+	form.CheckField(validator.NotBlank(form.Name), "name", "validation.blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "validation.blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "validation.email")
 
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+	form.CheckField(validator.NotBlank(form.Password), "password", "validation.blank")
+	form.CheckField(validator.MinChars(form.Password, 8), "password", "validation.min_chars", 8)
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
@@ -151,10 +403,10 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Try to create a new user record in the database.
-	err = app.users.Insert(form.Name, form.Email, form.Password)
+	err = app.users.Insert(r.Context(), form.Name, form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrDuplicateEmail) {
-			form.AddFieldError("email", "Email address already in use")
+			form.AddFieldError("email", "validation.email_in_use")
 
 			data := app.newTemplateData(r)
 			data.Form = form
@@ -167,7 +419,7 @@ func (app *application) userSignupPost(w http.ResponseWriter, r *http.Request) {
 
 	// Otherwise add a confirmation flash message to the session confirming that
 	// their signup worked.
-	app.sessionManager.Put(r.Context(), "flash", "Your signup was successful.  Please log in.")
+	app.sessionManager.Put(r.Context(), "flash", "flash.signup")
 
 	// and redirect the user to the login page.
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
@@ -183,6 +435,7 @@ type userLoginForm struct {
 func (app *application) userLogin(w http.ResponseWriter, r *http.Request) {
 	data := app.newTemplateData(r)
 	data.Form = userLoginForm{}
+	data.OIDCEnabled = app.oidc != nil
 	app.render(w, r, http.StatusOK, "login.tmpl", data)
 
 	fmt.Fprintln(w, "Display a form for logging in a user...")
@@ -194,15 +447,15 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	err := app.decodePostForm(r, &form)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
 
 	// Check that both the email and password are provided and
 	// check the email format incase of a user typo mistake.
-	form.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
-	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
-	form.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+	form.CheckField(validator.NotBlank(form.Email), "email", "validation.blank")
+	form.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "validation.email")
+	form.CheckField(validator.NotBlank(form.Password), "password", "validation.blank")
 
 	if !form.Valid() {
 		data := app.newTemplateData(r)
@@ -213,10 +466,10 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 
 	// Check whether the credential are valid. If they are not we add a generic
 	// non-field error and re-display the login page
-	id, err := app.users.Authenticate(form.Email, form.Password)
+	id, err := app.users.Authenticate(r.Context(), form.Email, form.Password)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidCredentials) {
-			form.AddNonFieldError("Email or password is incorrect")
+			form.AddNonFieldError("validation.credentials")
 
 			data := app.newTemplateData(r)
 			data.Form = form
@@ -227,27 +480,170 @@ func (app *application) userLoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Use the RenewToken() method on the current session to change the session ID.
-	// It is good practice to generate a new session ID when the authentication
-	// state or privilege levels change for the user.
-	err = app.sessionManager.RenewToken(r.Context())
+	// Log the user in and send them on to the next page.
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.redirectAfterLogin(w, r)
+}
+
+func (app *application) userLoginOIDC(w http.ResponseWriter, r *http.Request) {
+	// Single sign-on is only available if an identity provider is configured.
+	if app.oidc == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	// Generate the state (to protect the callback against CSRF), the nonce
+	// (to tie the ID token to this login attempt) and the PKCE code verifier,
+	// and keep them in the session until the user comes back to us.
+	state, err := oidc.RandomString()
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "oidcState", state)
+	app.sessionManager.Put(r.Context(), "oidcNonce", nonce)
+	app.sessionManager.Put(r.Context(), "oidcVerifier", verifier)
+
+	http.Redirect(w, r, app.oidc.AuthCodeURL(state, nonce, verifier), http.StatusSeeOther)
+}
+
+func (app *application) userLoginOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	// Pop the values we stored when the login started, so that they can only
+	// ever be used once.
+	state := app.sessionManager.PopString(r.Context(), "oidcState")
+	nonce := app.sessionManager.PopString(r.Context(), "oidcNonce")
+	verifier := app.sessionManager.PopString(r.Context(), "oidcVerifier")
+
+	query := r.URL.Query()
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	// If the provider sent back an error (for example, because the user
+	// refused consent) then send the user back to the normal login page.
+	if query.Get("error") != "" {
+		app.sessionManager.Put(r.Context(), "flash", "flash.oidc_failed")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	rawIDToken, err := app.oidc.Exchange(r.Context(), query.Get("code"), verifier)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	claims, err := app.oidc.Verify(r.Context(), rawIDToken, nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidToken) || errors.Is(err, oidc.ErrNonceMismatch) {
+			app.logger.WarnContext(r.Context(), "rejected id token", "error", err)
+			app.clientError(w, r, http.StatusBadRequest)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// If the user is already logged in, then they're linking the identity to
+	// their account, which shows that they control both. That's only allowed
+	// from a browser session, like the other account management pages.
+	if app.isAuthenticated(r) {
+		if app.isTokenAuthenticated(r) {
+			app.clientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		err = app.users.LinkExternal(r.Context(), app.authenticatedUserID(r), claims.Issuer, claims.Subject)
+		if err != nil {
+			if errors.Is(err, models.ErrDuplicateIdentity) {
+				app.sessionManager.Put(r.Context(), "flash", "flash.oidc_in_use")
+				http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		app.sessionManager.Put(r.Context(), "flash", "flash.oidc_linked")
+		http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+		return
+	}
+
+	// We only trust email addresses which the provider has verified, because
+	// a new account is created with the email address.
+	if claims.Email == "" || !claims.EmailVerified {
+		app.sessionManager.Put(r.Context(), "flash", "flash.oidc_unverified")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	// Disabled users can't log in this way either. They get the same message
+	// as for any other failed single sign-on, so that it doesn't give away
+	// whether the account exists. If there's already an account with the
+	// same email address, its owner has to log in and link the identity to
+	// it first.
+	id, err := app.users.AuthenticateExternal(r.Context(), claims.Issuer, claims.Subject, name, claims.Email)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			app.sessionManager.Put(r.Context(), "flash", "flash.oidc_failed")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else if errors.Is(err, models.ErrLinkRequired) {
+			app.sessionManager.Put(r.Context(), "flash", "flash.oidc_link_required")
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
 
-	// Add the ID of the current user to the session, so that they are now
-	// 'logged in".
-	app.sessionManager.Put(r.Context(), "authenticatedUserID", id)
+	err = app.logIn(r, id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 
-	// redirect the user to the create snipped page.
-	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+	app.redirectAfterLogin(w, r)
 }
 
 func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
+	// Stop tracking the current session, as it is about to be thrown away.
+	err := app.sessions.DeleteToken(r.Context(), app.sessionManager.Token(r.Context()))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	// Use the RenewToken() method on the current session to change the session
 	// ID again.
-	err := app.sessionManager.RenewToken(r.Context())
+	err = app.sessionManager.RenewToken(r.Context())
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -259,12 +655,491 @@ func (app *application) userLogoutPost(w http.ResponseWriter, r *http.Request) {
 
 	// Add a flash message to the session to confirm to the user that they've been
 	// logged out.
-	app.sessionManager.Put(r.Context(), "flash", "You've been logged out successfully!")
+	app.sessionManager.Put(r.Context(), "flash", "flash.logged_out")
 
 	// Redirect the user to the application home page.
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// Create a languageForm struct to hold the choice from the language menu at
+// the bottom of every page, and the page to go back to afterwards.
+type languageForm struct {
+	Language string `form:"language"`
+	Next     string `form:"next"`
+}
+
+func (app *application) languagePost(w http.ResponseWriter, r *http.Request) {
+	var form languageForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if !slices.Contains(app.i18n.Locales(), form.Language) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	// Remember the choice for the rest of the session and, if the user is
+	// logged in, for all their future sessions too.
+	app.sessionManager.Put(r.Context(), "language", form.Language)
+
+	if app.isAuthenticated(r) {
+		err = app.users.SetLanguage(r.Context(), app.authenticatedUserID(r), form.Language)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "flash.language")
+
+	// Send the user back to the page they were on, checking that it's
+	// really a page on this site first.
+	if !isSafeRedirectPath(form.Next) {
+		form.Next = "/"
+	}
+	http.Redirect(w, r, form.Next, http.StatusSeeOther)
+}
+
+// The timezonePost handler is called once by the JavaScript in main.js, with
+// the timezone that the browser is in, so that times can be shown in it. A
+// logged-in user who hasn't picked a timezone gets it saved on their account,
+// but one they've chosen themselves is never overwritten.
+func (app *application) timezonePost(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	timezone := r.PostForm.Get("timezone")
+	if !validTimezone(timezone) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "timezone", timezone)
+
+	if app.isAuthenticated(r) {
+		userTimezone, _ := r.Context().Value(userTimezoneContextKey).(string)
+		if userTimezone == "" {
+			err = app.users.SetTimezone(r.Context(), app.authenticatedUserID(r), timezone)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create a timezoneForm struct for the form on the account timezone page.
+type timezoneForm struct {
+	Timezone            string `form:"timezone"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountTimezone(w http.ResponseWriter, r *http.Request) {
+	loc, _ := app.viewerTimezone(r)
+
+	data := app.newTemplateData(r)
+	data.Form = timezoneForm{Timezone: loc.String()}
+
+	app.render(w, r, http.StatusOK, "timezone.tmpl", data)
+}
+
+func (app *application) accountTimezonePost(w http.ResponseWriter, r *http.Request) {
+	var form timezoneForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.Timezone = strings.TrimSpace(form.Timezone)
+	form.CheckField(validTimezone(form.Timezone), "timezone", "validation.timezone")
+
+	if !form.Valid() {
+		data := app.newTemplateData(r)
+		data.Form = form
+		app.render(w, r, http.StatusUnprocessableEntity, "timezone.tmpl", data)
+		return
+	}
+
+	err = app.users.SetTimezone(r.Context(), app.authenticatedUserID(r), form.Timezone)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "timezone", form.Timezone)
+	app.sessionManager.Put(r.Context(), "flash", "flash.timezone")
+
+	http.Redirect(w, r, "/account/timezone", http.StatusSeeOther)
+}
+
 func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
+
+func (app *application) accountSessions(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	sessions, err := app.sessions.All(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Sessions = sessions
+	data.OIDCEnabled = app.oidc != nil
+
+	// Work out which of the sessions is the one making this request, so that
+	// the template can label it.
+	token := app.sessionManager.Token(r.Context())
+	for _, s := range sessions {
+		if s.Token == token {
+			data.CurrentSession = s.ID
+		}
+	}
+
+	app.render(w, r, http.StatusOK, "sessions.tmpl", data)
+}
+
+func (app *application) accountSessionRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	userID := app.authenticatedUserID(r)
+
+	// Delete the session metadata. This only succeeds if the session belongs
+	// to the current user, so users can't revoke each other's sessions.
+	token, err := app.sessions.Delete(r.Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// If the user has revoked the session that they are currently using then
+	// treat it exactly the same as logging out.
+	if token == app.sessionManager.Token(r.Context()) {
+		err = app.sessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+		app.sessionManager.Put(r.Context(), "flash", "flash.logged_out")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// Otherwise delete the session from the session store, which logs out
+	// whoever is using it.
+	err = app.sessionManager.Store.Delete(token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "flash.session_revoked")
+
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+func (app *application) accountSessionRevokeAllPost(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUserID(r)
+
+	tokens, err := app.sessions.DeleteAll(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Delete every other session from the session store. The current session
+	// is dealt with below by renewing its token, in the same way as logging
+	// out, so that it isn't written back to the store when this request ends.
+	current := app.sessionManager.Token(r.Context())
+	for _, token := range tokens {
+		if token == current {
+			continue
+		}
+		err = app.sessionManager.Store.Delete(token)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.sessionManager.Remove(r.Context(), "authenticatedUserID")
+	app.sessionManager.Put(r.Context(), "flash", "flash.logged_out_everywhere")
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// Create a tokenCreateForm struct to hold the form data for a new personal
+// access token.
+type tokenCreateForm struct {
+	Name                string `form:"name"`
+	Scope               string `form:"scope"`
+	Expires             int    `form:"expires"`
+	validator.Validator `form:"-"`
+}
+
+func (app *application) accountTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.tokens.All(r.Context(), app.authenticatedUserID(r))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	data.Form = tokenCreateForm{
+		Scope:   models.ScopeRead,
+		Expires: 30,
+	}
+
+	app.render(w, r, http.StatusOK, "tokens.tmpl", data)
+}
+
+func (app *application) accountTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	var form tokenCreateForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form.CheckField(validator.NotBlank(form.Name), "name", "validation.blank")
+	form.CheckField(validator.MaxChars(form.Name, 100), "name", "validation.max_chars", 100)
+	form.CheckField(validator.PermittedValue(form.Scope, models.ScopeRead, models.ScopeWrite), "scope", "validation.token_scope")
+	form.CheckField(validator.PermittedValue(form.Expires, 7, 30, 90, 365), "expires", "validation.token_expires")
+
+	userID := app.authenticatedUserID(r)
+
+	status := http.StatusCreated
+	var plaintext string
+
+	if form.Valid() {
+		plaintext, err = app.tokens.Insert(r.Context(), userID, form.Name, form.Scope, form.Expires)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		// Reset the form ready for the next token.
+		form = tokenCreateForm{Scope: models.ScopeRead, Expires: 30}
+	} else {
+		status = http.StatusUnprocessableEntity
+	}
+
+	tokens, err := app.tokens.All(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Note that we render the page directly here rather than redirecting, so
+	// that the plain-text token is shown exactly once and never has to be
+	// stored anywhere (not even briefly in the session).
+	data := app.newTemplateData(r)
+	data.Tokens = tokens
+	data.NewToken = plaintext
+	data.Form = form
+
+	app.render(w, r, status, "tokens.tmpl", data)
+}
+
+func (app *application) accountTokenRevokePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.tokens.Delete(r.Context(), app.authenticatedUserID(r), id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "flash.token_revoked")
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+func (app *application) adminUsers(w http.ResponseWriter, r *http.Request) {
+	search := r.URL.Query().Get("q")
+
+	users, err := app.users.Search(r.Context(), search)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.Users = users
+	data.Search = search
+
+	app.render(w, r, http.StatusOK, "admin.tmpl", data)
+}
+
+// The adminTargetUserID helper reads the ID of the user that an admin action
+// applies to from the URL. Admins aren't allowed to change their own account
+// through the admin area, so that they can't accidentally lock themselves
+// out. If the ID isn't usable, a response is sent and ok is false.
+func (app *application) adminTargetUserID(w http.ResponseWriter, r *http.Request) (id int, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return 0, false
+	}
+
+	if id == app.authenticatedUserID(r) {
+		app.sessionManager.Put(r.Context(), "flash", "flash.own_account")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return 0, false
+	}
+
+	return id, true
+}
+
+func (app *application) adminUserDisablePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetDisabled(w, r, true)
+}
+
+func (app *application) adminUserEnablePost(w http.ResponseWriter, r *http.Request) {
+	app.adminSetDisabled(w, r, false)
+}
+
+func (app *application) adminSetDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, ok := app.adminTargetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	action, flash := "user.enable", "flash.user_enabled"
+	if disabled {
+		action, flash = "user.disable", "flash.user_disabled"
+	}
+
+	// The change and its audit entry are saved in one transaction, so that
+	// there's never one without the other.
+	audit := &models.AuditEntry{ActorID: app.authenticatedUserID(r), Action: action, Target: fmt.Sprintf("user:%d", id)}
+
+	err := app.users.SetDisabled(r.Context(), id, disabled, audit)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", flash)
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// Create an adminUserRoleForm struct to hold the new role for a user.
+type adminUserRoleForm struct {
+	Role string `form:"role"`
+}
+
+func (app *application) adminUserRolePost(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.adminTargetUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var form adminUserRoleForm
+
+	err := app.decodePostForm(r, &form)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	if !validator.PermittedValue(form.Role, models.RoleUser, models.RoleModerator, models.RoleAdmin) {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	audit := &models.AuditEntry{ActorID: app.authenticatedUserID(r), Action: "user.role", Target: fmt.Sprintf("user:%d", id), Detail: form.Role}
+
+	err = app.users.SetRole(r.Context(), id, form.Role, audit)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "flash.role_updated")
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+func (app *application) adminSnippetDeletePost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	audit := &models.AuditEntry{ActorID: app.authenticatedUserID(r), Action: "snippet.delete", Target: fmt.Sprintf("snippet:%d", id)}
+
+	err = app.snippets.Delete(r.Context(), id, audit)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.sessionManager.Put(r.Context(), "flash", "flash.snippet_deleted")
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (app *application) adminAudit(w http.ResponseWriter, r *http.Request) {
+	entries, err := app.audit.Latest(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := app.newTemplateData(r)
+	data.AuditEntries = entries
+
+	app.render(w, r, http.StatusOK, "audit.tmpl", data)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// The pinger interface is satisfied by *sql.DB. It lets the readiness check
+// test the database connection without the rest of the application needing
+// direct access to the connection pool.
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// The readinessTimeout is how long each readiness check may take. Load
+// balancers poll frequently, so it's better for a slow dependency to fail the
+// check than for the checks to pile up.
+const readinessTimeout = 2 * time.Second
+
+// The healthz handler reports that the process is alive and able to serve
+// requests. It deliberately doesn't check anything else: if the database is
+// down, restarting the application won't fix it.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK"))
+}
+
+// The readyz handler reports whether the application is ready to receive
+// traffic, with a JSON breakdown of each check, like:
+//
+//	{"status": "unavailable", "checks": {"database": "failed", "draining": "ok", ...}}
+//
+// If any check fails it responds with 503 Service Unavailable, so that load
+// balancers stop sending requests here until it recovers. Anybody can fetch
+// this endpoint, so a failed check is only reported as "failed" (or
+// "draining" while the server shuts down), and the error itself, which might
+// include things like the database address, goes to the log instead.
+func (app *application) readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]error{
+		"database":      app.checkDatabase(r.Context()),
+		"session_store": app.checkSessionStore(r.Context()),
+		"templates":     app.checkTemplates(),
+		"draining":      app.checkDraining(),
+	}
+
+	status := http.StatusOK
+	results := map[string]string{}
+
+	for name, err := range checks {
+		switch {
+		case err == nil:
+			results[name] = "ok"
+		case name == "draining":
+			// Shutting down is expected, so there's nothing to log.
+			status = http.StatusServiceUnavailable
+			results[name] = "draining"
+		default:
+			status = http.StatusServiceUnavailable
+			results[name] = "failed"
+			app.logger.ErrorContext(r.Context(), "readiness check failed", "check", name, "error", err)
+		}
+	}
+
+	data := envelope{"status": "ok", "checks": results}
+	if status != http.StatusOK {
+		data["status"] = "unavailable"
+	}
+
+	err := app.writeJSON(w, status, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) checkDatabase(ctx context.Context) error {
+	if app.db == nil {
+		return errors.New("no database configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	return app.db.PingContext(ctx)
+}
+
+// The checkSessionStore() method looks up a session token which can't exist,
+// which is enough to show that the store can be reached.
+func (app *application) checkSessionStore(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	var err error
+	if cs, ok := app.sessionManager.Store.(scs.CtxStore); ok {
+		_, _, err = cs.FindCtx(ctx, "readyz")
+	} else {
+		_, _, err = app.sessionManager.Store.Find("readyz")
+	}
+	return err
+}
+
+func (app *application) checkTemplates() error {
+	if app.dev != nil {
+		_, err := app.dev.templates()
+		return err
+	}
+	if _, ok := app.templateCache[app.i18n.DefaultLocale()]["home.tmpl"]; !ok {
+		return errors.New("template cache not loaded")
+	}
+	return nil
+}
+
+func (app *application) checkDraining() error {
+	if app.draining.Load() {
+		return errors.New("server is shutting down")
+	}
+	return nil
+}
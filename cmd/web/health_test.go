@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/internal/models/mocks"
+)
+
+func TestHealthz(t *testing.T) {
+	app := newTestApplication(t)
+	app.db = &mocks.DB{Err: errors.New("connection refused")}
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// The liveness check passes even though the database is down.
+	code, _, body := ts.get(t, "/healthz")
+
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body, "OK")
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(app *application)
+		wantCode   int
+		wantStatus string
+		wantChecks map[string]string
+	}{
+		{
+			name:       "Ready",
+			setup:      func(app *application) {},
+			wantCode:   http.StatusOK,
+			wantStatus: "ok",
+			wantChecks: map[string]string{"database": "ok", "session_store": "ok", "templates": "ok", "draining": "ok"},
+		},
+		{
+			name: "Database down",
+			setup: func(app *application) {
+				app.db = &mocks.DB{Err: errors.New("connection refused")}
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "unavailable",
+			wantChecks: map[string]string{"database": "failed", "session_store": "ok", "templates": "ok", "draining": "ok"},
+		},
+		{
+			name: "Templates not loaded",
+			setup: func(app *application) {
+				app.templateCache = nil
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "unavailable",
+			wantChecks: map[string]string{"database": "ok", "session_store": "ok", "templates": "failed", "draining": "ok"},
+		},
+		{
+			name: "Draining",
+			setup: func(app *application) {
+				app.draining.Store(true)
+			},
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: "unavailable",
+			wantChecks: map[string]string{"database": "ok", "session_store": "ok", "templates": "ok", "draining": "draining"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			tt.setup(app)
+
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			code, header, body := ts.get(t, "/readyz")
+
+			assert.Equal(t, code, tt.wantCode)
+			assert.Equal(t, header.Get("Content-Type"), "application/json")
+
+			var data struct {
+				Status string            `json:"status"`
+				Checks map[string]string `json:"checks"`
+			}
+			err := json.Unmarshal([]byte(body), &data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, data.Status, tt.wantStatus)
+			assert.Equal(t, len(data.Checks), len(tt.wantChecks))
+			for name, want := range tt.wantChecks {
+				assert.Equal(t, data.Checks[name], want)
+			}
+
+			// The errors themselves go to the log, not the response.
+			for _, text := range []string{"connection refused", "template cache", "shutting down"} {
+				if strings.Contains(body, text) {
+					t.Errorf("got %q; want no error text in the response", body)
+				}
+			}
+		})
+	}
+}
+
+func TestServeGracefulShutdown(t *testing.T) {
+	app := newTestApplication(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: app.routes()}
+	url := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- app.serve(ctx, srv, func() error { return srv.Serve(ln) }, 200*time.Millisecond)
+	}()
+
+	get := func(path string) int {
+		rs, err := http.Get(url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs.Body.Close()
+		return rs.StatusCode
+	}
+
+	assert.Equal(t, get("/readyz"), http.StatusOK)
+
+	// Once the shutdown signal arrives, the server keeps serving requests for
+	// the drain delay, but reports that it is no longer ready.
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, get("/readyz"), http.StatusServiceUnavailable)
+	assert.Equal(t, get("/healthz"), http.StatusOK)
+
+	select {
+	case err := <-done:
+		assert.NilError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+
+	_, err = http.Get(url + "/healthz")
+	if err == nil {
+		t.Error("got nil error; want connection error after shutdown")
+	}
+}
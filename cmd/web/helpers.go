@@ -4,17 +4,23 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-playground/form/v4"
 	"github.com/justinas/nosurf"
+	"snippetbox.example.com/internal/models"
 )
 
 // The ServerError helper writes a log entry at Error level (including the request
 // method and URI attributes), then sends a generic 500 internal Server Error
-// response to the user.
+// response to the user. The error page includes the request ID, so that the
+// user can quote it when reporting the problem.
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	var (
 		method = r.Method
@@ -22,23 +28,60 @@ func (app *application) serverError(w http.ResponseWriter, r *http.Request, err
 		trace  = string(debug.Stack()) // Convert stack trace from a []byte to String
 	)
 
-	app.logger.Error(err.Error(), "method", method, "uri", uri, "trace", trace)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	app.logger.ErrorContext(r.Context(), err.Error(), "method", method, "uri", uri, "trace", trace)
+	app.errorResponse(w, r, http.StatusInternalServerError)
 }
 
 // The clientError help sends a specific status code and corresponding description
 // to the user. We'll use this later in the book to send responses like 400 "Bad
 // request" when there's a problem with the request that the user sent.
-func (app *application) clientError(w http.ResponseWriter, status int) {
-	http.Error(w, http.StatusText(status), status)
+func (app *application) clientError(w http.ResponseWriter, r *http.Request, status int) {
+	app.errorResponse(w, r, status)
+}
+
+// The invalidTokenResponse helper sends a 401 Unauthorized response with a
+// WWW-Authenticate header, for requests with a missing or bad bearer token.
+func (app *application) invalidTokenResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	if isAPIRequest(r) {
+		app.errorJSON(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+		return
+	}
+	app.clientError(w, r, http.StatusUnauthorized)
+}
+
+// The insufficientScopeResponse helper sends a 403 Forbidden response for
+// requests whose token doesn't have the scope needed.
+func (app *application) insufficientScopeResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+	if isAPIRequest(r) {
+		app.errorJSON(w, r, http.StatusForbidden, "your token does not have the scope needed for this request")
+		return
+	}
+	app.clientError(w, r, http.StatusForbidden)
 }
 
 func (app *application) render(w http.ResponseWriter, r *http.Request, status int, page string, data templateData) {
+	// In development mode the templates come from disk instead of the cache,
+	// and are parsed again if they have changed. Errors are shown in detail
+	// in the browser.
+	templateCache := app.templateCache
+	if app.dev != nil {
+		var err error
+		templateCache, err = app.dev.templates()
+		if err != nil {
+			app.devTemplateError(w, r, page, err)
+			return
+		}
+	}
+
 	// Retrieve the appropriate template set from the cache based on the page
 	// name (like 'home.tmpl'). If no entry exists in the cache with the
 	// provided name, then create a new error and call the serverError() helper
-	// method that we made earlier and return.
-	ts, ok := app.templateCache[page]
+	// method that we made earlier and return. Each locale has its own copy of
+	// the templates, so that the T function translates into the right
+	// language.
+	ts, ok := templateCache[data.Locale][page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
 		app.serverError(w, r, err)
@@ -51,11 +94,19 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 	// Write the template to the buffer, instead of straight to the
 	// http.ResponseWriter. If there's an error, call our serverError() helper.
 	// and then return.
+	_, span := app.tracer.Start(r.Context(), "render "+page)
+	start := time.Now()
 	err := ts.ExecuteTemplate(buf, "base", data)
+	span.End()
+	if err != nil && app.dev != nil {
+		app.devTemplateError(w, r, page, err)
+		return
+	}
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	app.metrics.renderDuration.Observe(time.Since(start).Seconds(), page)
 
 	// If the template is written to the buffer without any errors, we are safe
 	// to do ahead and write the HTTP status code to http.ResponseWriter.
@@ -69,15 +120,52 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, status in
 
 // Creates a newTemplateData helper, which returns a pointer to a templateData
 // struct initialised with the current year.
+//
+// Flash messages are stored in the session as message keys, like
+// "flash.snippet_created", and translated here into the language that the
+// page is being shown in.
 func (app *application) newTemplateData(r *http.Request) templateData {
+	locale := app.locale(r)
+
+	flash := app.popFlash(r)
+	if flash != "" {
+		flash = app.i18n.Catalog(locale).T(flash)
+	}
+
+	timezone, detectTimezone := app.viewerTimezone(r)
+
 	return templateData{
 		CurrentYear:     time.Now().Year(),
-		Flash:           app.sessionManager.PopString(r.Context(), "flash"),
+		Flash:           flash,
 		IsAuthenticated: app.isAuthenticated(r),
 		CSRFToken:       nosurf.Token(r),
+		IsModerator:     app.hasRole(r, models.RoleModerator, models.RoleAdmin),
+		IsAdmin:         app.hasRole(r, models.RoleAdmin),
+		Locale:          locale,
+		Languages:       app.languageOptions(),
+		CurrentPath:     r.URL.RequestURI(),
+		Timezone:        timezone,
+		DetectTimezone:  detectTimezone,
 	}
 }
 
+// The popFlash() helper returns the flash message from the session and removes
+// it. Error pages can be rendered for requests which never had a session
+// loaded, like feed requests, so in that case it just returns "".
+func (app *application) popFlash(r *http.Request) string {
+	if !sessionLoaded(r) {
+		return ""
+	}
+	return app.sessionManager.PopString(r.Context(), "flash")
+}
+
+// Returns true if the loadSession middleware has loaded the session for the
+// current request, so that it's safe to use the session manager.
+func sessionLoaded(r *http.Request) bool {
+	loaded, _ := r.Context().Value(sessionLoadedContextKey).(bool)
+	return loaded
+}
+
 // Create a new decodePostForm() helper method. The second parameter here, dst
 // is the target destination that we want to decode the form data into.
 func (app *application) decodePostForm(r *http.Request, dst any) error {
@@ -115,3 +203,122 @@ func (app *application) isAuthenticated(r *http.Request) bool {
 	}
 	return isAuthenticated
 }
+
+// Returns true if the current request was authenticated with a personal
+// access token rather than a session cookie.
+func (app *application) isTokenAuthenticated(r *http.Request) bool {
+	isTokenAuthenticated, ok := r.Context().Value(isTokenAuthenticatedContextKey).(bool)
+	if !ok {
+		return false
+	}
+	return isTokenAuthenticated
+}
+
+// Returns the ID of the authenticated user making the current request, or 0
+// if the request is not authenticated.
+func (app *application) authenticatedUserID(r *http.Request) int {
+	id, ok := r.Context().Value(authenticatedUserIDContextKey).(int)
+	if !ok {
+		return 0
+	}
+	return id
+}
+
+// Returns true if the current request is from an authenticated user with one
+// of the given roles.
+func (app *application) hasRole(r *http.Request, roles ...string) bool {
+	role, ok := r.Context().Value(userRoleContextKey).(string)
+	if !ok {
+		return false
+	}
+	return slices.Contains(roles, role)
+}
+
+// Returns the IP address of the client which made the request, without the
+// port number.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// Returns true if path is a relative path on this site which is safe to use
+// as a redirect target. Anything that a browser could interpret as pointing
+// at a different origin (like "//evil.com" or "/\evil.com") is rejected.
+func isSafeRedirectPath(path string) bool {
+	// The path must be rooted, and must not start with "//" or "/\" which
+	// browsers treat as a protocol-relative URL.
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return false
+	}
+
+	// Browsers silently strip tabs and newlines from URLs, so "/\t/evil.com"
+	// would become "//evil.com". Reject any control characters outright.
+	if strings.ContainsFunc(path, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return false
+	}
+
+	// Finally make sure that the path parses without a scheme or host.
+	u, err := url.Parse(path)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" && u.Host == ""
+}
+
+// The logIn helper starts an authenticated session for a user, and records
+// the session against them so that it shows up on their account page.
+func (app *application) logIn(r *http.Request, userID int) error {
+	// Use the RenewToken() method on the current session to change the session ID.
+	// It is good practice to generate a new session ID when the authentication
+	// state or privilege levels change for the user.
+	err := app.sessionManager.RenewToken(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// Add the ID of the current user to the session, so that they are now
+	// 'logged in".
+	app.sessionManager.Put(r.Context(), "authenticatedUserID", userID)
+
+	token := app.sessionManager.Token(r.Context())
+	deadline := app.sessionManager.Deadline(r.Context())
+	userAgent := truncate(r.UserAgent(), 255)
+
+	return app.sessions.Insert(r.Context(), userID, token, clientIP(r), userAgent, deadline)
+}
+
+// The truncate helper shortens s to at most n characters, to fit in a
+// VARCHAR(n) column. MySQL counts characters rather than bytes, and rejects
+// strings which aren't valid UTF-8, so we replace any invalid bytes first and
+// never cut a multi-byte character in half.
+func truncate(s string, n int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+
+	count := 0
+	for i := range s {
+		if count == n {
+			return s[:i]
+		}
+		count++
+	}
+	return s
+}
+
+// The redirectAfterLogin helper sends a user who has just logged in on to the
+// next page.
+func (app *application) redirectAfterLogin(w http.ResponseWriter, r *http.Request) {
+	// If the user was bounced to the login page from a protected page, send
+	// them back to where they were. The stored path is checked before we use
+	// it so that it can never point at another site.
+	path := app.sessionManager.PopString(r.Context(), "redirectPathAfterLogin")
+	if isSafeRedirectPath(path) {
+		http.Redirect(w, r, path, http.StatusSeeOther)
+		return
+	}
+
+	// Otherwise redirect the user to the create snippet page.
+	http.Redirect(w, r, "/snippet/create", http.StatusSeeOther)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestIsSafeRedirectPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{name: "Root", path: "/", want: true},
+		{name: "Relative path", path: "/snippet/create", want: true},
+		{name: "With query", path: "/snippet/view/1?x=//evil.com", want: true},
+		{name: "Empty", path: "", want: false},
+		{name: "Absolute URL", path: "https://evil.com/", want: false},
+		{name: "Scheme relative", path: "//evil.com", want: false},
+		{name: "Backslash", path: "/\\evil.com", want: false},
+		{name: "Embedded tab", path: "/\t/evil.com", want: false},
+		{name: "Embedded newline", path: "/\n/evil.com", want: false},
+		{name: "Javascript URL", path: "javascript:alert(1)", want: false},
+		{name: "No leading slash", path: "evil.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, isSafeRedirectPath(tt.path), tt.want)
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{name: "Short", s: "curl/8.5.0", n: 255, want: "curl/8.5.0"},
+		{name: "ASCII", s: "abcdef", n: 3, want: "abc"},
+		{name: "Multi-byte", s: "ééééé", n: 3, want: "ééé"},
+		{name: "Exact length", s: "日本語", n: 3, want: "日本語"},
+		{name: "Invalid UTF-8", s: "ab\xffcd", n: 4, want: "ab�c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, truncate(tt.s, tt.n), tt.want)
+		})
+	}
+}
+
+// The session recorded when logging in with a long non-ASCII User-Agent must
+// still be valid UTF-8 and fit in the 255 character user_agent column.
+func TestLogInLongUserAgent(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", "alice@example.com")
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", csrfToken)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	header.Set("User-Agent", "Navigateur/1.0 "+strings.Repeat("é", 300))
+
+	code, _, _ := ts.do(t, http.MethodPost, "/user/login", header, strings.NewReader(form.Encode()))
+	assert.Equal(t, code, http.StatusSeeOther)
+
+	sessions, err := app.sessions.All(context.Background(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(sessions), 1)
+
+	userAgent := sessions[0].UserAgent
+	assert.Equal(t, utf8.ValidString(userAgent), true)
+	assert.Equal(t, utf8.RuneCountInString(userAgent), 255)
+	assert.Equal(t, strings.HasPrefix(userAgent, "Navigateur/1.0 éé"), true)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"snippetbox.example.com/internal/i18n"
+	"snippetbox.example.com/internal/validator"
+)
+
+// The locale() helper returns the locale to show a page in. In order, we try
+// the language chosen by the logged-in user, the language chosen earlier in
+// this session, and then the languages in the browser's Accept-Language
+// header. If none of those are supported, it's the default locale.
+func (app *application) locale(r *http.Request) string {
+	userLanguage, _ := r.Context().Value(userLanguageContextKey).(string)
+
+	var sessionLanguage string
+	if sessionLoaded(r) {
+		sessionLanguage = app.sessionManager.GetString(r.Context(), "language")
+	}
+
+	return app.i18n.Match(userLanguage, sessionLanguage, r.Header.Get("Accept-Language"))
+}
+
+// The languageOptions() helper returns the choices for the language menu,
+// with each language named in its own language.
+func (app *application) languageOptions() []languageOption {
+	var options []languageOption
+	for _, locale := range app.i18n.Locales() {
+		options = append(options, languageOption{
+			Locale: locale,
+			Name:   app.i18n.Catalog(locale).T("language.name"),
+		})
+	}
+	return options
+}
+
+// The translate() function returns the T template function for a catalog.
+// It translates a message key, with any arguments that the message needs:
+//
+//	{{T "view.created" (humanDate .Created $.Timezone)}}
+//
+// or a validation error from a form's validator:
+//
+//	{{with .Form.FieldErrors.title}}{{T .}}{{end}}
+func translate(catalog *i18n.Catalog) func(msg any, args ...any) string {
+	return func(msg any, args ...any) string {
+		switch msg := msg.(type) {
+		case string:
+			return catalog.T(msg, args...)
+		case validator.Error:
+			return catalog.T(msg.Key, msg.Args...)
+		case *validator.Error:
+			return catalog.T(msg.Key, msg.Args...)
+		default:
+			return fmt.Sprint(msg)
+		}
+	}
+}
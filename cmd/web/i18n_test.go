@@ -0,0 +1,191 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/ui"
+)
+
+// The TestMessageKeys test checks that every message key used in the templates
+// and in the handlers' validation errors and flash messages is in the default
+// catalog. Otherwise the key itself would be shown on the page.
+func TestMessageKeys(t *testing.T) {
+	app := newTestApplication(t)
+	catalog := app.i18n.Catalog(app.i18n.DefaultLocale())
+
+	templateKey := regexp.MustCompile(`\{\{\s*T\s+"([^"]+)"`)
+	goKey := regexp.MustCompile(`"((?:validation|flash)\.[a-z_]+)"`)
+
+	check := func(name string, src []byte, rx *regexp.Regexp) int {
+		found := 0
+		for _, match := range rx.FindAllSubmatch(src, -1) {
+			found++
+			if key := string(match[1]); !catalog.Has(key) {
+				t.Errorf("%s: unknown message key %q", name, key)
+			}
+		}
+		return found
+	}
+
+	templates, err := fs.Glob(ui.Files, "html/*/*.tmpl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates = append(templates, "html/base.tmpl")
+
+	found := 0
+	for _, name := range templates {
+		src, err := fs.ReadFile(ui.Files, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found += check(name, src, templateKey)
+	}
+
+	sources, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range sources {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found += check(name, src, goKey)
+	}
+
+	if found == 0 {
+		t.Error("found no message keys")
+	}
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		wantLang       string
+		wantBody       string
+	}{
+		{"None", "", "en", "<a href='/user/signup'>Signup</a>"},
+		{"French", "fr-FR,fr;q=0.9,en;q=0.8", "fr", "<a href='/user/signup'>Inscription</a>"},
+		{"English preferred", "en-GB, fr;q=0.5", "en", "<a href='/user/signup'>Signup</a>"},
+		{"Unsupported", "de", "en", "<a href='/user/signup'>Signup</a>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.acceptLanguage != "" {
+				header.Set("Accept-Language", tt.acceptLanguage)
+			}
+
+			code, _, body := ts.do(t, http.MethodGet, "/", header, nil)
+			assert.Equal(t, code, http.StatusOK)
+			assert.StringContains(t, body, "<html lang='"+tt.wantLang+"'>")
+			assert.StringContains(t, body, tt.wantBody)
+		})
+	}
+}
+
+func TestValidationErrorsTranslated(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	french := http.Header{"Accept-Language": {"fr"}}
+
+	_, _, body := ts.do(t, http.MethodGet, "/user/signup", french, nil)
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("name", "")
+	form.Add("email", "bob@example.com")
+	form.Add("password", "short")
+	form.Add("csrf_token", csrfToken)
+
+	header := http.Header{
+		"Accept-Language": {"fr"},
+		"Content-Type":    {"application/x-www-form-urlencoded"},
+	}
+	code, _, body := ts.do(t, http.MethodPost, "/user/signup", header, strings.NewReader(form.Encode()))
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "Ce champ ne peut pas être vide")
+	assert.StringContains(t, body, "Ce champ doit contenir au moins 8 caractères")
+
+	// The JSON API translates its field errors too.
+	code, _, body = ts.do(t, http.MethodGet, "/api/v1/snippets?page=0", french, nil)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, `"page": "Ce champ doit être compris entre 1 et 10000"`)
+}
+
+func TestLanguagePost(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	t.Run("Anonymous", func(t *testing.T) {
+		ts := newTestServer(t, routes)
+		defer ts.Close()
+
+		_, _, body := ts.get(t, "/user/login")
+		csrfToken := extractCSRFToken(t, body)
+
+		tests := []struct {
+			name         string
+			language     string
+			next         string
+			wantCode     int
+			wantLocation string
+		}{
+			{"Unsupported language", "de", "/user/login", http.StatusBadRequest, ""},
+			{"Unsafe next page", "fr", "//example.org", http.StatusSeeOther, "/"},
+			{"Valid", "fr", "/user/login", http.StatusSeeOther, "/user/login"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				form := url.Values{}
+				form.Add("language", tt.language)
+				form.Add("next", tt.next)
+				form.Add("csrf_token", csrfToken)
+
+				code, header, _ := ts.postForm(t, "/language", form)
+				assert.Equal(t, code, tt.wantCode)
+				assert.Equal(t, header.Get("Location"), tt.wantLocation)
+			})
+		}
+
+		// The choice is remembered for the rest of the session, and the
+		// flash message is shown in the new language.
+		_, _, body = ts.get(t, "/user/login")
+		assert.StringContains(t, body, "<html lang='fr'>")
+		assert.StringContains(t, body, "Le site sera désormais affiché en français.")
+	})
+
+	t.Run("User preference", func(t *testing.T) {
+		ts := newTestServer(t, routes)
+		defer ts.Close()
+
+		// Erin has chosen French, which takes priority over the browser's
+		// languages.
+		ts.loginAs(t, "erin@example.com")
+
+		code, _, body := ts.do(t, http.MethodGet, "/", http.Header{"Accept-Language": {"en"}}, nil)
+		assert.Equal(t, code, http.StatusOK)
+		assert.StringContains(t, body, "<button>Déconnexion</button>")
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The newLogger() function creates the application logger. The format can be
+// "text" or "json", and the level is one of the slog level names ("debug",
+// "info", "warn" or "error"). Every log line written with one of the
+// ...Context() methods, using a request's context, includes the request ID.
+func newLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	err := lvl.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q (must be text or json)", format)
+	}
+
+	return slog.New(requestIDHandler{h}), nil
+}
+
+// The requestIDHandler type wraps a slog.Handler, and adds a request_id
+// attribute to any record logged with a context containing a request ID. If
+// the request is part of a trace then the trace_id is added too, so that log
+// lines can be matched up with spans.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id, ok := ctx.Value(requestIDContextKey).(string); ok {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		rec.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+// The validRequestID() helper reports whether a request ID sent by a client
+// (or a proxy in front of us) is safe to reuse. We only accept short IDs made
+// of printable ASCII, so that they can't be used to forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// The requestID middleware gives every request an ID, which is sent back in
+// the X-Request-ID response header and included in every log line written
+// while handling the request. If the request came through one of the trusted
+// proxies and already has a valid X-Request-ID header, from a load balancer
+// for example, then we use that instead so the request can be followed from
+// one system to the next. Anybody else could use the header to make their
+// requests look like somebody else's in the logs, so we ignore it.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !fromTrustedProxy(r) || !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// The requestIDFromContext() helper returns the ID given to the request by the
+// requestID middleware, or "" if there isn't one.
+func requestIDFromContext(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// The isHealthCheck() helper reports whether a request is from a health
+// checker. These arrive every few seconds and would drown out everything else
+// in the access log, so they are only logged at the debug level.
+func isHealthCheck(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/ping", "/healthz", "/readyz":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		level   string
+		wantErr bool
+	}{
+		{name: "Text", format: "text", level: "info"},
+		{name: "JSON", format: "json", level: "debug"},
+		{name: "Upper case level", format: "json", level: "WARN"},
+		{name: "Invalid format", format: "xml", level: "info", wantErr: true},
+		{name: "Invalid level", format: "text", level: "loud", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newLogger(&bytes.Buffer{}, tt.format, tt.level)
+			assert.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"5f0c3a0e-8b5e-4e7a-9a43-5b1d6c2f0e11", true},
+		{"abc123", true},
+		{"", false},
+		{"has space", false},
+		{"new\nline", false},
+		{strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, validRequestID(tt.id), tt.want)
+	}
+}
+
+// The logLines() helper decodes each line of JSON log output.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var m map[string]any
+		err := json.Unmarshal([]byte(line), &m)
+		if err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := newLogger(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication(t)
+	app.logger = logger
+
+	// Trust the test client as a proxy, so that it can set the request ID.
+	app.trustedProxies, _ = parseTrustedProxies("127.0.0.0/8, ::1")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	t.Run("Generated request ID", func(t *testing.T) {
+		buf.Reset()
+
+		// Ask for an uncompressed response, so that the logged size can be
+		// compared with the length of the body.
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/snippet/view/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", "identity")
+
+		rs, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rs.Body.Close()
+
+		body, err := io.ReadAll(rs.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, header := rs.StatusCode, rs.Header
+		assert.Equal(t, code, http.StatusOK)
+
+		id := header.Get("X-Request-ID")
+		assert.Equal(t, len(id), 32)
+
+		lines := logLines(t, &buf)
+		if len(lines) != 1 {
+			t.Fatalf("got %d log lines; want 1", len(lines))
+		}
+
+		assert.Equal(t, lines[0]["msg"], any("handled request"))
+		assert.Equal(t, lines[0]["request_id"], any(id))
+		assert.Equal(t, lines[0]["uri"], any("/snippet/view/1"))
+		assert.Equal(t, lines[0]["status"], any(float64(http.StatusOK)))
+		assert.Equal(t, fmt.Sprint(lines[0]["size"]), fmt.Sprint(len(body)))
+
+		if _, ok := lines[0]["duration"]; !ok {
+			t.Error("log line has no duration")
+		}
+	})
+
+	t.Run("Propagated request ID", func(t *testing.T) {
+		buf.Reset()
+
+		header := http.Header{}
+		header.Set("X-Request-ID", "upstream-1234")
+
+		code, rsHeader, _ := ts.do(t, http.MethodGet, "/snippet/view/99", header, nil)
+		assert.Equal(t, code, http.StatusNotFound)
+		assert.Equal(t, rsHeader.Get("X-Request-ID"), "upstream-1234")
+
+		lines := logLines(t, &buf)
+		assert.Equal(t, lines[len(lines)-1]["request_id"], any("upstream-1234"))
+		assert.Equal(t, lines[len(lines)-1]["status"], any(float64(http.StatusNotFound)))
+	})
+
+	t.Run("Invalid request ID is replaced", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-Request-ID", "no spaces allowed")
+
+		_, rsHeader, _ := ts.do(t, http.MethodGet, "/", header, nil)
+
+		id := rsHeader.Get("X-Request-ID")
+		if id == "" || id == "no spaces allowed" {
+			t.Errorf("got X-Request-ID %q; want a new ID", id)
+		}
+	})
+
+	t.Run("Health checks are not logged", func(t *testing.T) {
+		buf.Reset()
+
+		code, _, _ := ts.get(t, "/ping")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, buf.Len(), 0)
+	})
+}
+
+// TestRequestIDUntrustedClient checks that a client which isn't one of the
+// trusted proxies can't choose its own request ID.
+func TestRequestIDUntrustedClient(t *testing.T) {
+	app := newTestApplication(t)
+	app.trustedProxies, _ = parseTrustedProxies("10.0.0.0/8")
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	header := http.Header{}
+	header.Set("X-Request-ID", "upstream-1234")
+
+	_, rsHeader, _ := ts.do(t, http.MethodGet, "/ping", header, nil)
+
+	id := rsHeader.Get("X-Request-ID")
+	if id == "" || id == "upstream-1234" {
+		t.Errorf("got X-Request-ID %q; want a new ID", id)
+	}
+}
+
+func TestServerErrorLogsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := newLogger(&buf, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newTestApplication(t)
+	app.logger = logger
+	app.trustedProxies, _ = parseTrustedProxies("127.0.0.0/8, ::1")
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	ts := newTestServer(t, app.proxyHeaders(requestID(app.logRequest(app.recoverPanic(next)))))
+	defer ts.Close()
+
+	header := http.Header{}
+	header.Set("X-Request-ID", "abc123")
+
+	code, _, _ := ts.do(t, http.MethodGet, "/", header, nil)
+	assert.Equal(t, code, http.StatusInternalServerError)
+
+	lines := logLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines; want 2", len(lines))
+	}
+
+	// The first line is from serverError() and the second is the access log.
+	assert.Equal(t, lines[0]["msg"], any("oops"))
+	assert.Equal(t, lines[0]["level"], any("ERROR"))
+	assert.Equal(t, lines[0]["request_id"], any("abc123"))
+	assert.Equal(t, lines[1]["request_id"], any("abc123"))
+	assert.Equal(t, lines[1]["status"], any(float64(http.StatusInternalServerError)))
+}
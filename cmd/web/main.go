@@ -1,20 +1,34 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	// Embed the IANA timezone database, so that viewers' timezones can be
+	// loaded even on servers which don't have one installed.
+	_ "time/tzdata"
+
 	"github.com/alexedwards/scs/mysqlstore"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 	_ "github.com/go-sql-driver/mysql"
+	"go.opentelemetry.io/otel/trace"
+	"snippetbox.example.com/internal/i18n"
 	"snippetbox.example.com/internal/models"
+	"snippetbox.example.com/internal/oidc"
+	"snippetbox.example.com/ui"
 )
 
 // Define an application struct to hold the application-wide dependencies for the
@@ -23,18 +37,60 @@ type application struct {
 	logger         *slog.Logger
 	snippets       models.SnippetModelInterface
 	users          models.UserModelInterface
-	templateCache  map[string]*template.Template
+	sessions       models.SessionModelInterface
+	tokens         models.TokenModelInterface
+	audit          models.AuditModelInterface
+	templateCache  map[string]map[string]*template.Template
+	i18n           *i18n.Bundle
 	formDecoder    *form.Decoder
 	sessionManager *scs.SessionManager
+	oidc           *oidc.Provider
+	metrics        *appMetrics
+	tracer         trace.Tracer
+	db             pinger
+	draining       atomic.Bool
+	trustedProxies trustedProxies
+	dev            *devUI
+	feedHost       string
 }
 
 func main() {
 	addr := flag.String("addr", ":4000", "HTTP network address")
+	metricsAddr := flag.String("metrics-addr", "localhost:4001", "HTTP network address for the Prometheus metrics listener (leave blank to disable)")
 	dsn := flag.String("dsn", "web:w3bpassword@/snippetbox?parseTime=true", "MySQL data source name")
+	oidcIssuer := flag.String("oidc-issuer", "", "OpenID Connect issuer URL (leave blank to disable single sign-on)")
+	oidcClientID := flag.String("oidc-client-id", "", "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", os.Getenv("SNIPPETBOX_OIDC_CLIENT_SECRET"), "OpenID Connect client secret")
+	oidcRedirectURL := flag.String("oidc-redirect-url", "https://localhost:4000/user/login/oidc/callback", "OpenID Connect redirect URL")
+	logFormat := flag.String("log-format", "text", "Log format (text or json)")
+	logLevel := flag.String("log-level", "info", "Minimum log level (debug, info, warn or error)")
+	drainDelay := flag.Duration("drain-delay", 5*time.Second, "How long to keep serving after a shutdown signal, while /readyz fails")
+	traceExporter := flag.String("trace-exporter", "none", "OpenTelemetry trace exporter (none, stdout or otlp)")
+	httpAddr := flag.String("http-addr", ":80", "HTTP network address for ACME challenges and redirects to HTTPS (acme mode only)")
+
+	var tlsOpts tlsOptions
+	flag.StringVar(&tlsOpts.mode, "tls-mode", "file", "Where the TLS certificate comes from (file or acme), or off to serve plain HTTP behind a reverse proxy")
+	flag.StringVar(&tlsOpts.certFile, "tls-cert", "./tls/cert.pem", "TLS certificate file (file mode)")
+	flag.StringVar(&tlsOpts.keyFile, "tls-key", "./tls/key.pem", "TLS private key file (file mode)")
+	flag.DurationVar(&tlsOpts.reloadInterval, "tls-reload-interval", 10*time.Second, "How often to check the certificate and key files for changes (file mode)")
+	flag.StringVar(&tlsOpts.acmeHosts, "acme-hosts", "", "Comma-separated host names to obtain certificates for (acme mode)")
+	flag.StringVar(&tlsOpts.acmeCacheDir, "acme-cache-dir", "./tls/acme", "Directory to store ACME certificates and account keys in (acme mode)")
+	flag.StringVar(&tlsOpts.acmeDirectoryURL, "acme-directory-url", "", "ACME directory URL (acme mode; defaults to Let's Encrypt)")
+	flag.StringVar(&tlsOpts.acmeEmail, "acme-email", "", "Contact email address for the ACME account (acme mode)")
+	cacheSize := flag.Int("snippet-cache-size", 1000, "Maximum number of entries in the snippet cache (0 to disable it)")
+	cacheTTL := flag.Duration("snippet-cache-ttl", 30*time.Second, "How long snippets are kept in the cache")
+	dev := flag.Bool("dev", false, "Development mode: read templates and static files from -ui-dir and reload them when they change")
+	uiDir := flag.String("ui-dir", "./ui", "Directory containing the html and static folders (development mode only)")
+	feedHost := flag.String("feed-host", defaultFeedHost, "Host name used in the IDs of feed entries, which must never change once feeds have been published")
+	trustedProxyList := flag.String("trusted-proxies", "", "Comma-separated CIDR ranges of reverse proxies whose forwarding headers are trusted")
 
 	flag.Parse()
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	logger, err := newLogger(os.Stdout, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
 	// To keep the main() function tidy we will use a separate openDB() function
 	db, err := openDB(*dsn)
@@ -45,12 +101,40 @@ func main() {
 
 	defer db.Close()
 
-	// Initialise a new template cache...
-	templateCache, err := NewTemplateCache()
+	// Parse the list of reverse proxies which we trust to tell us the real
+	// client address and scheme.
+	proxies, err := parseTrustedProxies(*trustedProxyList)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
+	if tlsOpts.mode == "off" && len(proxies) == 0 {
+		logger.Warn("serving plain HTTP without any trusted proxies")
+	}
+
+	// Load the message catalogs for each locale. English is the default, used
+	// for anyone whose preferred languages we don't support.
+	bundle, err := i18n.NewBundle(ui.Files, "locales", "en")
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Initialise a new template cache... In development mode the templates
+	// are read from disk when they're needed instead, so that mistakes in them
+	// are shown in the browser rather than stopping the server from starting.
+	var templateCache map[string]map[string]*template.Template
+	var devMode *devUI
+	if *dev {
+		logger.Warn("running in development mode", "ui_dir", *uiDir)
+		devMode = newDevUI(*uiDir, bundle)
+	} else {
+		templateCache, err = NewTemplateCache(bundle)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
 
 	// Use the scs.New() function to initialize a new session manager. Then we
 	// configure it to use our MySQL database as the session store, and set a
@@ -59,20 +143,132 @@ func main() {
 	sessionManager := scs.New()
 	sessionManager.Store = mysqlstore.New(db)
 	sessionManager.Lifetime = 12 * time.Hour
+	// The cookie is always marked Secure here. Behind a trusted proxy, the
+	// proxyHeaders middleware clears the flag for clients using plain HTTP.
 	sessionManager.Cookie.Secure = true
 
+	// If an identity provider has been configured then fetch its discovery
+	// document, so that users can log in with single sign-on.
+	var oidcProvider *oidc.Provider
+	if *oidcIssuer != "" {
+		oidcProvider, err = oidc.NewProvider(context.Background(), oidc.Config{
+			IssuerURL:    *oidcIssuer,
+			ClientID:     *oidcClientID,
+			ClientSecret: *oidcClientSecret,
+			RedirectURL:  *oidcRedirectURL,
+		})
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	app := &application{
 		logger:         logger,
 		snippets:       &models.SnippetModel{DB: db},
 		users:          &models.UserModel{DB: db},
+		sessions:       &models.SessionModel{DB: db},
+		tokens:         &models.TokenModel{DB: db},
+		audit:          &models.AuditModel{DB: db},
 		templateCache:  templateCache,
+		i18n:           bundle,
 		formDecoder:    form.NewDecoder(),
 		sessionManager: sessionManager,
+		oidc:           oidcProvider,
+		metrics:        newAppMetrics(db),
+		db:             db,
+		trustedProxies: proxies,
+		dev:            devMode,
+		feedHost:       *feedHost,
+	}
+
+	// Set up tracing. With the default "none" exporter, the spans are never
+	// recorded and cost next to nothing.
+	tracerProvider, shutdownTracing, err := newTracerProvider(context.Background(), *traceExporter)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	app.enableTracing(tracerProvider)
+
+	// Cache the most frequently read snippets in memory. The cache wraps the
+	// traced model, so only the queries which actually reach the database
+	// show up as spans.
+	if *cacheSize > 0 {
+		cache := models.NewCachedSnippetModel(app.snippets, *cacheSize, *cacheTTL)
+		app.snippets = cache
+		app.metrics.registerSnippetCache(cache)
 	}
+
+	// Count session store errors before reporting them in the usual way.
+	sessionManager.ErrorFunc = app.sessionError
+
+	// Serve the metrics on their own plain HTTP listener, which should only be
+	// reachable by the Prometheus server. By default it only listens on the
+	// loopback interface.
+	if *metricsAddr != "" {
+		metricsSrv := &http.Server{
+			Addr:         *metricsAddr,
+			Handler:      app.metricsRoutes(),
+			ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			logger.Info("starting metrics server", "addr", *metricsAddr)
+			err := metricsSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				logger.Error(err.Error())
+			}
+		}()
+		defer metricsSrv.Close()
+	}
+	// Create a context which is cancelled when the process is asked to stop.
+	// It's used to stop watching the certificate files, and to run the server
+	// until then.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Work out where the certificate comes from. Either way it is served
+	// through GetCertificate(), so that a renewed certificate is used for new
+	// connections without restarting the server.
+	getCertificate, challengeHandler, err := newCertificateSource(ctx, tlsOpts, *addr, logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// In ACME mode the certificate authority checks that we control the host
+	// names by making HTTP requests to port 80, so we need a plain HTTP
+	// listener for those. It redirects any other requests to HTTPS.
+	if challengeHandler != nil {
+		httpSrv := &http.Server{
+			Addr:         *httpAddr,
+			Handler:      challengeHandler,
+			ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			logger.Info("starting HTTP challenge server", "addr", *httpAddr)
+			err := httpSrv.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				logger.Error(err.Error())
+			}
+		}()
+		defer httpSrv.Close()
+	}
+
 	// Initialise a tls.Config struct to hold the non-default TLS settings we
-	// want the server to make.
-	tlsConfig := &tls.Config{
-		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	// want the server to make. There isn't one when TLS is turned off.
+	var tlsConfig *tls.Config
+	if getCertificate != nil {
+		tlsConfig = &tls.Config{
+			CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+			GetCertificate:   getCertificate,
+		}
 	}
 	// Initialise a new http.Server struct. We set the Addr and Handler field so
 	// that the server uses the same network address and routes as before.
@@ -86,13 +282,28 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
-	logger.Info("starting server", "addr", *addr)
+	logger.Info("starting server", "addr", *addr, "tls_mode", tlsOpts.mode)
+
+	// Run the server until the context is cancelled. The serve() method takes
+	// care of draining and shutting down gracefully.
+	err = app.serve(ctx, srv, func() error {
+		if tlsConfig == nil {
+			return srv.ListenAndServe()
+		}
+		// The certificate comes from tlsConfig.GetCertificate, so we don't
+		// pass any file names here.
+		return srv.ListenAndServeTLS("", "")
+	}, *drainDelay)
+
+	// Flush any spans which haven't been exported yet.
+	shutdownTracing(context.Background())
+
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
 
-	// Call the ListenAndServe() method on our new http.Server struct to start
-	// the server.
-	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
-	logger.Error(err.Error())
-	os.Exit(1)
+	logger.Info("stopped server")
 }
 
 // The openDB function wraps sql.Open and returns a sql.DB connection pool
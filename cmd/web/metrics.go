@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippetbox.example.com/internal/metrics"
+	"snippetbox.example.com/internal/models"
+)
+
+// The appMetrics struct holds the metrics which the application records.
+// They are exposed by the metricsRoutes() handler on a separate listener, so
+// that they are never reachable from the public internet.
+type appMetrics struct {
+	registry       *metrics.Registry
+	requests       *metrics.Counter
+	duration       *metrics.Histogram
+	inFlight       *metrics.Gauge
+	panics         *metrics.Counter
+	renderDuration *metrics.Histogram
+	sessionErrors  *metrics.Counter
+}
+
+// The newAppMetrics() function registers the application's metrics. If db
+// isn't nil then the connection pool statistics are reported too.
+func newAppMetrics(db *sql.DB) *appMetrics {
+	reg := metrics.NewRegistry()
+
+	m := &appMetrics{
+		registry: reg,
+		requests: reg.NewCounter("snippetbox_http_requests_total",
+			"Total HTTP requests, by method, route pattern and status code.", "method", "route", "status"),
+		duration: reg.NewHistogram("snippetbox_http_request_duration_seconds",
+			"HTTP request latency, by method and route pattern.", metrics.DefaultBuckets, "method", "route"),
+		inFlight: reg.NewGauge("snippetbox_http_requests_in_flight",
+			"HTTP requests currently being handled."),
+		panics: reg.NewCounter("snippetbox_http_panics_total",
+			"Panics recovered by the recoverPanic middleware."),
+		renderDuration: reg.NewHistogram("snippetbox_template_render_duration_seconds",
+			"Time taken to execute each page template.", []float64{.0005, .001, .0025, .005, .01, .025, .05, .1}, "page"),
+		sessionErrors: reg.NewCounter("snippetbox_session_store_errors_total",
+			"Errors loading or saving sessions in the session store."),
+	}
+
+	if db != nil {
+		stats := func(f func(sql.DBStats) float64) func() float64 {
+			return func() float64 { return f(db.Stats()) }
+		}
+
+		reg.NewGaugeFunc("snippetbox_db_max_open_connections", "Maximum number of open database connections.",
+			stats(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+		reg.NewGaugeFunc("snippetbox_db_open_connections", "Open database connections, both in use and idle.",
+			stats(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+		reg.NewGaugeFunc("snippetbox_db_in_use_connections", "Database connections currently in use.",
+			stats(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+		reg.NewGaugeFunc("snippetbox_db_idle_connections", "Idle database connections.",
+			stats(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+		reg.NewCounterFunc("snippetbox_db_wait_count_total", "Total times a query waited for a free connection.",
+			stats(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+		reg.NewCounterFunc("snippetbox_db_wait_duration_seconds_total", "Total time spent waiting for a free connection.",
+			stats(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+		reg.NewCounterFunc("snippetbox_db_max_idle_closed_total", "Connections closed because of the idle connection limit.",
+			stats(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+		reg.NewCounterFunc("snippetbox_db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+			stats(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+	}
+
+	return m
+}
+
+// The registerSnippetCache() method adds the hit and miss counters of the
+// snippet cache to the registry.
+func (m *appMetrics) registerSnippetCache(cache *models.CachedSnippetModel) {
+	m.registry.NewCounterFunc("snippetbox_snippet_cache_hits_total", "Snippet lookups answered from the cache.",
+		func() float64 { return float64(cache.Stats().Hits) })
+	m.registry.NewCounterFunc("snippetbox_snippet_cache_misses_total", "Snippet lookups which had to query the database.",
+		func() float64 { return float64(cache.Stats().Misses) })
+}
+
+// The metricsRoutes() method returns the handler for the metrics listener.
+func (app *application) metricsRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", app.metrics.registry.Handler())
+	return mux
+}
+
+// The routeLabel() helper returns the route pattern which matched a request,
+// such as "/snippet/view/{id}", for use as a metric label. Using the pattern
+// rather than the URL path keeps the number of distinct label values small,
+// no matter what URLs people request.
+func routeLabel(r *http.Request) string {
+	if r.Pattern == "" {
+		return "unmatched"
+	}
+
+	// Patterns are registered with a method, like "GET /snippet/view/{id}",
+	// but the method has its own label.
+	if _, path, ok := strings.Cut(r.Pattern, " "); ok {
+		return path
+	}
+	return r.Pattern
+}
+
+// The methodLabel() helper returns the request method for use as a metric
+// label. Clients can send any method they like, so anything unusual is
+// reported as "other".
+func methodLabel(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return r.Method
+	default:
+		return "other"
+	}
+}
+
+// The instrument middleware records the count and latency of every request.
+// It must come before recoverPanic so that requests which panic are counted
+// with their 500 status code. It reads r.Pattern after the servemux has set
+// it, so none of the middleware between here and the servemux may replace the
+// request with r.WithContext().
+func (app *application) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		app.metrics.inFlight.Inc()
+		defer app.metrics.inFlight.Dec()
+
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
+
+		method, route := methodLabel(r), routeLabel(r)
+		app.metrics.requests.Inc(method, route, strconv.Itoa(rw.status))
+		app.metrics.duration.Observe(time.Since(start).Seconds(), method, route)
+	})
+}
+
+// The sessionError() method is called by the session manager when the
+// session store returns an error.
+func (app *application) sessionError(w http.ResponseWriter, r *http.Request, err error) {
+	app.metrics.sessionErrors.Inc()
+	app.serverError(w, r, err)
+}
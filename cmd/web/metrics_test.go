@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+// The scrapeMetrics() helper fetches the metrics from the metrics listener's
+// handler, in the same way that Prometheus would.
+func scrapeMetrics(t *testing.T, app *application) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	r, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.metricsRoutes().ServeHTTP(rr, r)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	return rr.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	ts.get(t, "/snippet/view/1")
+	ts.get(t, "/snippet/view/1")
+	ts.get(t, "/snippet/view/99")
+	ts.get(t, "/no/such/page")
+	ts.do(t, "BREW", "/ping", nil, nil)
+
+	body := scrapeMetrics(t, app)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "Requests labelled by route pattern",
+			want: `snippetbox_http_requests_total{method="GET",route="/snippet/view/{id}",status="200"} 2`,
+		},
+		{
+			name: "Requests labelled by status",
+			want: `snippetbox_http_requests_total{method="GET",route="/snippet/view/{id}",status="404"} 1`,
+		},
+		{
+			name: "Unmatched requests",
+			want: `snippetbox_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		},
+		{
+			name: "Unusual methods",
+			want: `snippetbox_http_requests_total{method="other",route="unmatched",status="405"} 1`,
+		},
+		{
+			name: "Latency histogram",
+			want: `snippetbox_http_request_duration_seconds_count{method="GET",route="/snippet/view/{id}"} 3`,
+		},
+		{
+			name: "Nothing in flight",
+			want: "snippetbox_http_requests_in_flight 0\n",
+		},
+		{
+			name: "Template render durations",
+			want: `snippetbox_template_render_duration_seconds_count{page="view.tmpl"} 2`,
+		},
+		{
+			name: "Session store errors",
+			want: "snippetbox_session_store_errors_total 0\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.StringContains(t, body, tt.want)
+		})
+	}
+}
+
+func TestMetricsPanics(t *testing.T) {
+	app := newTestApplication(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops")
+	})
+
+	rr := httptest.NewRecorder()
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.instrument(app.recoverPanic(next)).ServeHTTP(rr, r)
+
+	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+
+	body := scrapeMetrics(t, app)
+	assert.StringContains(t, body, "snippetbox_http_panics_total 1\n")
+	assert.StringContains(t, body, `snippetbox_http_requests_total{method="GET",route="unmatched",status="500"} 1`)
+}
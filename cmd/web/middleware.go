@@ -2,12 +2,52 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/justinas/nosurf"
+	"snippetbox.example.com/internal/models"
 )
 
+// The responseWriter type wraps a http.ResponseWriter so that middleware can
+// find out which status code the handler sent and how many bytes of body it
+// wrote. The Unwrap() method lets http.ResponseController reach the
+// underlying writer, so that flushing and deadlines still work through the
+// wrapper.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	return n, err
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func commonHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com")
@@ -22,18 +62,30 @@ func commonHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// The logRequest middleware writes a line to the access log once the request
+// has been handled, so that it can include the status code, the size of the
+// response body and how long the request took.
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var (
-			ip     = r.RemoteAddr
-			proto  = r.Proto
-			method = r.Method
-			uri    = r.URL.RequestURI()
-		)
-		app.logger.Info("received request", "ip", ip, "proto", proto, "method", method, "uri", uri)
+		start := time.Now()
 
-		next.ServeHTTP(w, r)
+		rw := newResponseWriter(w)
+		next.ServeHTTP(rw, r)
 
+		level := slog.LevelInfo
+		if isHealthCheck(r) {
+			level = slog.LevelDebug
+		}
+
+		app.logger.Log(r.Context(), level, "handled request",
+			"ip", clientIP(r),
+			"proto", r.Proto,
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"status", rw.status,
+			"size", rw.size,
+			"duration", time.Since(start),
+		)
 	})
 }
 
@@ -45,6 +97,8 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 			// Use the builtin recover function to check if there has been a
 			// panic or not.  If there has...
 			if err := recover(); err != nil {
+				app.metrics.panics.Inc()
+
 				// Set a "Connection: close" header on the response.
 				w.Header().Set("Connection", "close")
 				// Call the app.serverError helper method to return a 500
@@ -62,6 +116,13 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 		// return from the middleware chain so that no subsequent handlers in
 		// the chain are executed.
 		if !app.isAuthenticated(r) {
+			// Remember the page that the user was trying to reach, so that we
+			// can send them back there once they have logged in. We only do
+			// this for GET requests, as there is no sensible way to replay
+			// anything else.
+			if r.Method == http.MethodGet {
+				app.sessionManager.Put(r.Context(), "redirectPathAfterLogin", r.URL.RequestURI())
+			}
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
@@ -76,6 +137,50 @@ func (app *application) requireAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// The requireRole() function returns a middleware which only lets through
+// requests from users with one of the given roles. It should be used after
+// requireAuthentication in a middleware chain, for example:
+//
+//	admin := protected.Append(app.requireRole(models.RoleAdmin))
+func (app *application) requireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.hasRole(r, roles...) {
+				app.clientError(w, r, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// The requireSession middleware rejects requests which were authenticated
+// with a personal access token rather than a session cookie. We use it on the
+// account management pages so that a leaked token can't be used to mint more
+// tokens or to revoke the owner's sessions.
+func (app *application) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.isTokenAuthenticated(r) {
+			app.clientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The loadSession middleware loads and saves the session data with the
+// session manager's LoadAndSave() middleware, and records in the request
+// context that it has done so. Code which can run with or without a session,
+// like the error pages, checks for that before using the session.
+func (app *application) loadSession(next http.Handler) http.Handler {
+	return app.sessionManager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), sessionLoadedContextKey, true)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}))
+}
+
 // Create a NoSurf middleware function which uses a customised CSRF cookie with
 // the Secure, Path and HTTPOnly attributes set.
 func noSurf(next http.Handler) http.Handler {
@@ -85,11 +190,45 @@ func noSurf(next http.Handler) http.Handler {
 		Path:     "/",
 		Secure:   true,
 	})
+
+	// Requests which have been authenticated with a bearer token don't need
+	// CSRF protection, because a browser will never attach the Authorization
+	// header to a cross-site request on its own. Note that this relies on the
+	// authenticateToken middleware running before this one.
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		isTokenAuthenticated, _ := r.Context().Value(isTokenAuthenticatedContextKey).(bool)
+		return isTokenAuthenticated
+	})
+	return csrfHandler
+}
+
+// The csrfToken middleware makes the CSRF token available to templates, like
+// noSurf, but doesn't check it on any requests. It's used for the error pages
+// sent for URLs which don't match a route, so that the logout button in the
+// navigation bar still works, while a POST to a URL which doesn't exist gets
+// a 404 rather than a 400 Bad Request.
+func csrfToken(next http.Handler) http.Handler {
+	csrfHandler := nosurf.New(next)
+	csrfHandler.SetBaseCookie(http.Cookie{
+		HttpOnly: true,
+		Path:     "/",
+		Secure:   true,
+	})
+	csrfHandler.ExemptFunc(func(r *http.Request) bool { return true })
 	return csrfHandler
 }
 
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// If the request has already been authenticated with a personal access
+		// token then the token decides who it's from. Any session cookie sent
+		// along with it is ignored, so that it can't replace the token owner's
+		// identity while keeping the token's exemption from CSRF checks.
+		if app.isTokenAuthenticated(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Retrieve the authenticatedUserID value from the session using the
 		// GetInt() method.  This will return the zero value for an int (0) if no
 		// "authenticatedUserId" value is in the session -- in which case we call
@@ -99,21 +238,101 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		// Otherwise we check to see if the user with that ID exists in our database.
-		exists, err := app.users.Exists(id)
+		// Otherwise we look up the user with that ID in our database. If they
+		// no longer exist, we treat the request as unauthenticated.
+		user, err := app.users.Get(r.Context(), id)
 		if err != nil {
-			app.serverError(w, r, err)
+			if errors.Is(err, models.ErrNoRecord) {
+				next.ServeHTTP(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
 			return
 		}
-		// If a matching user is found, we know that the request is
-		// coming from an authenticated user who exists in our database. We
+		// If a matching user is found and their account hasn't been disabled,
+		// we know that the request is coming from an authenticated user. We
 		// create a new copy of the request (with an isAuthenticatedContextKey
-		// value of true in the request context) and assign it to r.
-		if exists {
+		// value of true in the request context) and assign it to r. Disabled
+		// users are treated exactly as if they were logged out.
+		if !user.Disabled {
 			ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+			ctx = context.WithValue(ctx, authenticatedUserIDContextKey, id)
+			ctx = context.WithValue(ctx, userRoleContextKey, user.Role)
+			ctx = context.WithValue(ctx, userLanguageContextKey, user.Language)
+			ctx = context.WithValue(ctx, userTimezoneContextKey, user.Timezone)
 			r = r.WithContext(ctx)
+
+			// Keep the last seen time for the session up to date.
+			err = app.sessions.Touch(r.Context(), app.sessionManager.Token(r.Context()))
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
 		}
 		// Call the next hander in the chain.
 		next.ServeHTTP(w, r)
 	})
 }
+
+func (app *application) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// If there is no Authorization header then this isn't a token request,
+		// so call the next handler in the chain as normal and return.
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Otherwise we expect the header to be in the format "Bearer <token>".
+		// Anything else gets a 401 Unauthorized response.
+		plaintext, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || plaintext == "" {
+			app.invalidTokenResponse(w, r)
+			return
+		}
+
+		token, err := app.tokens.Authenticate(r.Context(), plaintext)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				app.invalidTokenResponse(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		// Make sure that the user who owns the token still exists, and hasn't
+		// been disabled.
+		user, err := app.users.Get(r.Context(), token.UserID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.invalidTokenResponse(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+		if user.Disabled {
+			app.invalidTokenResponse(w, r)
+			return
+		}
+
+		// Tokens with only the read scope may not be used to change anything.
+		if token.Scope != models.ScopeWrite && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			app.insufficientScopeResponse(w, r)
+			return
+		}
+
+		// Mark the request as authenticated in exactly the same way as the
+		// authenticate middleware does for sessions, and also record that a
+		// token was used so that noSurf can skip its checks.
+		ctx := context.WithValue(r.Context(), isAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, authenticatedUserIDContextKey, token.UserID)
+		ctx = context.WithValue(ctx, userRoleContextKey, user.Role)
+		ctx = context.WithValue(ctx, isTokenAuthenticatedContextKey, true)
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/api"
+)
+
+// The openAPISpec type holds just the parts of api/openapi.json which the
+// tests below need. Operations are keyed by path and then by lowercase HTTP
+// method, exactly as they appear in the document.
+type openAPISpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Responses map[string]openAPIResponse `json:"responses"`
+		Schemas   map[string]any             `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema any `json:"schema"`
+	} `json:"content"`
+}
+
+func loadOpenAPISpec(t *testing.T) *openAPISpec {
+	t.Helper()
+
+	b, err := api.Files.ReadFile("openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spec openAPISpec
+	err = json.Unmarshal(b, &spec)
+	if err != nil {
+		t.Fatalf("invalid openapi.json: %v", err)
+	}
+
+	return &spec
+}
+
+// The operation() method looks up the operation for a route pattern like
+// "PATCH /api/v1/snippets/{id}". Conveniently, the OpenAPI path template
+// syntax is the same as the one used by http.ServeMux.
+func (spec *openAPISpec) operation(pattern string) (*openAPIOperation, bool) {
+	method, path, _ := strings.Cut(pattern, " ")
+
+	raw, ok := spec.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return nil, false
+	}
+
+	var op openAPIOperation
+	if err := json.Unmarshal(raw, &op); err != nil {
+		return nil, false
+	}
+
+	return &op, true
+}
+
+// The response() method returns the documented response for a status code,
+// following a reference to a shared response if necessary.
+func (spec *openAPISpec) response(op *openAPIOperation, code int) (openAPIResponse, bool) {
+	rs, ok := op.Responses[strconv.Itoa(code)]
+	if !ok {
+		return rs, false
+	}
+
+	if rs.Ref != "" {
+		rs, ok = spec.Components.Responses[strings.TrimPrefix(rs.Ref, "#/components/responses/")]
+	}
+
+	return rs, ok
+}
+
+// The validate() method checks a decoded JSON value against a schema. It only
+// understands the handful of JSON Schema keywords which openapi.json actually
+// uses, which keeps it small enough to live in a test file rather than
+// pulling in a third-party validator.
+func (spec *openAPISpec) validate(schema any, value any, path string) error {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s: invalid schema %v", path, schema)
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		target, ok := spec.Components.Schemas[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %q", path, ref)
+		}
+		return spec.validate(target, value, path)
+	}
+
+	if typ, ok := s["type"]; ok {
+		var types []string
+		switch typ := typ.(type) {
+		case string:
+			types = []string{typ}
+		case []any:
+			for _, t := range typ {
+				types = append(types, fmt.Sprint(t))
+			}
+		}
+		if !slices.Contains(types, jsonType(value)) &&
+			!(jsonType(value) == "integer" && slices.Contains(types, "number")) {
+			return fmt.Errorf("%s: got %s; want %s", path, jsonType(value), strings.Join(types, " or "))
+		}
+	}
+
+	if enum, ok := s["enum"].([]any); ok && !slices.Contains(enum, value) {
+		return fmt.Errorf("%s: %v is not one of %v", path, value, enum)
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		properties, _ := s["properties"].(map[string]any)
+
+		if required, ok := s["required"].([]any); ok {
+			for _, name := range required {
+				if _, ok := value[name.(string)]; !ok {
+					return fmt.Errorf("%s: missing required property %q", path, name)
+				}
+			}
+		}
+
+		for name, v := range value {
+			if propSchema, ok := properties[name]; ok {
+				if err := spec.validate(propSchema, v, path+"."+name); err != nil {
+					return err
+				}
+				continue
+			}
+
+			switch additional := s["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s: unexpected property %q", path, name)
+				}
+			case map[string]any:
+				if err := spec.validate(additional, v, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if items, ok := s["items"]; ok {
+			for i, v := range value {
+				if err := spec.validate(items, v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func jsonType(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// TestOpenAPIRoutes checks the spec against the application's real servemux,
+// in both directions. Every documented operation must be routed by app.routes()
+// rather than falling through to the servemux's 404 or 405 error, and every
+// other method on a documented path must get a 405. Then every /api/ route
+// pattern in routes.go must be served by the servemux and documented in the
+// spec, which catches routes which are registered outside apiRoutes().
+func TestOpenAPIRoutes(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	spec := loadOpenAPISpec(t)
+
+	methods := []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+	for path, item := range spec.Paths {
+		for _, method := range methods {
+			_, documented := item[strings.ToLower(method)]
+
+			code, _, _ := ts.do(t, method, examplePath(path), nil, nil)
+
+			if documented && (code == http.StatusNotFound || code == http.StatusMethodNotAllowed) {
+				t.Errorf("openapi.json documents %q but the servemux sends %d", method+" "+path, code)
+			}
+			if !documented && code != http.StatusMethodNotAllowed {
+				t.Errorf("%q is not documented in openapi.json but the servemux sends %d", method+" "+path, code)
+			}
+		}
+	}
+
+	for _, pattern := range routePatterns(t, "routes.go") {
+		method, path, _ := strings.Cut(pattern, " ")
+		if !strings.HasPrefix(path, "/api/") {
+			continue
+		}
+
+		code, _, _ := ts.do(t, method, examplePath(path), nil, nil)
+		if code == http.StatusNotFound || code == http.StatusMethodNotAllowed {
+			t.Errorf("route %q is not served by the servemux: got %d", pattern, code)
+		}
+
+		if _, ok := spec.operation(pattern); !ok {
+			t.Errorf("route %q is not documented in openapi.json", pattern)
+		}
+	}
+}
+
+// The examplePath() helper fills in the wildcards in a path pattern, so that
+// it can be requested. We use 1, which is the ID of a snippet which exists in
+// the mocks.
+func examplePath(pattern string) string {
+	return regexp.MustCompile(`\{[^}]*\}`).ReplaceAllString(pattern, "1")
+}
+
+// The routePatterns() helper returns every string literal in a Go source file
+// which looks like a servemux pattern with a method, like "GET /api/v1/snippets".
+func routePatterns(t *testing.T, filename string) []string {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rx := regexp.MustCompile(`^[A-Z]+ /`)
+
+	var patterns []string
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+
+		s, err := strconv.Unquote(lit.Value)
+		if err == nil && rx.MatchString(s) {
+			patterns = append(patterns, s)
+		}
+		return true
+	})
+
+	return patterns
+}
+
+// TestOpenAPIResponses sends a sample of requests to each API route and
+// checks that the status code is one which the spec documents for the
+// operation, and that the response body matches the documented schema.
+func TestOpenAPIResponses(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	spec := loadOpenAPISpec(t)
+
+	const (
+		list   = "GET /api/v1/snippets"
+		get    = "GET /api/v1/snippets/{id}"
+		create = "POST /api/v1/snippets"
+		update = "PATCH /api/v1/snippets/{id}"
+		remove = "DELETE /api/v1/snippets/{id}"
+	)
+
+	validSnippet := `{"title": "O snail", "content": "Climb Mount Fuji", "expires": 7}`
+
+	tests := []struct {
+		pattern  string
+		method   string
+		urlPath  string
+		token    string
+		body     string
+		wantCode int
+	}{
+		{"GET /api/openapi.json", http.MethodGet, "/api/openapi.json", "", "", http.StatusOK},
+
+		{list, http.MethodGet, "/api/v1/snippets", "", "", http.StatusOK},
+		{list, http.MethodGet, "/api/v1/snippets?page=0", "", "", http.StatusUnprocessableEntity},
+
+		{get, http.MethodGet, "/api/v1/snippets/1", "", "", http.StatusOK},
+		{get, http.MethodGet, "/api/v1/snippets/4", "", "", http.StatusOK},
+		{get, http.MethodGet, "/api/v1/snippets/99", "", "", http.StatusNotFound},
+
+		{create, http.MethodPost, "/api/v1/snippets", "sbx_WRITETOKEN", validSnippet, http.StatusCreated},
+		{create, http.MethodPost, "/api/v1/snippets", "sbx_WRITETOKEN", `{"title": `, http.StatusBadRequest},
+		{create, http.MethodPost, "/api/v1/snippets", "", validSnippet, http.StatusUnauthorized},
+		{create, http.MethodPost, "/api/v1/snippets", "sbx_READTOKEN", validSnippet, http.StatusForbidden},
+		{create, http.MethodPost, "/api/v1/snippets", "sbx_WRITETOKEN", `{"title": "", "content": "", "expires": 2}`, http.StatusUnprocessableEntity},
+
+		{update, http.MethodPatch, "/api/v1/snippets/1", "sbx_WRITETOKEN", `{"title": "Updated"}`, http.StatusOK},
+		{update, http.MethodPatch, "/api/v1/snippets/1", "sbx_WRITETOKEN", `{"colour": "red"}`, http.StatusBadRequest},
+		{update, http.MethodPatch, "/api/v1/snippets/1", "", `{"title": "Updated"}`, http.StatusUnauthorized},
+		{update, http.MethodPatch, "/api/v1/snippets/1", "sbx_CAROLTOKEN", `{"title": "Updated"}`, http.StatusForbidden},
+		{update, http.MethodPatch, "/api/v1/snippets/99", "sbx_WRITETOKEN", `{"title": "Updated"}`, http.StatusNotFound},
+		{update, http.MethodPatch, "/api/v1/snippets/1", "sbx_WRITETOKEN", `{"expires": 2}`, http.StatusUnprocessableEntity},
+
+		{remove, http.MethodDelete, "/api/v1/snippets/1", "", "", http.StatusUnauthorized},
+		{remove, http.MethodDelete, "/api/v1/snippets/1", "sbx_READTOKEN", "", http.StatusForbidden},
+		{remove, http.MethodDelete, "/api/v1/snippets/99", "sbx_WRITETOKEN", "", http.StatusNotFound},
+		{remove, http.MethodDelete, "/api/v1/snippets/1", "sbx_WRITETOKEN", "", http.StatusNoContent},
+	}
+
+	sampled := map[string]bool{}
+
+	for _, tt := range tests {
+		sampled[tt.pattern] = true
+
+		name := fmt.Sprintf("%s %s %d", tt.method, tt.urlPath, tt.wantCode)
+
+		t.Run(name, func(t *testing.T) {
+			op, ok := spec.operation(tt.pattern)
+			if !ok {
+				t.Fatalf("%q is not documented", tt.pattern)
+			}
+
+			header := http.Header{}
+			header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			code, _, body := ts.do(t, tt.method, tt.urlPath, header, strings.NewReader(tt.body))
+			if code != tt.wantCode {
+				t.Fatalf("got status %d; want %d: %s", code, tt.wantCode, body)
+			}
+
+			rs, ok := spec.response(op, code)
+			if !ok {
+				t.Fatalf("status %d is not documented for %q", code, tt.pattern)
+			}
+
+			media, ok := rs.Content["application/json"]
+			if !ok {
+				if body != "" {
+					t.Errorf("got body %q; want none", body)
+				}
+				return
+			}
+
+			var value any
+			err := json.Unmarshal([]byte(body), &value)
+			if err != nil {
+				t.Fatalf("invalid JSON response %q: %v", body, err)
+			}
+
+			err = spec.validate(media.Schema, value, "$")
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// Make sure that no route has been added without at least one sample.
+	for _, route := range app.apiRoutes() {
+		if !sampled[route.pattern] {
+			t.Errorf("route %q has no sample requests", route.pattern)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// The trustedProxies type holds the networks which reverse proxies in front
+// of the application connect from. Only requests from these addresses may
+// tell us the real client address and scheme using the Forwarded,
+// X-Forwarded-For and X-Forwarded-Proto headers. Anybody else could send
+// those headers to spoof their address.
+type trustedProxies []netip.Prefix
+
+// The parseTrustedProxies() function parses a comma-separated list of CIDR
+// ranges, like "10.0.0.0/8,fd00::/8". A single address is accepted as well,
+// and means just that address.
+func parseTrustedProxies(s string) (trustedProxies, error) {
+	var proxies trustedProxies
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+			}
+			addr = addr.Unmap()
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+
+	return proxies, nil
+}
+
+func (p trustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// The parseForwardedAddr() function parses a client address from a
+// forwarding header. It may have a port, and IPv6 addresses may be in square
+// brackets, like "[2001:db8::1]:4711". Obfuscated identifiers and "unknown"
+// aren't addresses, so they return false.
+func parseForwardedAddr(s string) (netip.Addr, bool) {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// The forwardedValues() function returns the for= and proto= values from the
+// standard Forwarded header (RFC 7239), like
+//
+//	Forwarded: for=192.0.2.60;proto=https, for="[2001:db8::1]"
+//
+// in the order the proxies added them.
+func forwardedValues(h http.Header) (fors, protos []string) {
+	for _, line := range h.Values("Forwarded") {
+		for _, element := range strings.Split(line, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				value = strings.Trim(value, `"`)
+
+				switch strings.ToLower(key) {
+				case "for":
+					fors = append(fors, value)
+				case "proto":
+					protos = append(protos, value)
+				}
+			}
+		}
+	}
+	return fors, protos
+}
+
+// The splitHeaderList() function returns the comma-separated values from all
+// instances of a header, like X-Forwarded-For.
+func splitHeaderList(h http.Header, name string) []string {
+	var values []string
+	for _, line := range h.Values(name) {
+		for _, v := range strings.Split(line, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+// The requestScheme() helper returns the scheme that the client used to make
+// the request: "https" or "http". Behind a trusted proxy this comes from the
+// forwarding headers, otherwise from the connection itself.
+func requestScheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(requestSchemeContextKey).(string); ok {
+		return scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// The fromTrustedProxy() helper reports whether the request came through one
+// of the trusted proxies, so that headers which only a proxy should set, like
+// X-Request-ID, can be believed.
+func fromTrustedProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(fromTrustedProxyContextKey).(bool)
+	return trusted
+}
+
+// The proxyHeaders middleware works out the real client address and scheme
+// when the request has come through one of the trusted proxies. It must run
+// before everything else which looks at r.RemoteAddr, like logRequest, and
+// before requestID, which uses fromTrustedProxy().
+//
+// The client address is found by walking the list of forwarded addresses from
+// right to left, skipping the trusted proxies. The rightmost untrusted
+// address is the one which connected to our outermost proxy; anything to the
+// left of it was supplied by the client and can't be believed. If the
+// Forwarded header is present it is used in preference to the X-Forwarded-*
+// headers.
+//
+// Headers from peers which aren't trusted are ignored altogether.
+func (app *application) proxyHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := parseForwardedAddr(r.RemoteAddr)
+		if len(app.trustedProxies) == 0 || !ok || !app.trustedProxies.contains(peer) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		fors, protos := forwardedValues(r.Header)
+		if len(fors) == 0 && len(protos) == 0 {
+			fors = splitHeaderList(r.Header, "X-Forwarded-For")
+			protos = splitHeaderList(r.Header, "X-Forwarded-Proto")
+		}
+
+		client := peer
+		for i := len(fors) - 1; i >= 0; i-- {
+			addr, ok := parseForwardedAddr(fors[i])
+			if !ok {
+				break
+			}
+			client = addr
+			if !app.trustedProxies.contains(addr) {
+				break
+			}
+		}
+
+		scheme := requestScheme(r)
+		if len(protos) > 0 {
+			switch proto := strings.ToLower(protos[len(protos)-1]); proto {
+			case "http", "https":
+				scheme = proto
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), requestSchemeContextKey, scheme)
+		ctx = context.WithValue(ctx, fromTrustedProxyContextKey, true)
+		r = r.WithContext(ctx)
+		r.RemoteAddr = client.String()
+
+		next.ServeHTTP(&cookieSecurityWriter{ResponseWriter: w, secure: scheme == "https"}, r)
+	})
+}
+
+// The cookieSecurityWriter type sets the Secure attribute of every cookie in
+// the response to match the scheme the client used. The session and CSRF
+// cookies are always marked Secure, which is right when we terminate TLS
+// ourselves. Behind a proxy, though, a browser talking plain HTTP to the
+// proxy would never send them back.
+type cookieSecurityWriter struct {
+	http.ResponseWriter
+	secure      bool
+	wroteHeader bool
+}
+
+func (cw *cookieSecurityWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		cw.rewriteCookies()
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cookieSecurityWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cookieSecurityWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *cookieSecurityWriter) rewriteCookies() {
+	header := cw.Header()
+
+	lines := header.Values("Set-Cookie")
+	if len(lines) == 0 {
+		return
+	}
+
+	header.Del("Set-Cookie")
+	for _, line := range lines {
+		cookie, err := http.ParseSetCookie(line)
+		if err != nil {
+			// Leave anything we can't parse exactly as it was.
+			header.Add("Set-Cookie", line)
+			continue
+		}
+		cookie.Secure = cw.secure
+		header.Add("Set-Cookie", cookie.String())
+	}
+}
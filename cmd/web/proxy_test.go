@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestProxyHeaders(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, fd00::/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		proxies    trustedProxies
+		remoteAddr string
+		header     http.Header
+		wantIP     string
+		wantScheme string
+	}{
+		{
+			name:       "No trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.5"}, "X-Forwarded-Proto": {"https"}},
+			wantIP:     "10.0.0.1",
+			wantScheme: "http",
+		},
+		{
+			name:       "Untrusted peer",
+			proxies:    proxies,
+			remoteAddr: "198.51.100.7:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.5"}, "X-Forwarded-Proto": {"https"}},
+			wantIP:     "198.51.100.7",
+			wantScheme: "http",
+		},
+		{
+			name:       "Trusted peer without headers",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			wantIP:     "10.0.0.1",
+			wantScheme: "http",
+		},
+		{
+			name:       "X-Forwarded-For",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.5"}, "X-Forwarded-Proto": {"https"}},
+			wantIP:     "203.0.113.5",
+			wantScheme: "https",
+		},
+		{
+			name:       "Chain of proxies",
+			proxies:    proxies,
+			remoteAddr: "192.0.2.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.5, 10.1.2.3", "10.0.0.9"}},
+			wantIP:     "203.0.113.5",
+			wantScheme: "http",
+		},
+		{
+			name:       "Spoofed address from client",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"10.9.9.9, 203.0.113.5"}},
+			wantIP:     "203.0.113.5",
+			wantScheme: "http",
+		},
+		{
+			name:       "Forwarded",
+			proxies:    proxies,
+			remoteAddr: "[fd00::1]:1234",
+			header:     http.Header{"Forwarded": {`for="[2001:db8::1]:4711";proto=https, for=10.0.0.2`}},
+			wantIP:     "2001:db8::1",
+			wantScheme: "https",
+		},
+		{
+			name:       "Forwarded takes precedence",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header: http.Header{
+				"Forwarded":         {"for=203.0.113.5;proto=https"},
+				"X-Forwarded-For":   {"198.51.100.7"},
+				"X-Forwarded-Proto": {"http"},
+			},
+			wantIP:     "203.0.113.5",
+			wantScheme: "https",
+		},
+		{
+			name:       "Obfuscated identifier",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {"for=_hidden, for=10.0.0.2"}},
+			wantIP:     "10.0.0.2",
+			wantScheme: "http",
+		},
+		{
+			name:       "Invalid proto",
+			proxies:    proxies,
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-Proto": {"gopher"}},
+			wantIP:     "10.0.0.1",
+			wantScheme: "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.trustedProxies = tt.proxies
+
+			var gotIP, gotScheme string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotIP = clientIP(r)
+				gotScheme = requestScheme(r)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, values := range tt.header {
+				r.Header[key] = values
+			}
+
+			app.proxyHeaders(next).ServeHTTP(httptest.NewRecorder(), r)
+
+			assert.Equal(t, gotIP, tt.wantIP)
+			assert.Equal(t, gotScheme, tt.wantScheme)
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	for _, s := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0.0/8,,bogus/8"} {
+		_, err := parseTrustedProxies(s)
+		if err == nil {
+			t.Errorf("parseTrustedProxies(%q): got nil error; want error", s)
+		}
+	}
+}
+
+func TestProxyCookieSecurity(t *testing.T) {
+	tests := []struct {
+		name       string
+		proto      string
+		wantSecure bool
+	}{
+		{
+			name:       "HTTPS at the proxy",
+			proto:      "https",
+			wantSecure: true,
+		},
+		{
+			name:       "HTTP at the proxy",
+			proto:      "http",
+			wantSecure: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.trustedProxies, _ = parseTrustedProxies("127.0.0.0/8, ::1")
+
+			ts := newTestServer(t, app.routes())
+			defer ts.Close()
+
+			// The signup page sets the CSRF cookie.
+			code, header, _ := ts.do(t, http.MethodGet, "/user/signup", http.Header{"X-Forwarded-Proto": {tt.proto}}, nil)
+			assert.Equal(t, code, http.StatusOK)
+
+			cookies := header.Values("Set-Cookie")
+			if len(cookies) == 0 {
+				t.Fatal("got no cookies")
+			}
+			for _, cookie := range cookies {
+				assert.Equal(t, strings.Contains(cookie, "; Secure"), tt.wantSecure)
+			}
+
+			// Links in feeds use the same scheme as the client.
+			_, _, body := ts.do(t, http.MethodGet, "/feed.atom", http.Header{"X-Forwarded-Proto": {tt.proto}}, nil)
+			assert.StringContains(t, body, `href="`+tt.proto+`://`)
+		})
+	}
+}
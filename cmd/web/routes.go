@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/justinas/alice"
+	"snippetbox.example.com/internal/models"
 	"snippetbox.example.com/ui"
 )
 
@@ -21,22 +22,65 @@ func (app *application) routes() http.Handler {
 	// prefix from the request URL -- any requests that start with /static/ can
 	// just be passed directly to the file server and the corresponding static
 	// file will be served (so long as it exists).
-
-	mux.Handle("GET /static/", http.FileServerFS(ui.Files))
+	//
+	// The staticFiles() handler works the same way, but also serves the
+	// fingerprinted URLs used by the asset template function, and
+	// precompressed copies of the files when there are some.
+	//
+	// In development mode the files are served straight from disk instead.
+	if app.dev != nil {
+		mux.Handle("GET /static/", app.dev.staticFiles())
+	} else {
+		mux.Handle("GET /static/", staticFiles(ui.Files, staticAssets))
+	}
 
 	// Add a new GET /ping route for testing.
 	mux.HandleFunc("GET /ping", ping)
 
+	// Liveness and readiness checks for load balancers and orchestrators.
+	mux.HandleFunc("GET /healthz", healthz)
+	mux.HandleFunc("GET /readyz", app.readyz)
+
+	// Atom and RSS feeds of the latest snippets. Feed readers don't have a
+	// session, so these don't need any of the 'dynamic' middleware.
+	mux.HandleFunc("GET /feed.atom", app.feedAtom)
+	mux.HandleFunc("GET /feed.rss", app.feedRSS)
+	mux.HandleFunc("GET /user/{id}/feed.atom", app.userFeedAtom)
+	mux.HandleFunc("GET /user/{id}/feed.rss", app.userFeedRSS)
+	mux.HandleFunc("GET /tag/{tag}/feed.atom", app.tagFeedAtom)
+	mux.HandleFunc("GET /tag/{tag}/feed.rss", app.tagFeedRSS)
+
 	// Unprotected application routes using the 'dynamic' middleware chain.
-	dynamic := alice.New(app.sessionManager.LoadAndSave, noSurf, app.authenticate)
+	// Note that authenticateToken must come before noSurf, so that requests
+	// made with a personal access token can skip the CSRF checks.
+	// Each of these middleware functions is wrapped with app.traced(), so that
+	// it gets its own span in the request's trace.
+	dynamic := alice.New(
+		app.traced("session", app.loadSession),
+		app.traced("authenticateToken", app.authenticateToken),
+		app.traced("noSurf", noSurf),
+		app.traced("authenticate", app.authenticate),
+	)
 
 	mux.Handle("GET /{$}", dynamic.ThenFunc(app.home))
 	mux.Handle("GET /snippet/view/{id}", dynamic.ThenFunc(app.snippetView))
+	mux.Handle("GET /snippet/raw/{id}/{name}", dynamic.ThenFunc(app.snippetRaw))
+	mux.Handle("GET /snippet/download/{id}", dynamic.ThenFunc(app.snippetDownload))
+	mux.Handle("GET /user/{id}", dynamic.ThenFunc(app.userView))
+	mux.Handle("GET /tag/{tag}", dynamic.ThenFunc(app.tagView))
 
 	mux.Handle("GET /user/signup", dynamic.ThenFunc(app.userSignup))
 	mux.Handle("POST /user/signup", dynamic.ThenFunc(app.userSignupPost))
 	mux.Handle("GET /user/login", dynamic.ThenFunc(app.userLogin))
 	mux.Handle("POST /user/login", dynamic.ThenFunc(app.userLoginPost))
+	mux.Handle("GET /user/login/oidc", dynamic.ThenFunc(app.userLoginOIDC))
+	mux.Handle("GET /user/login/oidc/callback", dynamic.ThenFunc(app.userLoginOIDCCallback))
+
+	// The language menu at the bottom of every page.
+	mux.Handle("POST /language", dynamic.ThenFunc(app.languagePost))
+
+	// The browser's timezone, which main.js sends when we don't know it yet.
+	mux.Handle("POST /timezone", dynamic.ThenFunc(app.timezonePost))
 
 	// Protected (authenticated-only) application routes, using the new "protected"
 	// middleware chain which includes the requireAuthentication middleware.
@@ -44,11 +88,82 @@ func (app *application) routes() http.Handler {
 
 	mux.Handle("GET /snippet/create", protected.ThenFunc(app.snippetCreate))
 	mux.Handle("POST /snippet/create", protected.ThenFunc(app.snippetCreatePost))
+	mux.Handle("POST /snippet/preview", protected.ThenFunc(app.snippetPreviewPost))
+	mux.Handle("POST /snippet/fork/{id}", protected.ThenFunc(app.snippetFork))
 	mux.Handle("POST /user/logout", protected.ThenFunc(app.userLogoutPost))
 
+	// Account management routes can only be used from a logged-in browser
+	// session, never with a personal access token.
+	account := protected.Append(app.requireSession)
+
+	mux.Handle("GET /account/sessions", account.ThenFunc(app.accountSessions))
+	mux.Handle("POST /account/sessions/revoke/{id}", account.ThenFunc(app.accountSessionRevokePost))
+	mux.Handle("POST /account/sessions/revoke-all", account.ThenFunc(app.accountSessionRevokeAllPost))
+
+	mux.Handle("GET /account/tokens", account.ThenFunc(app.accountTokens))
+	mux.Handle("POST /account/tokens/create", account.ThenFunc(app.accountTokenCreatePost))
+	mux.Handle("POST /account/tokens/revoke/{id}", account.ThenFunc(app.accountTokenRevokePost))
+
+	mux.Handle("GET /account/timezone", account.ThenFunc(app.accountTimezone))
+	mux.Handle("POST /account/timezone", account.ThenFunc(app.accountTimezonePost))
+
+	// Privileged routes, which are restricted to users with particular roles.
+	moderator := account.Append(app.requireRole(models.RoleModerator, models.RoleAdmin))
+	admin := account.Append(app.requireRole(models.RoleAdmin))
+
+	mux.Handle("POST /admin/snippets/delete/{id}", moderator.ThenFunc(app.adminSnippetDeletePost))
+
+	mux.Handle("GET /admin/users", admin.ThenFunc(app.adminUsers))
+	mux.Handle("POST /admin/users/disable/{id}", admin.ThenFunc(app.adminUserDisablePost))
+	mux.Handle("POST /admin/users/enable/{id}", admin.ThenFunc(app.adminUserEnablePost))
+	mux.Handle("POST /admin/users/role/{id}", admin.ThenFunc(app.adminUserRolePost))
+	mux.Handle("GET /admin/audit", admin.ThenFunc(app.adminAudit))
+
+	// Routes for the JSON API.
+	for _, route := range app.apiRoutes() {
+		mux.Handle(route.pattern, route.handler)
+	}
+
 	// Create a middleware chain containing our 'standard' middleware
 	// which will be used for every request our application receives.
-	standard := alice.New(app.recoverPanic, app.logRequest, commonHeaders)
+	standard := alice.New(app.proxyHeaders, requestID, app.traceRequest, app.instrument, app.logRequest, app.recoverPanic, compress, commonHeaders)
+
+	// Requests which don't match any route get a 404 or 405 error page. These
+	// use the same middleware as the dynamic routes, so that the navigation
+	// bar shows whether the user is logged in, except that csrfToken takes the
+	// place of noSurf.
+	errorPages := alice.New(
+		app.traced("session", app.loadSession),
+		app.traced("authenticateToken", app.authenticateToken),
+		app.traced("csrfToken", csrfToken),
+		app.traced("authenticate", app.authenticate),
+	)
+
+	return standard.Then(app.handleMuxErrors(mux, errorPages.ThenFunc(app.muxError)))
+}
+
+// The route type holds a pattern and handler to register with the servemux.
+type route struct {
+	pattern string
+	handler http.Handler
+}
+
+// The apiRoutes() method returns the routes for the JSON API. These don't use
+// sessions or CSRF protection at all, and can only be authenticated with a
+// personal access token. They are kept in a table, rather than registered
+// directly in routes(), so that our tests can check every one of them against
+// the OpenAPI specification in api/openapi.json.
+func (app *application) apiRoutes() []route {
+	api := alice.New(app.authenticateToken)
+	apiProtected := api.Append(app.requireAPIAuthentication)
+
+	return []route{
+		{"GET /api/openapi.json", http.HandlerFunc(apiSpec)},
 
-	return standard.Then(mux)
+		{"GET /api/v1/snippets", api.ThenFunc(app.apiSnippetList)},
+		{"GET /api/v1/snippets/{id}", api.ThenFunc(app.apiSnippetGet)},
+		{"POST /api/v1/snippets", apiProtected.ThenFunc(app.apiSnippetCreate)},
+		{"PATCH /api/v1/snippets/{id}", apiProtected.ThenFunc(app.apiSnippetUpdate)},
+		{"DELETE /api/v1/snippets/{id}", apiProtected.ThenFunc(app.apiSnippetDelete)},
+	}
 }
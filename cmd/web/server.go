@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// The shutdownTimeout is how long in-flight requests are given to finish once
+// the server starts shutting down.
+const shutdownTimeout = 30 * time.Second
+
+// The serve() method runs a server until ctx is cancelled (normally when the
+// process receives SIGINT or SIGTERM), and then shuts it down gracefully. The
+// listen function should start the server, for example by calling
+// srv.ListenAndServeTLS().
+//
+// Shutting down happens in two stages. First we mark the application as
+// draining, which makes /readyz fail, and carry on serving requests for
+// drainDelay, so that load balancers have time to notice and stop sending us
+// new traffic. Then we stop accepting connections and wait for in-flight
+// requests to finish.
+func (app *application) serve(ctx context.Context, srv *http.Server, listen func() error, drainDelay time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- listen()
+	}()
+
+	select {
+	case err := <-serveErr:
+		// The server stopped without being asked to, probably because it
+		// couldn't listen on the address.
+		return err
+	case <-ctx.Done():
+	}
+
+	app.logger.Info("draining server", "delay", drainDelay)
+	app.draining.Store(true)
+
+	select {
+	case <-time.After(drainDelay):
+	case err := <-serveErr:
+		return err
+	}
+
+	app.logger.Info("shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+
+	// Once Shutdown() has been called, listen() returns http.ErrServerClosed
+	// straight away, which is what we expect.
+	err = <-serveErr
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"html/template"
 	"io/fs"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"snippetbox.example.com/internal/i18n"
+	"snippetbox.example.com/internal/markdown"
 	"snippetbox.example.com/internal/models"
 	"snippetbox.example.com/ui"
 )
@@ -15,43 +19,138 @@ import (
 type templateData struct {
 	CurrentYear     int
 	Snippet         models.Snippet
+	ParentAvailable bool
+	ForkCount       int
 	Snippets        []models.Snippet
+	Sessions        []models.Session
+	CurrentSession  int
+	Tokens          []models.Token
+	NewToken        string
 	Form            any
 	Flash           string
 	IsAuthenticated bool
 	CSRFToken       string
+	OIDCEnabled     bool
+	IsModerator     bool
+	IsAdmin         bool
+	Users           []models.User
+	AuditEntries    []models.AuditEntry
+	Search          string
+	Heading         string
+	FeedPath        string
+	StatusCode      int
+	StatusText      string
+	ErrorMessage    string
+	RequestID       string
+	Locale          string
+	Languages       []languageOption
+	CurrentPath     string
+	Timezone        *time.Location
+	DetectTimezone  bool
+}
+
+// The languageOption type is one of the choices in the language menu, like
+// {Locale: "fr", Name: "Français"}.
+type languageOption struct {
+	Locale string
+	Name   string
 }
 
 // Function that returns a nicely formatted string representation of
-// a time.Time object.
-func humanDate(t time.Time) string {
+// a time.Time object, in the viewer's timezone and followed by the zone
+// abbreviation, like "17 Mar 2024 at 06:15 EDT". In templates, the viewer's
+// timezone is $.Timezone:
+//
+//	{{humanDate .Created $.Timezone}}
+func humanDate(t time.Time, loc *time.Location) string {
 	// Return the empty string if the time has the zero value.
 	if t.IsZero() {
 		return ""
 	}
 
-	// Convert the time to UTC before converting it.
-	return t.UTC().Format("02 Jan 2006 at 15:04")
+	// Times are shown in UTC for anyone whose timezone we don't know.
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return t.In(loc).Format("02 Jan 2006 at 15:04 MST")
+}
+
+// Function that returns a time in the format used by the datetime attribute
+// of the <time> element, like "2024-03-17T10:15:00Z", so that the time is
+// machine-readable whatever the timezone it's shown in:
+//
+//	<time datetime='{{isoDate .Created}}'>{{humanDate .Created $.Timezone}}</time>
+func isoDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
 
 // Initialise a template.FuncMap object and store it in a global variable.
 // This is essentially a string-keyed map which acts as a lookup between the
 // names of our custom template functions and the functions themselves.
 // Parse the base template page into a template set.
+//
+// The asset function returns the fingerprinted URL of a static file, like
+// {{asset "css/main.css"}}. The markdown function renders a snippet's
+// Markdown as sanitised HTML, and highlight does the same for the code in a
+// snippet's files. The T function for translating text is added for each
+// locale by newTemplateCache().
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":  humanDate,
+	"isoDate":    isoDate,
+	"asset":      staticAssets.url,
+	"markdown":   markdown.Render,
+	"highlight":  markdown.Highlight,
+	"pathEscape": url.PathEscape,
+	"join":       strings.Join,
 }
 
 // Function that returns a cache containing html templates and a customer
 // FuncMap for use in generating response output.
-func NewTemplateCache() (map[string]*template.Template, error) {
+//
+// The templates are parsed once for each locale in the bundle, with a T
+// function which translates into that locale, so the cache is keyed by locale
+// and then by page, like cache["fr"]["home.tmpl"].
+func NewTemplateCache(bundle *i18n.Bundle) (map[string]map[string]*template.Template, error) {
+	return newTemplateCache(ui.Files, functions, bundle)
+}
+
+// The newTemplateCache() function does the work for NewTemplateCache(),
+// parsing the templates from any filesystem with the given functions. In
+// development mode the templates are read from disk instead of ui.Files.
+func newTemplateCache(fsys fs.FS, funcs template.FuncMap, bundle *i18n.Bundle) (map[string]map[string]*template.Template, error) {
+	cache := map[string]map[string]*template.Template{}
+
+	for _, locale := range bundle.Locales() {
+		localeFuncs := template.FuncMap{}
+		for name, fn := range funcs {
+			localeFuncs[name] = fn
+		}
+		localeFuncs["T"] = translate(bundle.Catalog(locale))
+
+		pages, err := parseTemplates(fsys, localeFuncs)
+		if err != nil {
+			return nil, err
+		}
+		cache[locale] = pages
+	}
+
+	return cache, nil
+}
+
+// The parseTemplates() function parses a template set for each page, using
+// the given functions.
+func parseTemplates(fsys fs.FS, funcs template.FuncMap) (map[string]*template.Template, error) {
 	// Initialise a new map to act as the cache.
 	cache := map[string]*template.Template{}
 
-	// Use the fs.Glob() to get a slice of all filepaths in the ui.Files embedded
+	// Use the fs.Glob() to get a slice of all filepaths in the embedded
 	// filesystem which match the pattern "html/pages/*.tmpl".  This essentially gives
 	// us a slice of all the page templates just like before.
-	pages, err := fs.Glob(ui.Files, "html/pages/*.tmpl")
+	pages, err := fs.Glob(fsys, "html/pages/*.tmpl")
 	if err != nil {
 		return nil, err
 	}
@@ -71,8 +170,8 @@ func NewTemplateCache() (map[string]*template.Template, error) {
 		}
 
 		// Use ParseFS() instead of ParseFiles() to parse the template files
-		// from the ui.Files embedded filesystem.
-		ts, err := template.New(name).Funcs(functions).ParseFS(ui.Files, patterns...)
+		// from the embedded filesystem.
+		ts, err := template.New(name).Funcs(funcs).ParseFS(fsys, patterns...)
 		if err != nil {
 			return nil, err
 		}
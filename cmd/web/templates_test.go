@@ -1,6 +1,9 @@
 package main
 
 import (
+	"net/http"
+	"net/url"
+	"regexp"
 	"testing"
 	"time"
 
@@ -8,29 +11,80 @@ import (
 )
 
 func TestHumanDate(t *testing.T) {
+	newYork := mustLoadLocation(t, "America/New_York")
+	london := mustLoadLocation(t, "Europe/London")
 
 	// Create a slice of anonymous structs containing the test case name,
-	// input to our humanDate() function (the tm field), and expected output
-	// (the want field).
+	// input to our humanDate() function (the tm and loc fields), and expected
+	// output (the want field). A nil loc is what anonymous users get before
+	// their browser has told us its timezone.
 	tests := []struct {
 		name string
 		tm   time.Time
+		loc  *time.Location
 		want string
 	}{
 		{
 			name: "UTC",
 			tm:   time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC),
-			want: "17 Mar 2024 at 10:15",
+			loc:  time.UTC,
+			want: "17 Mar 2024 at 10:15 UTC",
+		},
+		{
+			name: "Anonymous",
+			tm:   time.Date(2024, 3, 17, 10, 15, 0, 0, time.UTC),
+			loc:  nil,
+			want: "17 Mar 2024 at 10:15 UTC",
 		},
 		{
 			name: "Empty",
 			tm:   time.Time{},
+			loc:  newYork,
 			want: "",
 		},
 		{
 			name: "CET",
 			tm:   time.Date(2024, 3, 17, 10, 15, 0, 0, time.FixedZone("CET", 1*60*60)),
-			want: "17 Mar 2024 at 09:15",
+			loc:  nil,
+			want: "17 Mar 2024 at 09:15 UTC",
+		},
+		{
+			name: "Before spring forward",
+			tm:   time.Date(2024, 3, 10, 6, 59, 0, 0, time.UTC),
+			loc:  newYork,
+			want: "10 Mar 2024 at 01:59 EST",
+		},
+		{
+			name: "After spring forward",
+			tm:   time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC),
+			loc:  newYork,
+			want: "10 Mar 2024 at 03:00 EDT",
+		},
+		{
+			// 01:30 happens twice in New York when the clocks go back, and
+			// only the zone abbreviation tells the two apart.
+			name: "Before fall back",
+			tm:   time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC),
+			loc:  newYork,
+			want: "03 Nov 2024 at 01:30 EDT",
+		},
+		{
+			name: "After fall back",
+			tm:   time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC),
+			loc:  newYork,
+			want: "03 Nov 2024 at 01:30 EST",
+		},
+		{
+			name: "GMT",
+			tm:   time.Date(2024, 3, 31, 0, 59, 0, 0, time.UTC),
+			loc:  london,
+			want: "31 Mar 2024 at 00:59 GMT",
+		},
+		{
+			name: "BST",
+			tm:   time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC),
+			loc:  london,
+			want: "31 Mar 2024 at 02:00 BST",
 		},
 	}
 	// Loop over the test cases.
@@ -40,7 +94,7 @@ func TestHumanDate(t *testing.T) {
 		// identify the sub-test in any log output) and the second parameter is
 		// and anonymous function containing the actual test for each case.
 		t.Run(tt.name, func(t *testing.T) {
-			hd := humanDate(tt.tm)
+			hd := humanDate(tt.tm, tt.loc)
 
 			// Use the new assert.Equal() helper to compare the expected and
 			// actual values.
@@ -48,3 +102,71 @@ func TestHumanDate(t *testing.T) {
 		})
 	}
 }
+
+func TestISODate(t *testing.T) {
+	// The datetime attribute is always in UTC, whichever zone the time is in.
+	tm := time.Date(2024, 3, 10, 3, 0, 0, 0, mustLoadLocation(t, "America/New_York"))
+	assert.Equal(t, isoDate(tm), "2024-03-10T07:00:00Z")
+	assert.Equal(t, isoDate(time.Time{}), "")
+}
+
+func TestTimezoneRendering(t *testing.T) {
+	app := newTestApplication(t)
+	routes := app.routes()
+
+	t.Run("Anonymous", func(t *testing.T) {
+		ts := newTestServer(t, routes)
+		defer ts.Close()
+
+		// Until the browser has told us its timezone, times are shown in UTC
+		// and the page asks for it.
+		_, _, body := ts.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "<body data-detect-timezone>")
+		assertTimeZone(t, body, "UTC")
+
+		form := url.Values{}
+		form.Add("timezone", "America/New_York")
+		form.Add("csrf_token", extractCSRFToken(t, body))
+		code, _, _ := ts.postForm(t, "/timezone", form)
+		assert.Equal(t, code, http.StatusNoContent)
+
+		_, _, body = ts.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "<body>")
+		assertTimeZone(t, body, "EST|EDT")
+	})
+
+	t.Run("User preference", func(t *testing.T) {
+		ts := newTestServer(t, routes)
+		defer ts.Close()
+
+		// Erin has saved Europe/Paris as their timezone, so the page doesn't
+		// ask for the browser's one.
+		ts.loginAs(t, "erin@example.com")
+
+		_, _, body := ts.get(t, "/snippet/view/1")
+		assert.StringContains(t, body, "<body>")
+		assertTimeZone(t, body, "CET|CEST")
+	})
+}
+
+// The assertTimeZone() helper checks that the times on a page are shown in
+// one of the given zones. The mock snippets are created at time.Now(), so
+// which one depends on the time of year.
+func assertTimeZone(t *testing.T, body, zones string) {
+	t.Helper()
+
+	rx := regexp.MustCompile(`<time datetime='[^']+'>[^<]* at \d\d:\d\d (` + zones + `)</time>`)
+	if !rx.MatchString(body) {
+		t.Errorf("got no times in %s in body", zones)
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := loadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
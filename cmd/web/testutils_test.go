@@ -15,7 +15,10 @@ import (
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
+	"go.opentelemetry.io/otel/trace/noop"
+	"snippetbox.example.com/internal/i18n"
 	"snippetbox.example.com/internal/models/mocks"
+	"snippetbox.example.com/ui"
 )
 
 // Define a regular expression which captures the CSRF token value from the
@@ -37,8 +40,13 @@ func extractCSRFToken(t *testing.T, body string) string {
 // Create a newTestApplication helper which returns an instance of our
 // application struct containing mocked dependencies.
 func newTestApplication(t *testing.T) *application {
-	// Create an instance of the template cache.
-	templateCache, err := NewTemplateCache()
+	// Load the message catalogs, and create an instance of the template cache.
+	bundle, err := i18n.NewBundle(ui.Files, "locales", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	templateCache, err := NewTemplateCache(bundle)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -54,14 +62,28 @@ func newTestApplication(t *testing.T) *application {
 	sessionManager.Lifetime = 12 * time.Hour
 	sessionManager.Cookie.Secure = true
 
-	return &application{
+	// The user and snippet models write audit entries along with the changes
+	// they record, so they share the audit model's entries.
+	audit := &mocks.AuditModel{}
+
+	app := &application{
 		logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
-		snippets:       &mocks.SnippetModel{},
-		users:          &mocks.UserModel{},
+		snippets:       &mocks.SnippetModel{Audit: audit},
+		users:          &mocks.UserModel{Audit: audit},
+		sessions:       &mocks.SessionModel{},
+		tokens:         &mocks.TokenModel{},
+		audit:          audit,
 		templateCache:  templateCache,
+		i18n:           bundle,
 		formDecoder:    formDecoder,
 		sessionManager: sessionManager,
+		metrics:        newAppMetrics(nil),
+		tracer:         noop.NewTracerProvider().Tracer(""),
+		db:             &mocks.DB{},
 	}
+	sessionManager.ErrorFunc = app.sessionError
+
+	return app
 }
 
 // Define a custom testServer type which embeds a httptest.Server instance
@@ -135,3 +157,57 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers and body.
 	return rs.StatusCode, rs.Header, string(body)
 }
+
+// Create a login() method which logs the test server client in as the mock
+// user alice@example.com, failing the test if this doesn't work.
+func (ts *testServer) login(t *testing.T) {
+	t.Helper()
+	ts.loginAs(t, "alice@example.com")
+}
+
+// The loginAs() method logs the test server client in as any of the mock
+// users.
+func (ts *testServer) loginAs(t *testing.T, email string) {
+	t.Helper()
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{}
+	form.Add("email", email)
+	form.Add("password", "pa$$word")
+	form.Add("csrf_token", csrfToken)
+
+	code, _, _ := ts.postForm(t, "/user/login", form)
+	if code != http.StatusSeeOther {
+		t.Fatalf("login failed with status %d", code)
+	}
+}
+
+// Create a do() method for sending an arbitrary request to the test server,
+// for cases where we need control over the method or headers.
+func (ts *testServer) do(t *testing.T, method, urlPath string, header http.Header, body io.Reader) (int, http.Header, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+urlPath, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rs.Body.Close()
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respBody = bytes.TrimSpace(respBody)
+
+	return rs.StatusCode, rs.Header, string(respBody)
+}
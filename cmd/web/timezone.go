@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Loading a timezone means reading and parsing its tzdata file, so the
+// locations are cached once they've been loaded. There are only a few hundred
+// timezones, so the cache can't grow very large.
+var locations sync.Map
+
+// The loadLocation() function returns the time.Location for an IANA timezone
+// name, like "Europe/London". Unlike time.LoadLocation(), it rejects "" and
+// "Local", which aren't names a browser or user would give us.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	if name == "" || name == "Local" || len(name) > 64 {
+		return nil, errors.New("invalid timezone")
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// The validTimezone() function reports whether name is a timezone that we
+// know about.
+func validTimezone(name string) bool {
+	_, err := loadLocation(name)
+	return err == nil
+}
+
+// The viewerTimezone() helper returns the timezone to show times in for the
+// current request: the one saved for the logged-in user, or the one that the
+// browser told us about earlier in this session. If we don't know either,
+// times are shown in UTC and detect is true, which asks the JavaScript in
+// base.tmpl to send the browser's timezone to /timezone. A logged-in user
+// without a saved timezone is asked even if the session has one, so that it
+// gets saved on their account.
+func (app *application) viewerTimezone(r *http.Request) (loc *time.Location, detect bool) {
+	if !sessionLoaded(r) {
+		return time.UTC, false
+	}
+
+	name := app.sessionManager.GetString(r.Context(), "timezone")
+	if app.isAuthenticated(r) {
+		userTimezone, _ := r.Context().Value(userTimezoneContextKey).(string)
+		detect = userTimezone == ""
+		if userTimezone != "" {
+			name = userTimezone
+		}
+	} else {
+		detect = name == ""
+	}
+
+	loc, err := loadLocation(name)
+	if err != nil {
+		return time.UTC, detect
+	}
+	return loc, detect
+}
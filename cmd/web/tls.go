@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"snippetbox.example.com/internal/certs"
+)
+
+// The tlsOptions type holds the command-line flags which control where the
+// server's certificate comes from.
+type tlsOptions struct {
+	mode             string
+	certFile         string
+	keyFile          string
+	reloadInterval   time.Duration
+	acmeHosts        string
+	acmeCacheDir     string
+	acmeDirectoryURL string
+	acmeEmail        string
+}
+
+// The newCertificateSource() function returns the tls.Config.GetCertificate
+// callback for the configured mode, and, in ACME mode, the handler to serve
+// on the plain HTTP listener.
+//
+// In "off" mode there's no certificate at all, and the server speaks plain
+// HTTP. That is only meant for running behind a reverse proxy which
+// terminates TLS, so both return values are nil.
+//
+// In "file" mode the certificate and key are read from disk and checked for
+// changes every reloadInterval until ctx is cancelled. In "acme" mode they are
+// obtained and renewed automatically, and the HTTP handler answers the
+// HTTP-01 challenges and redirects everything else to HTTPS.
+func newCertificateSource(ctx context.Context, opts tlsOptions, addr string, logger *slog.Logger) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), http.Handler, error) {
+	switch opts.mode {
+	case "off":
+		return nil, nil, nil
+
+	case "file":
+		reloader, err := certs.NewReloader(opts.certFile, opts.keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		go reloader.Watch(ctx, opts.reloadInterval, logger)
+
+		return reloader.GetCertificate, nil, nil
+
+	case "acme":
+		cfg, err := opts.acmeConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		manager := certs.NewACMEManager(cfg)
+
+		return manager.GetCertificate, manager.HTTPHandler(certs.RedirectHandler(addr)), nil
+
+	default:
+		return nil, nil, fmt.Errorf("unknown TLS mode %q (want file, acme or off)", opts.mode)
+	}
+}
+
+// The acmeConfig() method returns the settings for the ACME manager from the
+// command-line flags. The -acme-hosts flag is a comma-separated list, and
+// must name at least one host.
+func (opts tlsOptions) acmeConfig() (certs.ACMEConfig, error) {
+	var hosts []string
+	for _, host := range strings.Split(opts.acmeHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		return certs.ACMEConfig{}, fmt.Errorf("-acme-hosts is required when -tls-mode is acme")
+	}
+
+	return certs.ACMEConfig{
+		Hosts:        hosts,
+		CacheDir:     opts.acmeCacheDir,
+		DirectoryURL: opts.acmeDirectoryURL,
+		Email:        opts.acmeEmail,
+	}, nil
+}
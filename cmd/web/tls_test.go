@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/internal/certs"
+)
+
+// TestACMEFlags checks that the ACME flags end up in the autocert.Manager,
+// without needing an ACME server to talk to.
+func TestACMEFlags(t *testing.T) {
+	opts := tlsOptions{
+		mode:         "acme",
+		acmeHosts:    " snippetbox.example.com, www.snippetbox.example.com ,",
+		acmeCacheDir: "/var/lib/snippetbox/acme",
+		acmeEmail:    "ops@example.com",
+	}
+
+	cfg, err := opts.acmeConfig()
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Join(cfg.Hosts, " "), "snippetbox.example.com www.snippetbox.example.com")
+
+	m := certs.NewACMEManager(cfg)
+
+	assert.Equal(t, m.Email, "ops@example.com")
+	assert.Equal(t, m.Cache, autocert.Cache(autocert.DirCache("/var/lib/snippetbox/acme")))
+	assert.Equal(t, m.Client.DirectoryURL, autocert.DefaultACMEDirectory)
+
+	for _, host := range []string{"snippetbox.example.com", "www.snippetbox.example.com"} {
+		assert.NilError(t, m.HostPolicy(context.Background(), host))
+	}
+	if err := m.HostPolicy(context.Background(), "attacker.example.com"); err == nil {
+		t.Error("got nil error for attacker.example.com; want host policy error")
+	}
+
+	// At least one host is required.
+	opts.acmeHosts = " , "
+	_, err = opts.acmeConfig()
+	if err == nil {
+		t.Error("got nil error for empty -acme-hosts; want an error")
+	}
+}
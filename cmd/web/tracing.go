@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"snippetbox.example.com/internal/models"
+)
+
+const tracerName = "snippetbox.example.com/cmd/web"
+
+// The newTracerProvider() function sets up OpenTelemetry tracing. The
+// exporter can be "none", which disables tracing, "stdout", which writes
+// spans to standard output for debugging, or "otlp", which sends them to an
+// OpenTelemetry collector over HTTP. The OTLP exporter is configured with the
+// standard OTEL_EXPORTER_OTLP_* environment variables. The returned function
+// flushes any buffered spans, and should be called before exiting.
+func newTracerProvider(ctx context.Context, exporter string) (trace.TracerProvider, func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+
+	switch exporter {
+	case "none":
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		exp, err = otlptracehttp.New(ctx)
+	default:
+		return nil, nil, fmt.Errorf("invalid trace exporter %q (must be none, stdout or otlp)", exporter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("snippetbox"),
+	))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+
+	return tp, tp.Shutdown, nil
+}
+
+// The enableTracing() method records spans using the given tracer provider.
+// As well as the spans for each request that the middleware records, it wraps
+// the models and the session store so that every database call gets a span
+// of its own.
+func (app *application) enableTracing(tp trace.TracerProvider) {
+	app.tracer = tp.Tracer(tracerName)
+
+	app.snippets = models.NewTracedSnippetModel(app.snippets, tp)
+	app.users = models.NewTracedUserModel(app.users, tp)
+	app.sessions = models.NewTracedSessionModel(app.sessions, tp)
+	app.tokens = models.NewTracedTokenModel(app.tokens, tp)
+	app.audit = models.NewTracedAuditModel(app.audit, tp)
+
+	app.sessionManager.Store = &tracedStore{next: app.sessionManager.Store, tracer: app.tracer}
+}
+
+// The traceRequest middleware starts the server span for each request. If
+// the request has a W3C traceparent header, from a load balancer or another
+// service, then the span joins that trace. Like instrument, it reads
+// r.Pattern after the servemux has set it, and uses it as the span name, so
+// that spans for the same route are grouped together.
+func (app *application) traceRequest(next http.Handler) http.Handler {
+	propagator := propagation.TraceContext{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := app.tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		r = r.WithContext(ctx)
+		rw := newResponseWriter(w)
+
+		next.ServeHTTP(rw, r)
+
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(routeLabel(r)))
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rw.status))
+		if rw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rw.status))
+		}
+	})
+}
+
+// The traced() method wraps a middleware function so that it gets its own
+// span. The span lasts until the middleware returns, so it includes the time
+// spent in everything further down the chain too.
+func (app *application) traced(name string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		h := mw(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := app.tracer.Start(r.Context(), "middleware "+name)
+			defer span.End()
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// The tracedStore type wraps a session store, recording a span for each
+// call. It implements scs.CtxStore so that the session manager passes it the
+// request context, which holds the parent span.
+type tracedStore struct {
+	next   scs.Store
+	tracer trace.Tracer
+}
+
+func (s *tracedStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	ctx, span := s.tracer.Start(ctx, "session.Find", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	var (
+		b     []byte
+		found bool
+		err   error
+	)
+	if cs, ok := s.next.(scs.CtxStore); ok {
+		b, found, err = cs.FindCtx(ctx, token)
+	} else {
+		b, found, err = s.next.Find(token)
+	}
+
+	span.SetAttributes(attribute.Bool("session.found", found))
+	recordSpanError(span, err)
+	return b, found, err
+}
+
+func (s *tracedStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	ctx, span := s.tracer.Start(ctx, "session.Commit", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	var err error
+	if cs, ok := s.next.(scs.CtxStore); ok {
+		err = cs.CommitCtx(ctx, token, b, expiry)
+	} else {
+		err = s.next.Commit(token, b, expiry)
+	}
+
+	recordSpanError(span, err)
+	return err
+}
+
+func (s *tracedStore) DeleteCtx(ctx context.Context, token string) error {
+	ctx, span := s.tracer.Start(ctx, "session.Delete", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	var err error
+	if cs, ok := s.next.(scs.CtxStore); ok {
+		err = cs.DeleteCtx(ctx, token)
+	} else {
+		err = s.next.Delete(token)
+	}
+
+	recordSpanError(span, err)
+	return err
+}
+
+// The plain scs.Store methods are needed to satisfy the interface, but the
+// session manager always calls the ...Ctx versions above instead.
+func (s *tracedStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+func (s *tracedStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, b, expiry)
+}
+
+func (s *tracedStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+func recordSpanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
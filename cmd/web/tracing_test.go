@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"snippetbox.example.com/internal/assert"
+)
+
+// The spanPath() helper returns the names of a span and all of its
+// ancestors, starting with the root, joined by " > ".
+func spanPath(spans tracetest.SpanStubs, span tracetest.SpanStub) string {
+	byID := map[trace.SpanID]tracetest.SpanStub{}
+	for _, s := range spans {
+		byID[s.SpanContext.SpanID()] = s
+	}
+
+	names := []string{span.Name}
+	for {
+		parent, ok := byID[span.Parent.SpanID()]
+		if !ok {
+			break
+		}
+		names = append(names, parent.Name)
+		span = parent
+	}
+
+	slices.Reverse(names)
+	return strings.Join(names, " > ")
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	app := newTestApplication(t)
+	app.enableTracing(tp)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	// Log in first, so that the request has a session to load from the store
+	// and a user to look up.
+	ts.login(t)
+	exporter.Reset()
+
+	const (
+		traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentSpanID = "00f067aa0ba902b7"
+	)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+
+	code, _, _ := ts.do(t, http.MethodGet, "/snippet/view/1", header, nil)
+	assert.Equal(t, code, http.StatusOK)
+
+	spans := exporter.GetSpans()
+
+	var paths []string
+	for _, span := range spans {
+		// Every span must belong to the trace from the traceparent header.
+		assert.Equal(t, span.SpanContext.TraceID().String(), traceID)
+		paths = append(paths, spanPath(spans, span))
+	}
+
+	const (
+		root       = "GET /snippet/view/{id}"
+		middleware = root + " > middleware session > middleware authenticateToken > middleware noSurf > middleware authenticate"
+	)
+
+	wantPaths := []string{
+		root + " > middleware session > session.Find",
+		middleware + " > UserModel.Get",
+		middleware + " > SessionModel.Touch",
+		middleware + " > SnippetModel.Get",
+		middleware + " > render view.tmpl",
+	}
+
+	for _, want := range wantPaths {
+		if !slices.Contains(paths, want) {
+			t.Errorf("missing span %q in:\n%s", want, strings.Join(paths, "\n"))
+		}
+	}
+
+	// The root span must be a server span whose parent is the span from the
+	// traceparent header, and must be labelled with the route pattern.
+	i := slices.Index(paths, root)
+	if i == -1 {
+		t.Fatalf("missing root span %q", root)
+	}
+
+	rootSpan := spans[i]
+	assert.Equal(t, rootSpan.SpanKind, trace.SpanKindServer)
+	assert.Equal(t, rootSpan.Parent.SpanID().String(), parentSpanID)
+	assert.Equal(t, rootSpan.Parent.IsRemote(), true)
+	assert.Equal(t, slices.Contains(rootSpan.Attributes, attribute.String("http.route", "/snippet/view/{id}")), true)
+	assert.Equal(t, slices.Contains(rootSpan.Attributes, attribute.Int("http.response.status_code", http.StatusOK)), true)
+}
+
+func TestTracingNoRecord(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	app := newTestApplication(t)
+	app.enableTracing(tp)
+
+	ts := newTestServer(t, app.routes())
+	defer ts.Close()
+
+	code, _, _ := ts.get(t, "/snippet/view/99")
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// A missing snippet is a normal outcome, so the span shouldn't be marked
+	// as an error.
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "SnippetModel.Get" {
+			assert.Equal(t, span.Status.Code.String(), "Unset")
+			return
+		}
+	}
+
+	t.Error("no SnippetModel.Get span recorded")
+}
@@ -0,0 +1,86 @@
+package certs
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// The ACMEConfig type holds the settings for obtaining certificates
+// automatically.
+type ACMEConfig struct {
+	// Hosts is the list of host names which certificates may be requested
+	// for. Requests for any other name are refused, so that nobody can make
+	// us request certificates for arbitrary names by sending a crafted SNI.
+	Hosts []string
+
+	// CacheDir is where certificates and the account key are stored, so that
+	// they survive restarts. It should only be readable by the server.
+	CacheDir string
+
+	// DirectoryURL is the ACME directory of the certificate authority. It
+	// defaults to Let's Encrypt, and can be pointed at a test server such as
+	// Pebble.
+	DirectoryURL string
+
+	// Email is an optional contact address for the ACME account.
+	Email string
+
+	// HTTPClient is used to talk to the ACME server. If it's nil then
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// The NewACMEManager() function returns an autocert.Manager. Its
+// GetCertificate() method should be used as the tls.Config.GetCertificate
+// callback, and its HTTPHandler() must be served on port 80 to answer the
+// HTTP-01 challenges.
+func NewACMEManager(cfg ACMEConfig) *autocert.Manager {
+	directoryURL := cfg.DirectoryURL
+	if directoryURL == "" {
+		directoryURL = autocert.DefaultACMEDirectory
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Hosts...),
+		Cache:      autocert.DirCache(cfg.CacheDir),
+		Email:      cfg.Email,
+		Client: &acme.Client{
+			DirectoryURL: directoryURL,
+			HTTPClient:   cfg.HTTPClient,
+		},
+	}
+}
+
+// The RedirectHandler() function returns a handler which redirects every
+// request to the same URL over HTTPS. The tlsAddr is the address the HTTPS
+// server listens on, like ":443" or ":4000", and is used to pick the port.
+func RedirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+		switch {
+		case port != "" && port != "443":
+			host = net.JoinHostPort(host, port)
+		case strings.Contains(host, ":"):
+			// An IPv6 literal still needs its brackets without a port.
+			host = "[" + host + "]"
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+
+		// Use 308 rather than 301, so that clients repeat POST requests
+		// with the same method and body.
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,195 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		tlsAddr string
+		host    string
+		target  string
+		wantLoc string
+	}{
+		{
+			name:    "Default port",
+			tlsAddr: ":443",
+			host:    "snippetbox.example.com",
+			target:  "/snippet/view/1?x=y",
+			wantLoc: "https://snippetbox.example.com/snippet/view/1?x=y",
+		},
+		{
+			name:    "Port in request host",
+			tlsAddr: ":443",
+			host:    "snippetbox.example.com:80",
+			target:  "/",
+			wantLoc: "https://snippetbox.example.com/",
+		},
+		{
+			name:    "Non-default port",
+			tlsAddr: ":4000",
+			host:    "snippetbox.example.com",
+			target:  "/",
+			wantLoc: "https://snippetbox.example.com:4000/",
+		},
+		{
+			name:    "IPv6",
+			tlsAddr: ":443",
+			host:    "[::1]:80",
+			target:  "/",
+			wantLoc: "https://[::1]/",
+		},
+		{
+			name:    "IPv6 with non-default port",
+			tlsAddr: ":4000",
+			host:    "[::1]",
+			target:  "/",
+			wantLoc: "https://[::1]:4000/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			r.Host = tt.host
+
+			RedirectHandler(tt.tlsAddr).ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Code, http.StatusPermanentRedirect)
+			assert.Equal(t, rr.Header().Get("Location"), tt.wantLoc)
+		})
+	}
+}
+
+func TestACMEManagerHostPolicy(t *testing.T) {
+	// The directory URL points nowhere, which shows that names outside the
+	// allow-list are refused before the ACME server is contacted.
+	m := NewACMEManager(ACMEConfig{
+		Hosts:        []string{"snippetbox.example.com"},
+		CacheDir:     t.TempDir(),
+		DirectoryURL: "http://127.0.0.1:1/dir",
+	})
+
+	_, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "attacker.example.com"})
+	if err == nil {
+		t.Fatal("got nil error; want host policy error")
+	}
+	assert.StringContains(t, err.Error(), "not configured")
+}
+
+func TestNewACMEManager(t *testing.T) {
+	dir := t.TempDir()
+
+	m := NewACMEManager(ACMEConfig{
+		Hosts:        []string{"snippetbox.example.com"},
+		CacheDir:     dir,
+		DirectoryURL: "https://localhost:14000/dir",
+		Email:        "ops@example.com",
+	})
+
+	// The manager must accept the terms of service by itself, because there's
+	// nobody there to do it, and keep its certificates in the cache
+	// directory.
+	if m.Prompt == nil {
+		t.Fatal("got nil Prompt; want autocert.AcceptTOS")
+	}
+	assert.Equal(t, m.Prompt("https://example.com/tos"), true)
+	assert.Equal(t, m.Cache, autocert.Cache(autocert.DirCache(dir)))
+	assert.Equal(t, m.Email, "ops@example.com")
+	assert.Equal(t, m.Client.DirectoryURL, "https://localhost:14000/dir")
+
+	assert.NilError(t, m.HostPolicy(context.Background(), "snippetbox.example.com"))
+	if err := m.HostPolicy(context.Background(), "attacker.example.com"); err == nil {
+		t.Error("got nil error; want host policy error")
+	}
+
+	// Without a directory URL, certificates come from Let's Encrypt.
+	m = NewACMEManager(ACMEConfig{Hosts: []string{"snippetbox.example.com"}, CacheDir: dir})
+	assert.Equal(t, m.Client.DirectoryURL, autocert.DefaultACMEDirectory)
+}
+
+// The TestACMEPebble test obtains a real certificate from a local Pebble test
+// server (https://github.com/letsencrypt/pebble), so it's skipped unless
+// SNIPPETBOX_TEST_ACME_DIRECTORY is set. For example:
+//
+//	$ PEBBLE_VA_ALWAYS_VALID=1 pebble -config test/config/pebble-config.json
+//	$ SNIPPETBOX_TEST_ACME_DIRECTORY=https://localhost:14000/dir \
+//	  SNIPPETBOX_TEST_ACME_CA=test/certs/pebble.minica.pem \
+//	  go test ./internal/certs/ -run Pebble
+//
+// Without PEBBLE_VA_ALWAYS_VALID, Pebble makes the HTTP-01 challenge requests
+// to port 5002 of the test host name, so the name must resolve to this
+// machine (for example using pebble-challtestsrv as Pebble's DNS server).
+func TestACMEPebble(t *testing.T) {
+	directoryURL := os.Getenv("SNIPPETBOX_TEST_ACME_DIRECTORY")
+	if directoryURL == "" {
+		t.Skip("SNIPPETBOX_TEST_ACME_DIRECTORY not set")
+	}
+
+	host := os.Getenv("SNIPPETBOX_TEST_ACME_HOST")
+	if host == "" {
+		host = "snippetbox.test"
+	}
+	httpAddr := os.Getenv("SNIPPETBOX_TEST_ACME_HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = ":5002"
+	}
+
+	// Pebble's API is served with a certificate from its own test CA, which
+	// we need to trust to talk to it.
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caFile := os.Getenv("SNIPPETBOX_TEST_ACME_CA"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool.AppendCertsFromPEM(pem)
+	}
+
+	m := NewACMEManager(ACMEConfig{
+		Hosts:        []string{host},
+		CacheDir:     t.TempDir(),
+		DirectoryURL: directoryURL,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+			Timeout:   30 * time.Second,
+		},
+	})
+
+	// Serve the HTTP-01 challenges, just like the server does on port 80.
+	ln, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: m.HTTPHandler(RedirectHandler(":443"))}
+	go srv.Serve(ln)
+	defer srv.Shutdown(context.Background())
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, cert.Leaf.DNSNames[0], host)
+
+	// The certificate is cached, so asking again doesn't need another order.
+	again, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+	assert.NilError(t, err)
+	assert.Equal(t, again.Leaf.SerialNumber.String(), cert.Leaf.SerialNumber.String())
+}
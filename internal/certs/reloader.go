@@ -0,0 +1,120 @@
+// Package certs provides the TLS certificates for the server, either from
+// certificate and key files on disk, which are reloaded when they change, or
+// automatically from an ACME certificate authority such as Let's Encrypt.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// A Reloader serves a certificate loaded from a pair of PEM files, and loads
+// it again whenever either file changes. Its GetCertificate() method is used
+// as the tls.Config.GetCertificate callback, so a renewed certificate is
+// picked up by new connections without restarting the server or dropping
+// the connections which are already open.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// The NewReloader() function loads the certificate and key for the first
+// time. Unlike later reloads, a failure here is returned as an error, since
+// the server can't start without a certificate.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+
+	_, err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// The GetCertificate() method returns the current certificate.
+func (r *Reloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// The latestModTime() method returns the most recent modification time of
+// the certificate and key files.
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// The Reload() method loads the certificate and key again if either file has
+// changed since they were last loaded, and reports whether it did so. If the
+// new files can't be loaded, perhaps because only one of them has been
+// replaced so far, the current certificate is kept and an error returned.
+func (r *Reloader) Reload() (bool, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// The Watch() method checks the files for changes every interval until ctx
+// is cancelled. Certificate renewal tools usually replace the files rather
+// than editing them, so polling the modification time is simple and works
+// everywhere, without needing filesystem notifications.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				logger.Error("reloading TLS certificate", "error", err, "cert", r.certFile, "key", r.keyFile)
+			} else if reloaded {
+				logger.Info("reloaded TLS certificate", "cert", r.certFile)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+// The writeCert() helper writes a new self-signed certificate for the given
+// common name, and its key, to certFile and keyFile. The modification times
+// are set to modTime, so the test doesn't depend on the filesystem's
+// timestamp resolution.
+func writeCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{certFile, keyFile} {
+		err = os.Chtimes(name, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func commonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	writeCert(t, certFile, keyFile, "first", start)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, commonName(t, r), "first")
+
+	// Nothing has changed, so nothing is reloaded.
+	reloaded, err := r.Reload()
+	assert.NilError(t, err)
+	assert.Equal(t, reloaded, false)
+
+	// A renewed certificate is picked up.
+	writeCert(t, certFile, keyFile, "second", start.Add(time.Minute))
+
+	reloaded, err = r.Reload()
+	assert.NilError(t, err)
+	assert.Equal(t, reloaded, true)
+	assert.Equal(t, commonName(t, r), "second")
+
+	// If the new files are broken, the previous certificate is kept.
+	err = os.WriteFile(keyFile, []byte("not a key"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(keyFile, start.Add(2*time.Minute), start.Add(2*time.Minute))
+
+	reloaded, err = r.Reload()
+	if err == nil {
+		t.Error("got nil error; want error loading broken key")
+	}
+	assert.Equal(t, reloaded, false)
+	assert.Equal(t, commonName(t, r), "second")
+}
+
+func TestNewReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err == nil {
+		t.Error("got nil error; want error for missing files")
+	}
+}
@@ -0,0 +1,226 @@
+// Package client is a small Go client for the Snippetbox JSON API. It is used
+// by the snippet command-line tool, but has no dependencies on it, so it can
+// be used by other programs too.
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Snippet type holds a snippet as it is returned by the API. Files is
+// only filled in by Get(), since lists of snippets leave them out.
+type Snippet struct {
+	ID      int       `json:"id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Format  string    `json:"format"`
+	Files   []File    `json:"files"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	OwnerID int       `json:"owner_id"`
+}
+
+// The File type holds one of the files in a snippet, in the order they were
+// added. Language is the language the file is highlighted as, or "" if it's
+// worked out from the name.
+type File struct {
+	Name     string `json:"name"`
+	Language string `json:"language"`
+	Content  string `json:"content"`
+}
+
+// An Error is returned when the API responds with a status code other than
+// the one we expected. Fields holds the per-field messages from a validation
+// error, if there were any.
+type Error struct {
+	StatusCode int
+	Message    string
+	Fields     map[string]string
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+	}
+
+	var fields []string
+	for name, msg := range e.Fields {
+		fields = append(fields, fmt.Sprintf("%s: %s", name, msg))
+	}
+	return fmt.Sprintf("%s (%d): %s", e.Message, e.StatusCode, strings.Join(fields, "; "))
+}
+
+// ErrNotFound is wrapped by the error returned when a snippet doesn't exist.
+var ErrNotFound = errors.New("client: snippet not found")
+
+func (e *Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// A Client talks to a single Snippetbox server. BaseURL is the address of the
+// server, like "https://localhost:4000", and Token is a personal access token
+// created on the server's /account/tokens page. Token may be left blank if
+// the client is only used to read snippets.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// The New() function returns a Client for the given server. If caFile isn't
+// empty, it should be the path to a PEM-encoded certificate which the client
+// will trust in addition to the system roots. This is how the client can talk
+// to a development server using the self-signed certificate in ./tls.
+func New(baseURL, token, caFile string) (*Client, error) {
+	c := &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("client: no certificates found in %s", caFile)
+		}
+
+		c.HTTPClient.Transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				RootCAs:    pool,
+				MinVersion: tls.VersionTLS12,
+			},
+		}
+	}
+
+	return c, nil
+}
+
+// The SnippetURL() method returns the address of the web page for a snippet.
+func (c *Client) SnippetURL(id int) string {
+	return fmt.Sprintf("%s/snippet/view/%d", c.BaseURL, id)
+}
+
+// The Create() method creates a new snippet which expires after the given
+// number of days. The server only accepts 1, 7 or 365.
+func (c *Client) Create(title, content string, expires int) (Snippet, error) {
+	input := map[string]any{"title": title, "content": content, "expires": expires}
+
+	var output struct {
+		Snippet Snippet `json:"snippet"`
+	}
+
+	err := c.do(http.MethodPost, "/api/v1/snippets", input, http.StatusCreated, &output)
+	return output.Snippet, err
+}
+
+// The Get() method fetches a single snippet.
+func (c *Client) Get(id int) (Snippet, error) {
+	var output struct {
+		Snippet Snippet `json:"snippet"`
+	}
+
+	err := c.do(http.MethodGet, fmt.Sprintf("/api/v1/snippets/%d", id), nil, http.StatusOK, &output)
+	return output.Snippet, err
+}
+
+// The List() method fetches one page of snippets, newest first, along with
+// the total number of snippets on the server.
+func (c *Client) List(page, pageSize int) ([]Snippet, int, error) {
+	query := url.Values{}
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(pageSize))
+
+	var output struct {
+		Snippets []Snippet `json:"snippets"`
+		Metadata struct {
+			Total int `json:"total"`
+		} `json:"metadata"`
+	}
+
+	err := c.do(http.MethodGet, "/api/v1/snippets?"+query.Encode(), nil, http.StatusOK, &output)
+	return output.Snippets, output.Metadata.Total, err
+}
+
+// The Delete() method deletes one of the token owner's snippets.
+func (c *Client) Delete(id int) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/api/v1/snippets/%d", id), nil, http.StatusNoContent, nil)
+}
+
+// The do() method sends a request to the API, encoding input (if it isn't
+// nil) as the JSON request body. If the response has the wanted status code
+// then the body is decoded into output; otherwise the error message from the
+// body is returned as an *Error.
+func (c *Client) do(method, path string, input any, wantStatus int, output any) error {
+	var body io.Reader
+	if input != nil {
+		js, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	rs, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != wantStatus {
+		apiErr := &Error{StatusCode: rs.StatusCode, Message: http.StatusText(rs.StatusCode)}
+
+		var payload struct {
+			Error  string            `json:"error"`
+			Fields map[string]string `json:"fields"`
+		}
+		if json.NewDecoder(rs.Body).Decode(&payload) == nil && payload.Error != "" {
+			apiErr.Message = payload.Error
+			apiErr.Fields = payload.Fields
+		}
+
+		return apiErr
+	}
+
+	if output == nil {
+		return nil
+	}
+
+	return json.NewDecoder(rs.Body).Decode(output)
+}
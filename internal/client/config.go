@@ -0,0 +1,63 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// The Config type holds the settings which the snippet command-line tool
+// reads from its configuration file. A typical file looks like this:
+//
+//	{
+//		"url": "https://localhost:4000",
+//		"token": "sbx_...",
+//		"ca_cert": "/path/to/snippetbox/tls/cert.pem"
+//	}
+//
+// The ca_cert setting is only needed when the server uses a certificate which
+// isn't signed by a trusted authority, like the self-signed development
+// certificate.
+type Config struct {
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+	CACert string `json:"ca_cert"`
+}
+
+// The DefaultConfigPath() function returns the path of the configuration file
+// in the user's configuration directory, such as ~/.config/snippet/config.json
+// on Linux.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "snippet", "config.json"), nil
+}
+
+// The LoadConfig() function reads a configuration file. A missing file isn't
+// an error, and results in the default settings. Relative ca_cert paths are
+// resolved relative to the directory containing the configuration file.
+func LoadConfig(path string) (Config, error) {
+	cfg := Config{URL: "https://localhost:4000"}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+
+	err = json.Unmarshal(b, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	if cfg.CACert != "" && !filepath.IsAbs(cfg.CACert) {
+		cfg.CACert = filepath.Join(filepath.Dir(path), cfg.CACert)
+	}
+
+	return cfg, nil
+}
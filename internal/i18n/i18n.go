@@ -0,0 +1,202 @@
+// Package i18n translates the application's user-facing text. Each locale has
+// a catalog of messages, loaded from a JSON file like "locales/fr.json" which
+// maps message keys to text, and the locale for each request is chosen from
+// the user's preferences using golang.org/x/text/language.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// A Bundle holds the catalogs for every supported locale.
+type Bundle struct {
+	defaultLocale string
+	locales       []string
+	catalogs      map[string]*Catalog
+	matcher       language.Matcher
+}
+
+// A Catalog holds the messages for one locale. Messages missing from it are
+// taken from the default locale's catalog instead.
+type Catalog struct {
+	locale   string
+	messages map[string]string
+	fallback *Catalog
+}
+
+// The NewBundle() function loads a catalog from each "<locale>.json" file in
+// the dir directory of fsys. There must be one for defaultLocale, which is used
+// when none of a user's preferences can be met.
+func NewBundle(fsys fs.FS, dir, defaultLocale string) (*Bundle, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		defaultLocale: defaultLocale,
+		catalogs:      map[string]*Catalog{},
+	}
+
+	for _, file := range files {
+		locale := strings.TrimSuffix(path.Base(file), ".json")
+
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid locale: %w", file, err)
+		}
+		if tag.String() != locale {
+			return nil, fmt.Errorf("%s: locale should be written %q", file, tag.String())
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &Catalog{locale: locale}
+		err = json.Unmarshal(data, &c.messages)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		b.catalogs[locale] = c
+		b.locales = append(b.locales, locale)
+	}
+
+	def, ok := b.catalogs[defaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("no catalog for the default locale %q in %s", defaultLocale, dir)
+	}
+
+	// The default locale goes first, because the matcher falls back to the
+	// first tag it's given.
+	slices.Sort(b.locales)
+	b.locales = slices.DeleteFunc(b.locales, func(l string) bool { return l == defaultLocale })
+	b.locales = slices.Insert(b.locales, 0, defaultLocale)
+
+	tags := make([]language.Tag, len(b.locales))
+	for i, locale := range b.locales {
+		tags[i] = language.MustParse(locale)
+		if locale != defaultLocale {
+			b.catalogs[locale].fallback = def
+		}
+	}
+	b.matcher = language.NewMatcher(tags)
+
+	return b, nil
+}
+
+// The Locales() method returns the supported locales, default first.
+func (b *Bundle) Locales() []string {
+	return slices.Clone(b.locales)
+}
+
+// The DefaultLocale() method returns the locale used when nothing else fits.
+func (b *Bundle) DefaultLocale() string {
+	return b.defaultLocale
+}
+
+// The Match() method returns the supported locale which best fits the first
+// preference that can be met. Each preference is a language tag, like "fr",
+// or a list in the format of an Accept-Language header, like
+// "fr-CH, fr;q=0.9, en;q=0.8". Empty preferences are skipped, so callers can
+// pass them all in order of priority without checking which are set:
+//
+//	locale := bundle.Match(user.Language, r.Header.Get("Accept-Language"))
+func (b *Bundle) Match(preferences ...string) string {
+	for _, pref := range preferences {
+		if pref == "" {
+			continue
+		}
+
+		tags, _, err := language.ParseAcceptLanguage(pref)
+		if err != nil || len(tags) == 0 {
+			continue
+		}
+
+		_, index, confidence := b.matcher.Match(tags...)
+		if confidence != language.No {
+			return b.locales[index]
+		}
+	}
+
+	return b.defaultLocale
+}
+
+// The Catalog() method returns the catalog for a locale, or for the default
+// locale if it isn't supported.
+func (b *Bundle) Catalog(locale string) *Catalog {
+	c, ok := b.catalogs[locale]
+	if !ok {
+		return b.catalogs[b.defaultLocale]
+	}
+	return c
+}
+
+// The Missing() method returns, for each locale, any keys which are in one of
+// the other catalogs but not in its own.
+func (b *Bundle) Missing() map[string][]string {
+	all := map[string]bool{}
+	for _, c := range b.catalogs {
+		for key := range c.messages {
+			all[key] = true
+		}
+	}
+
+	missing := map[string][]string{}
+	for locale, c := range b.catalogs {
+		for key := range all {
+			if _, ok := c.messages[key]; !ok {
+				missing[locale] = append(missing[locale], key)
+			}
+		}
+		slices.Sort(missing[locale])
+	}
+
+	return missing
+}
+
+// The Locale() method returns the catalog's locale, like "en".
+func (c *Catalog) Locale() string {
+	return c.locale
+}
+
+// The Has() method reports whether there's a message for key, either in the
+// catalog or in the default locale's catalog.
+func (c *Catalog) Has(key string) bool {
+	_, ok := c.lookup(key)
+	return ok
+}
+
+// The T() method returns the message for key. If there are any args, the
+// message is used as a fmt.Sprintf() format string, like "This field cannot
+// be more than %d characters long". If there isn't a message for key at all,
+// the key itself is returned so that the problem is obvious on the page.
+func (c *Catalog) T(key string, args ...any) string {
+	msg, ok := c.lookup(key)
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+func (c *Catalog) lookup(key string) (string, bool) {
+	if msg, ok := c.messages[key]; ok {
+		return msg, true
+	}
+	if c.fallback != nil {
+		return c.fallback.lookup(key)
+	}
+	return "", false
+}
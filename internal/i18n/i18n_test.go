@@ -0,0 +1,126 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/ui"
+)
+
+// The TestCatalogsComplete test fails if any of the application's catalogs is
+// missing a message which another one has, so that a new message can't be
+// added in one language and forgotten in the others.
+func TestCatalogsComplete(t *testing.T) {
+	bundle, err := NewBundle(ui.Files, "locales", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bundle.Locales()) < 2 {
+		t.Errorf("got locales %v; want at least two", bundle.Locales())
+	}
+
+	for locale, keys := range bundle.Missing() {
+		for _, key := range keys {
+			t.Errorf("%s.json: missing %q", locale, key)
+		}
+	}
+}
+
+func newTestBundle(t *testing.T) *Bundle {
+	fsys := fstest.MapFS{
+		"locales/en.json":    {Data: []byte(`{"greeting": "Hello", "count": "%d snippets", "only.en": "English only"}`)},
+		"locales/fr.json":    {Data: []byte(`{"greeting": "Bonjour", "count": "%d extraits"}`)},
+		"locales/pt-BR.json": {Data: []byte(`{"greeting": "Olá"}`)},
+	}
+
+	bundle, err := NewBundle(fsys, "locales", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestMatch(t *testing.T) {
+	bundle := newTestBundle(t)
+
+	tests := []struct {
+		name        string
+		preferences []string
+		want        string
+	}{
+		{"No preferences", nil, "en"},
+		{"Exact", []string{"fr"}, "fr"},
+		{"Region", []string{"fr-CH"}, "fr"},
+		{"Accept-Language", []string{"de, fr;q=0.8, en;q=0.5"}, "fr"},
+		{"Quality order", []string{"en;q=0.5, fr"}, "fr"},
+		{"Unsupported", []string{"de"}, "en"},
+		{"First preference wins", []string{"pt-BR", "fr"}, "pt-BR"},
+		{"Empty preferences skipped", []string{"", "", "fr"}, "fr"},
+		{"Invalid", []string{"!!!", "fr"}, "fr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, bundle.Match(tt.preferences...), tt.want)
+		})
+	}
+}
+
+func TestCatalogT(t *testing.T) {
+	bundle := newTestBundle(t)
+	fr := bundle.Catalog("fr")
+
+	assert.Equal(t, fr.Locale(), "fr")
+	assert.Equal(t, fr.T("greeting"), "Bonjour")
+	assert.Equal(t, fr.T("count", 3), "3 extraits")
+
+	// Missing messages come from the default locale, and unknown keys are
+	// returned as they are.
+	assert.Equal(t, fr.T("only.en"), "English only")
+	assert.Equal(t, fr.Has("only.en"), true)
+	assert.Equal(t, fr.T("no.such.key"), "no.such.key")
+	assert.Equal(t, fr.Has("no.such.key"), false)
+
+	// Unsupported locales get the default catalog.
+	assert.Equal(t, bundle.Catalog("de").T("greeting"), "Hello")
+
+	missing := bundle.Missing()
+	assert.Equal(t, len(missing["en"]), 0)
+	assert.Equal(t, len(missing["fr"]), 1)
+	assert.Equal(t, len(missing["pt-BR"]), 2)
+}
+
+func TestNewBundleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "No default",
+			fsys: fstest.MapFS{"locales/fr.json": {Data: []byte(`{}`)}},
+		},
+		{
+			name: "Invalid JSON",
+			fsys: fstest.MapFS{"locales/en.json": {Data: []byte(`{"greeting": }`)}},
+		},
+		{
+			name: "Invalid locale",
+			fsys: fstest.MapFS{"locales/en.json": {Data: []byte(`{}`)}, "locales/not a locale.json": {Data: []byte(`{}`)}},
+		},
+		{
+			name: "Non-canonical locale",
+			fsys: fstest.MapFS{"locales/en.json": {Data: []byte(`{}`)}, "locales/pt-br.json": {Data: []byte(`{}`)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBundle(tt.fsys, "locales", "en")
+			if err == nil {
+				t.Error("got nil error; want error")
+			}
+		})
+	}
+}
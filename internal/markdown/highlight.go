@@ -0,0 +1,49 @@
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+var formatter = html.New(html.WithClasses(true))
+
+// KnownLanguage reports whether language is the name of a language that
+// Highlight() knows about, like "go", "Python" or "yaml".
+func KnownLanguage(language string) bool {
+	return lexers.Get(language) != nil
+}
+
+// Highlight returns src as highlighted HTML. The language is used to choose
+// how to highlight it; if it's "", the language is worked out from the file
+// name instead, and if that doesn't work the code is shown without any
+// highlighting. Like Render(), the output is sanitised.
+func Highlight(src, language, filename string) (template.HTML, error) {
+	var lexer chroma.Lexer
+	if language != "" {
+		lexer = lexers.Get(language)
+	} else {
+		lexer = lexers.Match(filename)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, src)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+
+	err = formatter.Format(&buf, styles.Get(Style), iterator)
+	if err != nil {
+		return "", err
+	}
+
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
@@ -0,0 +1,72 @@
+// Package markdown renders snippets written in Markdown, and highlights the
+// code in snippets' files, as HTML which is safe to include in a page.
+//
+// The Markdown is converted with goldmark, which leaves out any raw HTML in
+// the source, and the result is then passed through a strict bluemonday
+// policy. The second step is what makes the output safe: it only lets
+// through the elements and attributes that Markdown can produce, so even a
+// bug in the Markdown renderer can't be used to put a <script> element or an
+// onclick attribute on the page.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"regexp"
+
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Style is the name of the chroma style used for highlighting fenced code
+// blocks. The highlighted code uses CSS classes rather than inline styles, so
+// that it works with our Content-Security-Policy, and WriteCSS() writes the
+// rules for those classes.
+const Style = "github"
+
+var md = goldmark.New(
+	goldmark.WithExtensions(
+		extension.Table,
+		extension.Strikethrough,
+		extension.Linkify,
+		highlighting.NewHighlighting(
+			highlighting.WithStyle(Style),
+			highlighting.WithFormatOptions(html.WithClasses(true)),
+		),
+	),
+)
+
+var policy = newPolicy()
+
+// The newPolicy() function returns the sanitiser policy. It starts from
+// bluemonday's policy for user-generated content, and additionally allows
+// the classes which the highlighter puts on code blocks.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-z0-9]+( [a-z0-9]+)*$`)).OnElements("pre", "code", "span")
+	return p
+}
+
+// Render converts Markdown source to sanitised HTML.
+func Render(src string) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	err := md.Convert([]byte(src), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	// This is the only place that HTML from a snippet is trusted, and only
+	// because it has just been sanitised.
+	return template.HTML(policy.SanitizeBytes(buf.Bytes())), nil
+}
+
+// WriteCSS writes the stylesheet for highlighted code blocks to w.
+func WriteCSS(w io.Writer) error {
+	return html.New(html.WithClasses(true)).WriteCSS(w, styles.Get(Style))
+}
@@ -0,0 +1,200 @@
+package markdown
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "Heading",
+			src:  "# Restart",
+			want: []string{"<h1>Restart</h1>"},
+		},
+		{
+			name: "Emphasis",
+			src:  "Run **this** and ~~that~~",
+			want: []string{"<strong>this</strong>", "<del>that</del>"},
+		},
+		{
+			name: "Table",
+			src:  "| a | b |\n|---|---|\n| 1 | 2 |",
+			want: []string{"<table>", "<td>1</td>"},
+		},
+		{
+			name: "Link",
+			src:  "[docs](https://example.com/docs)",
+			want: []string{`<a href="https://example.com/docs" rel="nofollow">docs</a>`},
+		},
+		{
+			name: "Autolink",
+			src:  "See https://example.com",
+			want: []string{`<a href="https://example.com" rel="nofollow">https://example.com</a>`},
+		},
+		{
+			name: "Highlighted code",
+			src:  "```go\nfunc main() {}\n```",
+			want: []string{`<pre class="chroma">`, `<span class="kd">func</span>`},
+		},
+		{
+			name: "Unknown language",
+			src:  "```nosuchlanguage\n<b>bold</b>\n```",
+			want: []string{"<pre><code>&lt;b&gt;bold&lt;/b&gt;\n</code></pre>"},
+		},
+		{
+			name: "Escaped code",
+			src:  "```html\n<script>alert(1)</script>\n```",
+			want: []string{"&lt;", "script"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Render(tt.src)
+			assert.NilError(t, err)
+
+			for _, want := range tt.want {
+				assert.StringContains(t, string(out), want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		language string
+		filename string
+		want     string
+	}{
+		{
+			name:     "Language",
+			src:      "func main() {}",
+			language: "go",
+			filename: "main.txt",
+			want:     `<span class="kd">func</span>`,
+		},
+		{
+			name:     "File name",
+			src:      "func main() {}",
+			filename: "main.go",
+			want:     `<span class="kd">func</span>`,
+		},
+		{
+			name:     "Unknown",
+			src:      "<b>bold</b>",
+			filename: "notes",
+			want:     "&lt;b&gt;bold&lt;/b&gt;",
+		},
+		{
+			name:     "Escaped",
+			src:      "</pre><script>alert(1)</script>",
+			language: "html",
+			want:     "&lt;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Highlight(tt.src, tt.language, tt.filename)
+			assert.NilError(t, err)
+			assert.StringContains(t, string(out), `<pre class="chroma">`)
+			assert.StringContains(t, string(out), tt.want)
+
+			if strings.Contains(string(out), "<script") {
+				t.Errorf("got %q; want no <script> element", out)
+			}
+		})
+	}
+}
+
+func TestKnownLanguage(t *testing.T) {
+	assert.Equal(t, KnownLanguage("go"), true)
+	assert.Equal(t, KnownLanguage("YAML"), true)
+	assert.Equal(t, KnownLanguage("nosuchlanguage"), false)
+}
+
+// The TestRenderXSS test is a regression test for well-known XSS payloads.
+// The output is parsed as HTML, and may not contain any element, attribute or
+// URL which could run script or change the page. Payloads which survive as
+// escaped text are fine.
+func TestRenderXSS(t *testing.T) {
+	payloads := []struct {
+		name string
+		src  string
+	}{
+		{"Script element", "<script>alert(1)</script>"},
+		{"Mixed case script", "<ScRiPt>alert(1)</sCrIpT>"},
+		{"Image onerror", `<img src=x onerror=alert(1)>`},
+		{"SVG onload", `<svg onload=alert(1)>`},
+		{"Iframe", `<iframe src="javascript:alert(1)"></iframe>`},
+		{"Inline link", "<a href=\"javascript:alert(1)\">click</a>"},
+		{"Markdown link", "[click](javascript:alert(1))"},
+		{"Encoded scheme", "[click](&#106;avascript:alert(1))"},
+		{"Tab in scheme", "[click](java\tscript:alert(1))"},
+		{"Data URL", "[click](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)"},
+		{"VBScript", "[click](vbscript:msgbox(1))"},
+		{"Reference link", "[click][x]\n\n[x]: javascript:alert(1)"},
+		{"Image", "![x](javascript:alert(1))"},
+		{"Attribute breakout", `[click](https://example.com/"onmouseover="alert(1))`},
+		{"Title breakout", `[click](https://example.com "x" onmouseover="alert(1)")`},
+		{"Code fence info", "```go\" onmouseover=\"alert(1)\nx\n```"},
+		{"Code fence attributes", "```go {onmouseover=\"alert(1)\" style=\"x\"}\nx\n```"},
+		{"Style element", "<style>body{display:none}</style>"},
+		{"Style attribute", `<p style="background:url(javascript:alert(1))">x</p>`},
+		{"Form", `<form action="https://example.com"><input name="x"></form>`},
+		{"Meta refresh", `<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`},
+		{"Object", `<object data="javascript:alert(1)"></object>`},
+		{"HTML comment", "<!--><script>alert(1)</script>-->"},
+		{"Closing code", "`</code><script>alert(1)</script>`"},
+		{"Table cell", "| a |\n|---|\n| <img src=x onerror=alert(1)> |"},
+	}
+
+	forbiddenElements := []string{"script", "svg", "iframe", "style", "form", "input", "meta", "object", "embed", "base", "link"}
+
+	for _, tt := range payloads {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Render(tt.src)
+			assert.NilError(t, err)
+
+			z := html.NewTokenizer(strings.NewReader(string(out)))
+			for {
+				tokenType := z.Next()
+				if tokenType == html.ErrorToken {
+					break
+				}
+				if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+					continue
+				}
+
+				token := z.Token()
+				if slices.Contains(forbiddenElements, token.Data) {
+					t.Errorf("got %q; contains a %s element", out, token.Data)
+				}
+
+				for _, attr := range token.Attr {
+					if strings.HasPrefix(attr.Key, "on") || attr.Key == "style" {
+						t.Errorf("got %q; contains a %s attribute", out, attr.Key)
+					}
+					if attr.Key == "href" || attr.Key == "src" {
+						u, err := url.Parse(attr.Val)
+						if err != nil || (u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto") {
+							t.Errorf("got %q; contains an unsafe URL %q", out, attr.Val)
+						}
+					}
+				}
+			}
+		})
+	}
+}
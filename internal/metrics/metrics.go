@@ -0,0 +1,356 @@
+// Package metrics is a small collector for application metrics, which it
+// exposes in the Prometheus text exposition format. It supports counters,
+// gauges and histograms with labels, plus gauges and counters whose values are
+// read from a function when the metrics are scraped. That covers everything
+// the application needs without depending on the full Prometheus client.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, which are suitable for
+// timing most HTTP requests.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// A Registry holds a set of metrics and writes them out in the order in which
+// they were registered.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func (reg *Registry) register(m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.metrics = append(reg.metrics, m)
+}
+
+// The WriteTo() method writes every metric in the registry to w in the
+// Prometheus text format.
+func (reg *Registry) WriteTo(w io.Writer) (int64, error) {
+	reg.mu.Lock()
+	metrics := slices.Clone(reg.metrics)
+	reg.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// The Handler() method returns a handler which serves the metrics to a
+// Prometheus server.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		reg.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// The desc type holds the parts which every metric has in common.
+type desc struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+}
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.typ)
+}
+
+// The key() method checks that the right number of label values have been
+// given and joins them into a map key. Passing the wrong number of values is
+// a programming error, so we panic, just like the Prometheus client does.
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("metrics: %s has %d labels but got %d values", d.name, len(d.labelNames), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// The labels() helper formats label names and values like {a="1",b="2"}. Any
+// extra name/value pairs (such as the le label on histogram buckets) are
+// appended to the end.
+func labels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, names[i], escape.Replace(values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extra[i], escape.Replace(extra[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// A valueVec holds one float64 value for each combination of label values.
+// It is the storage behind both counters and gauges.
+type valueVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+func (v *valueVec) add(delta float64, labelValues []string) {
+	k := v.key(labelValues)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.labels[k]; !ok {
+		v.labels[k] = slices.Clone(labelValues)
+	}
+	v.values[k] += delta
+}
+
+func (v *valueVec) set(value float64, labelValues []string) {
+	k := v.key(labelValues)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, ok := v.labels[k]; !ok {
+		v.labels[k] = slices.Clone(labelValues)
+	}
+	v.values[k] = value
+}
+
+func (v *valueVec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w)
+
+	// A metric without labels is always reported, even before it has been
+	// incremented, so that a scraper can tell zero from missing.
+	if len(v.labelNames) == 0 && len(v.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", v.name)
+		return
+	}
+
+	for _, k := range sortedKeys(v.values) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, labels(v.labelNames, v.labels[k]), formatFloat(v.values[k]))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newValueVec(name, help, typ string, labelNames []string) *valueVec {
+	return &valueVec{
+		desc:   desc{name: name, help: help, typ: typ, labelNames: labelNames},
+		values: make(map[string]float64),
+		labels: make(map[string][]string),
+	}
+}
+
+// A Counter is a value which only ever goes up, such as a number of requests.
+type Counter struct {
+	v *valueVec
+}
+
+// The NewCounter() method registers a counter with the given label names.
+func (reg *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{v: newValueVec(name, help, "counter", labelNames)}
+	reg.register(c.v)
+	return c
+}
+
+// The Inc() method adds one to the counter for the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.v.add(1, labelValues)
+}
+
+// The Add() method adds a positive amount to the counter.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.v.add(delta, labelValues)
+}
+
+// A Gauge is a value which can go up and down, such as a number of requests
+// currently being handled.
+type Gauge struct {
+	v *valueVec
+}
+
+// The NewGauge() method registers a gauge with the given label names.
+func (reg *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{v: newValueVec(name, help, "gauge", labelNames)}
+	reg.register(g.v)
+	return g
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.v.add(1, labelValues)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.v.add(-1, labelValues)
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.v.set(value, labelValues)
+}
+
+// A funcMetric reads its value from a function each time the metrics are
+// written. It's useful for reporting values which are already tracked
+// elsewhere, like database connection pool statistics.
+type funcMetric struct {
+	desc
+	fn func() float64
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+}
+
+// The NewGaugeFunc() method registers a gauge whose value is returned by fn.
+func (reg *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	reg.register(&funcMetric{desc: desc{name: name, help: help, typ: "gauge"}, fn: fn})
+}
+
+// The NewCounterFunc() method registers a counter whose value is returned by
+// fn. The function must never return a smaller value than it did before.
+func (reg *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	reg.register(&funcMetric{desc: desc{name: name, help: help, typ: "counter"}, fn: fn})
+}
+
+// A Histogram counts observations, such as request durations, in buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// The NewHistogram() method registers a histogram with the given upper
+// bucket bounds, which must be sorted in increasing order. A final +Inf
+// bucket is always added.
+func (reg *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name: name, help: help, typ: "histogram", labelNames: labelNames},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	reg.register(h)
+	return h
+}
+
+// The Observe() method records a single observation.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	k := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[k]
+	if !ok {
+		s = &histogramSeries{labels: slices.Clone(labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+
+	// Only the first bucket which the value fits in is incremented here. The
+	// counts are made cumulative when they are written out.
+	i := sort.SearchFloat64s(h.buckets, value)
+	if i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+
+	for _, k := range sortedKeys(h.series) {
+		s := h.series[k]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(h.labelNames, s.labels, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(h.labelNames, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels(h.labelNames, s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels(h.labelNames, s.labels), s.count)
+	}
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+
+	requests := reg.NewCounter("requests_total", "Total requests.", "route", "status")
+	inFlight := reg.NewGauge("in_flight", "Requests in flight.")
+	reg.NewCounter("panics_total", "Panics\nrecovered.")
+	duration := reg.NewHistogram("duration_seconds", "Request duration.", []float64{0.1, 1}, "route")
+	reg.NewGaugeFunc("open_connections", "Open connections.", func() float64 { return 3 })
+
+	requests.Inc("/snippet/view/{id}", "200")
+	requests.Inc("/snippet/view/{id}", "200")
+	requests.Add(2, "/", "404")
+	requests.Inc(`a"b\c`, "500")
+
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+
+	duration.Observe(0.05, "/")
+	duration.Observe(0.1, "/")
+	duration.Observe(0.5, "/")
+	duration.Observe(3, "/")
+
+	var b strings.Builder
+	_, err := reg.WriteTo(&b)
+	assert.NilError(t, err)
+
+	want := `# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{route="/snippet/view/{id}",status="200"} 2
+requests_total{route="/",status="404"} 2
+requests_total{route="a\"b\\c",status="500"} 1
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP panics_total Panics\nrecovered.
+# TYPE panics_total counter
+panics_total 0
+# HELP duration_seconds Request duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/",le="0.1"} 2
+duration_seconds_bucket{route="/",le="1"} 3
+duration_seconds_bucket{route="/",le="+Inf"} 4
+duration_seconds_sum{route="/"} 3.65
+duration_seconds_count{route="/"} 4
+# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections 3
+`
+	assert.Equal(t, b.String(), want)
+}
+
+func TestHandler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("requests_total", "Total requests.").Inc()
+
+	rr := httptest.NewRecorder()
+	r, err := http.NewRequest(http.MethodGet, "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg.Handler().ServeHTTP(rr, r)
+
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, rr.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8")
+	assert.StringContains(t, rr.Body.String(), "requests_total 1\n")
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("requests_total", "Total requests.", "route")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("got no panic; want panic")
+		}
+	}()
+
+	c.Inc("/", "200")
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type AuditModelInterface interface {
+	Insert(ctx context.Context, actorID int, action, target, detail string) error
+	Latest(ctx context.Context) ([]AuditEntry, error)
+}
+
+// Define an AuditEntry type to hold a record of a privileged action, such as
+// an admin disabling a user.
+type AuditEntry struct {
+	ID         int
+	ActorID    int
+	ActorEmail string
+	Action     string
+	Target     string
+	Detail     string
+	Created    time.Time
+}
+
+// Define an AuditModel type which wraps a sql.DB connection pool.
+type AuditModel struct {
+	DB *sql.DB
+}
+
+const insertAuditStmt = `INSERT INTO audit_log (actor_id, action, target, detail, created)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP())`
+
+// The Insert method adds a new entry to the audit trail.
+func (m *AuditModel) Insert(ctx context.Context, actorID int, action, target, detail string) error {
+	_, err := m.DB.ExecContext(ctx, insertAuditStmt, actorID, action, target, detail)
+	return err
+}
+
+// The insertAuditEntry() function adds an entry to the audit trail as part of
+// a transaction, so that an action and the record of it are saved together
+// or not at all. Only the ActorID, Action, Target and Detail fields of the
+// entry are used. If e is nil, nothing is recorded.
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, e *AuditEntry) error {
+	if e == nil {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, insertAuditStmt, e.ActorID, e.Action, e.Target, e.Detail)
+	return err
+}
+
+// This will return the 100 most recent audit trail entries, along with the
+// email address of the user who performed each action.
+func (m *AuditModel) Latest(ctx context.Context) ([]AuditEntry, error) {
+	stmt := `SELECT a.id, a.actor_id, COALESCE(u.email, ''), a.action, a.target, a.detail, a.created
+	FROM audit_log a LEFT JOIN users u ON u.id = a.actor_id
+	ORDER BY a.id DESC LIMIT 100`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+
+	for rows.Next() {
+		var e AuditEntry
+
+		err = rows.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.Action, &e.Target, &e.Detail, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,279 @@
+package models
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// The CachedSnippetModel type wraps a SnippetModelInterface, keeping the
+// results of Get() and Latest() in memory so that the most popular snippets
+// and the home page don't need a database query on every request.
+//
+// The cache holds at most size entries, evicting the least recently used
+// when it's full. An entry is kept for at most ttl, and never past the
+// expiry time of any snippet in it, so an expired snippet is never served
+// from the cache. Concurrent misses for the same entry are collapsed into a
+// single database query.
+//
+// Calls to Insert(), Update(), Delete() and Fork() invalidate the affected
+// entries. That only works within this process, though: if several instances
+// of the application share a database then a change made by one of them can
+// take up to ttl to be seen by the others.
+type CachedSnippetModel struct {
+	next SnippetModelInterface
+	size int
+	ttl  time.Duration
+
+	// The now function returns the current time. It's a field so that tests
+	// can control the clock.
+	now func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+
+	// The generation is incremented every time entries are invalidated.
+	// Loads which started in an earlier generation may have read data which
+	// is now stale, so their results aren't stored.
+	generation uint64
+
+	group  singleflight.Group
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+// The CacheStats type reports how effective the cache has been.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+func NewCachedSnippetModel(next SnippetModelInterface, size int, ttl time.Duration) *CachedSnippetModel {
+	return &CachedSnippetModel{
+		next:    next,
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// The Stats() method returns the number of cache hits and misses so far.
+func (m *CachedSnippetModel) Stats() CacheStats {
+	return CacheStats{Hits: m.hits.Load(), Misses: m.misses.Load()}
+}
+
+// The lookup() method returns the cached value for key, if there is one and
+// it hasn't expired.
+func (m *CachedSnippetModel) lookup(key string) (any, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !m.now().Before(entry.expires) {
+		m.lru.Remove(elem)
+		delete(m.entries, key)
+		return nil, false
+	}
+
+	m.lru.MoveToFront(elem)
+	return entry.value, true
+}
+
+// The store() method adds a value to the cache, unless the entries have been
+// invalidated since the value was loaded in generation gen.
+func (m *CachedSnippetModel) store(key string, value any, expires time.Time, gen uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if gen != m.generation || !m.now().Before(expires) {
+		return
+	}
+
+	if elem, ok := m.entries[key]; ok {
+		elem.Value = &cacheEntry{key: key, value: value, expires: expires}
+		m.lru.MoveToFront(elem)
+		return
+	}
+
+	m.entries[key] = m.lru.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+
+	for m.lru.Len() > m.size {
+		oldest := m.lru.Back()
+		m.lru.Remove(oldest)
+		delete(m.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// The invalidate() method removes the given entries from the cache, and
+// starts a new generation so that loads already in flight don't store their
+// results.
+func (m *CachedSnippetModel) invalidate(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.generation++
+	for _, key := range keys {
+		if elem, ok := m.entries[key]; ok {
+			m.lru.Remove(elem)
+			delete(m.entries, key)
+		}
+	}
+}
+
+// The load() method returns the cached value for key, or calls fetch to get
+// it from the underlying model. The fetch function returns the value and the
+// time it stops being valid. Errors are never cached.
+//
+// Callers which miss at the same time share one call to fetch. It runs with
+// the first caller's context values, like its trace span, but isn't
+// cancelled when that caller goes away, since other callers may be waiting
+// for it.
+func (m *CachedSnippetModel) load(ctx context.Context, key string, fetch func(ctx context.Context) (any, time.Time, error)) (any, error) {
+	if value, ok := m.lookup(key); ok {
+		m.hits.Add(1)
+		return value, nil
+	}
+	m.misses.Add(1)
+
+	m.mu.Lock()
+	gen := m.generation
+	m.mu.Unlock()
+
+	// Include the generation in the singleflight key, so that nobody joins a
+	// load which started before an invalidation.
+	value, err, _ := m.group.Do(fmt.Sprintf("%s@%d", key, gen), func() (any, error) {
+		value, expires, err := fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		if ttlExpires := m.now().Add(m.ttl); ttlExpires.Before(expires) {
+			expires = ttlExpires
+		}
+		m.store(key, value, expires, gen)
+
+		return value, nil
+	})
+
+	return value, err
+}
+
+func snippetCacheKey(id int) string {
+	return fmt.Sprintf("snippet:%d", id)
+}
+
+const latestCacheKey = "latest"
+
+// The cloneSnippet() function returns a copy of a cached snippet which
+// doesn't share its Files or Tags with the cache, so that a caller can't
+// modify the cached snippet through them.
+func cloneSnippet(s Snippet) Snippet {
+	s.Files = slices.Clone(s.Files)
+	s.Tags = slices.Clone(s.Tags)
+	return s
+}
+
+func (m *CachedSnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
+	value, err := m.load(ctx, snippetCacheKey(id), func(ctx context.Context) (any, time.Time, error) {
+		s, err := m.next.Get(ctx, id)
+		return s, s.Expires, err
+	})
+	if err != nil {
+		return Snippet{}, err
+	}
+	return cloneSnippet(value.(Snippet)), nil
+}
+
+func (m *CachedSnippetModel) Latest(ctx context.Context) ([]Snippet, error) {
+	value, err := m.load(ctx, latestCacheKey, func(ctx context.Context) (any, time.Time, error) {
+		snippets, err := m.next.Latest(ctx)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		// The list is only valid until the first of its snippets expires.
+		expires := m.now().Add(m.ttl)
+		for _, s := range snippets {
+			if s.Expires.Before(expires) {
+				expires = s.Expires
+			}
+		}
+		return snippets, expires, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Return a copy, so that a caller can't modify the cached slice or the
+	// snippets in it.
+	cached := value.([]Snippet)
+
+	snippets := make([]Snippet, len(cached))
+	for i, s := range cached {
+		snippets[i] = cloneSnippet(s)
+	}
+	return snippets, nil
+}
+
+func (m *CachedSnippetModel) LatestByUser(ctx context.Context, userID int) ([]Snippet, error) {
+	return m.next.LatestByUser(ctx, userID)
+}
+
+func (m *CachedSnippetModel) LatestByTag(ctx context.Context, tag string) ([]Snippet, error) {
+	return m.next.LatestByTag(ctx, tag)
+}
+
+func (m *CachedSnippetModel) Page(ctx context.Context, page, pageSize int) ([]Snippet, int, error) {
+	return m.next.Page(ctx, page, pageSize)
+}
+
+func (m *CachedSnippetModel) Insert(ctx context.Context, userID int, title string, content string, format string, files []SnippetFile, tags []string, expires int) (int, error) {
+	id, err := m.next.Insert(ctx, userID, title, content, format, files, tags, expires)
+	m.invalidate(latestCacheKey)
+	return id, err
+}
+
+func (m *CachedSnippetModel) Update(ctx context.Context, id int, title string, content string, format string, files []SnippetFile, tags []string, expires int) error {
+	err := m.next.Update(ctx, id, title, content, format, files, tags, expires)
+	m.invalidate(snippetCacheKey(id), latestCacheKey)
+	return err
+}
+
+func (m *CachedSnippetModel) Delete(ctx context.Context, id int, audit *AuditEntry) error {
+	err := m.next.Delete(ctx, id, audit)
+	m.invalidate(snippetCacheKey(id), latestCacheKey)
+	return err
+}
+
+// Forking a snippet adds a new one to the latest snippets. The original
+// snippet's cache entry is unaffected, because the number of forks isn't
+// cached.
+func (m *CachedSnippetModel) Fork(ctx context.Context, id int, userID int, expires int) (int, error) {
+	forkID, err := m.next.Fork(ctx, id, userID, expires)
+	m.invalidate(latestCacheKey)
+	return forkID, err
+}
+
+func (m *CachedSnippetModel) ForkCount(ctx context.Context, id int) (int, error) {
+	return m.next.ForkCount(ctx, id)
+}
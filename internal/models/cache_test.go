@@ -0,0 +1,372 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+// The fakeSnippetModel type is a SnippetModelInterface which counts how often
+// it's called. If gate is set, Get() and Latest() wait for it to be closed
+// before returning, so that tests can hold loads in flight.
+type fakeSnippetModel struct {
+	snippets map[int]Snippet
+	gate     chan struct{}
+
+	getCalls    atomic.Int64
+	latestCalls atomic.Int64
+}
+
+func (m *fakeSnippetModel) wait() {
+	if m.gate != nil {
+		<-m.gate
+	}
+}
+
+func (m *fakeSnippetModel) Insert(ctx context.Context, userID int, title string, content string, format string, files []SnippetFile, tags []string, expires int) (int, error) {
+	return 99, nil
+}
+
+func (m *fakeSnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
+	m.getCalls.Add(1)
+	m.wait()
+	s, ok := m.snippets[id]
+	if !ok {
+		return Snippet{}, ErrNoRecord
+	}
+	return s, nil
+}
+
+func (m *fakeSnippetModel) Latest(ctx context.Context) ([]Snippet, error) {
+	m.latestCalls.Add(1)
+	m.wait()
+	var snippets []Snippet
+	for _, s := range m.snippets {
+		snippets = append(snippets, s)
+	}
+	return snippets, nil
+}
+
+func (m *fakeSnippetModel) LatestByUser(ctx context.Context, userID int) ([]Snippet, error) {
+	return nil, nil
+}
+
+func (m *fakeSnippetModel) LatestByTag(ctx context.Context, tag string) ([]Snippet, error) {
+	return nil, nil
+}
+
+func (m *fakeSnippetModel) Page(ctx context.Context, page, pageSize int) ([]Snippet, int, error) {
+	return nil, 0, nil
+}
+
+func (m *fakeSnippetModel) Update(ctx context.Context, id int, title string, content string, format string, files []SnippetFile, tags []string, expires int) error {
+	return nil
+}
+
+func (m *fakeSnippetModel) Delete(ctx context.Context, id int, audit *AuditEntry) error {
+	return nil
+}
+
+func (m *fakeSnippetModel) Fork(ctx context.Context, id int, userID int, expires int) (int, error) {
+	return 0, nil
+}
+
+func (m *fakeSnippetModel) ForkCount(ctx context.Context, id int) (int, error) {
+	return 0, nil
+}
+
+// The testClock type is a clock which only moves when the test says so.
+type testClock struct {
+	now atomic.Int64
+}
+
+func newTestClock() *testClock {
+	c := &testClock{}
+	c.now.Store(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC).UnixNano())
+	return c
+}
+
+func (c *testClock) Now() time.Time {
+	return time.Unix(0, c.now.Load()).UTC()
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now.Add(int64(d))
+}
+
+func newTestCache(t *testing.T, size int, ttl time.Duration) (*CachedSnippetModel, *fakeSnippetModel, *testClock) {
+	clock := newTestClock()
+
+	backend := &fakeSnippetModel{snippets: map[int]Snippet{
+		1: {ID: 1, Title: "One", Expires: clock.Now().Add(time.Hour)},
+		2: {ID: 2, Title: "Two", Expires: clock.Now().Add(time.Hour)},
+		3: {ID: 3, Title: "Three", Expires: clock.Now().Add(time.Hour)},
+		4: {ID: 4, Title: "Soon", Expires: clock.Now().Add(5 * time.Second)},
+	}}
+
+	cache := NewCachedSnippetModel(backend, size, ttl)
+	cache.now = clock.Now
+
+	return cache, backend, clock
+}
+
+func TestCachedSnippetModelGet(t *testing.T) {
+	cache, backend, clock := newTestCache(t, 10, time.Minute)
+	ctx := context.Background()
+
+	for range 3 {
+		s, err := cache.Get(ctx, 1)
+		assert.NilError(t, err)
+		assert.Equal(t, s.Title, "One")
+	}
+	assert.Equal(t, backend.getCalls.Load(), int64(1))
+	assert.Equal(t, cache.Stats(), CacheStats{Hits: 2, Misses: 1})
+
+	// Errors aren't cached.
+	for range 2 {
+		_, err := cache.Get(ctx, 42)
+		assert.Equal(t, err, ErrNoRecord)
+	}
+	assert.Equal(t, backend.getCalls.Load(), int64(3))
+
+	// Once the TTL has passed, the snippet is fetched again.
+	clock.Advance(time.Minute)
+	cache.Get(ctx, 1)
+	assert.Equal(t, backend.getCalls.Load(), int64(4))
+}
+
+func TestCachedSnippetModelExpires(t *testing.T) {
+	cache, backend, clock := newTestCache(t, 10, time.Minute)
+	ctx := context.Background()
+
+	// Snippet 4 expires in 5 seconds, so it can't be cached for the full
+	// minute.
+	cache.Get(ctx, 4)
+	cache.Get(ctx, 4)
+	assert.Equal(t, backend.getCalls.Load(), int64(1))
+
+	clock.Advance(5 * time.Second)
+	cache.Get(ctx, 4)
+	assert.Equal(t, backend.getCalls.Load(), int64(2))
+
+	// The same goes for the list of latest snippets, which includes it.
+	clock = newTestClock()
+	cache.now = clock.Now
+	cache.Latest(ctx)
+	cache.Latest(ctx)
+	assert.Equal(t, backend.latestCalls.Load(), int64(1))
+
+	clock.Advance(5 * time.Second)
+	cache.Latest(ctx)
+	assert.Equal(t, backend.latestCalls.Load(), int64(2))
+}
+
+func TestCachedSnippetModelEviction(t *testing.T) {
+	cache, backend, _ := newTestCache(t, 2, time.Minute)
+	ctx := context.Background()
+
+	cache.Get(ctx, 1)
+	cache.Get(ctx, 2)
+	cache.Get(ctx, 1) // Snippet 2 is now the least recently used.
+	cache.Get(ctx, 3) // So adding snippet 3 evicts it.
+	assert.Equal(t, backend.getCalls.Load(), int64(3))
+
+	cache.Get(ctx, 1)
+	assert.Equal(t, backend.getCalls.Load(), int64(3))
+
+	cache.Get(ctx, 2)
+	assert.Equal(t, backend.getCalls.Load(), int64(4))
+}
+
+func TestCachedSnippetModelInvalidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		change     func(m *CachedSnippetModel) error
+		wantGet    int64
+		wantLatest int64
+	}{
+		{
+			name: "Insert",
+			change: func(m *CachedSnippetModel) error {
+				_, err := m.Insert(context.Background(), 1, "New", "Content", FormatCode, nil, nil, 7)
+				return err
+			},
+			wantGet:    1,
+			wantLatest: 2,
+		},
+		{
+			name: "Update",
+			change: func(m *CachedSnippetModel) error {
+				return m.Update(context.Background(), 1, "Changed", "Content", FormatCode, nil, nil, 7)
+			},
+			wantGet:    2,
+			wantLatest: 2,
+		},
+		{
+			name: "Delete",
+			change: func(m *CachedSnippetModel) error {
+				return m.Delete(context.Background(), 1, nil)
+			},
+			wantGet:    2,
+			wantLatest: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, backend, _ := newTestCache(t, 10, time.Minute)
+			ctx := context.Background()
+
+			cache.Get(ctx, 1)
+			cache.Latest(ctx)
+
+			err := tt.change(cache)
+			assert.NilError(t, err)
+
+			cache.Get(ctx, 1)
+			cache.Latest(ctx)
+
+			assert.Equal(t, backend.getCalls.Load(), tt.wantGet)
+			assert.Equal(t, backend.latestCalls.Load(), tt.wantLatest)
+		})
+	}
+}
+
+// The waitFor() helper waits until cond returns true, failing the test if it
+// takes too long.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCachedSnippetModelConcurrentMisses(t *testing.T) {
+	cache, backend, _ := newTestCache(t, 10, time.Minute)
+	backend.gate = make(chan struct{})
+
+	const callers = 50
+
+	var wg sync.WaitGroup
+	titles := make([]string, callers)
+
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := cache.Get(context.Background(), 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			titles[i] = s.Title
+		}()
+	}
+
+	// Hold the database call until every caller has missed, and give them a
+	// moment to join it.
+	waitFor(t, func() bool { return cache.Stats().Misses == callers })
+	time.Sleep(10 * time.Millisecond)
+	close(backend.gate)
+	wg.Wait()
+
+	assert.Equal(t, backend.getCalls.Load(), int64(1))
+	for _, title := range titles {
+		assert.Equal(t, title, "One")
+	}
+}
+
+func TestCachedSnippetModelInvalidateDuringLoad(t *testing.T) {
+	cache, backend, _ := newTestCache(t, 10, time.Minute)
+	ctx := context.Background()
+
+	// The getInFlight() helper starts a Get() which is held in the database
+	// call, and returns a channel which is closed once it has finished.
+	getInFlight := func(wantCalls int64) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			cache.Get(ctx, 1)
+		}()
+		waitFor(t, func() bool { return backend.getCalls.Load() == wantCalls })
+		return done
+	}
+
+	// If the snippet changes while a load is in flight, the result of that
+	// load may be the old version, so it isn't stored.
+	backend.gate = make(chan struct{})
+	done := getInFlight(1)
+
+	err := cache.Update(ctx, 1, "Changed", "Content", FormatCode, nil, nil, 7)
+	assert.NilError(t, err)
+
+	close(backend.gate)
+	<-done
+
+	_, ok := cache.lookup(snippetCacheKey(1))
+	assert.Equal(t, ok, false)
+
+	// Callers which arrive after the change don't join the old load either,
+	// but make a new database call.
+	backend.gate = make(chan struct{})
+	first := getInFlight(2)
+
+	err = cache.Delete(ctx, 1, nil)
+	assert.NilError(t, err)
+
+	second := getInFlight(3)
+
+	close(backend.gate)
+	<-first
+	<-second
+}
+
+func TestCachedSnippetModelLatestCopy(t *testing.T) {
+	cache, _, _ := newTestCache(t, 10, time.Minute)
+	ctx := context.Background()
+
+	first, err := cache.Latest(ctx)
+	assert.NilError(t, err)
+	first[0].Title = "Modified"
+
+	second, err := cache.Latest(ctx)
+	assert.NilError(t, err)
+	for _, s := range second {
+		if s.Title == "Modified" {
+			t.Error("cached slice was modified by a caller")
+		}
+	}
+}
+
+func TestCachedSnippetModelGetCopy(t *testing.T) {
+	cache, backend, clock := newTestCache(t, 10, time.Minute)
+	ctx := context.Background()
+
+	backend.snippets[1] = Snippet{
+		ID:      1,
+		Title:   "One",
+		Files:   []SnippetFile{{Name: "main.go", Content: "package main"}},
+		Tags:    []string{"go"},
+		Expires: clock.Now().Add(time.Hour),
+	}
+
+	first, err := cache.Get(ctx, 1)
+	assert.NilError(t, err)
+	first.Files[0].Name = "Modified"
+	first.Tags[0] = "modified"
+
+	second, err := cache.Get(ctx, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, second.Files[0].Name, "main.go")
+	assert.Equal(t, second.Tags[0], "go")
+	assert.Equal(t, backend.getCalls.Load(), int64(1))
+}
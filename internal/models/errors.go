@@ -7,4 +7,6 @@ var (
 	ErrNoRecord           = errors.New("models: no matching record found")
 	ErrInvalidCredentials = errors.New("models: invalid credentials")
 	ErrDuplicateEmail     = errors.New("models: duplicate email")
+	ErrLinkRequired       = errors.New("models: identity must be linked to existing account")
+	ErrDuplicateIdentity  = errors.New("models: identity linked to another user")
 )
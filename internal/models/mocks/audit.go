@@ -0,0 +1,49 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"snippetbox.example.com/internal/models"
+)
+
+// The AuditModel mock keeps its entries in memory, so that tests can check
+// that admin actions are recorded.
+type AuditModel struct {
+	mu      sync.Mutex
+	entries []models.AuditEntry
+}
+
+func (m *AuditModel) Insert(ctx context.Context, actorID int, action, target, detail string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := models.AuditEntry{
+		ID:      len(m.entries) + 1,
+		ActorID: actorID,
+		Action:  action,
+		Target:  target,
+		Detail:  detail,
+		Created: time.Now(),
+	}
+	m.entries = append([]models.AuditEntry{entry}, m.entries...)
+	return nil
+}
+
+// The record() method adds an entry passed to one of the other mocks, like
+// UserModel.SetRole(), to the audit trail. If m or e is nil, nothing is
+// recorded.
+func (m *AuditModel) record(ctx context.Context, e *models.AuditEntry) error {
+	if m == nil || e == nil {
+		return nil
+	}
+	return m.Insert(ctx, e.ActorID, e.Action, e.Target, e.Detail)
+}
+
+func (m *AuditModel) Latest(ctx context.Context) ([]models.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]models.AuditEntry(nil), m.entries...), nil
+}
@@ -0,0 +1,13 @@
+package mocks
+
+import "context"
+
+// The DB type stands in for the *sql.DB connection pool in the readiness
+// checks. Set Err to make PingContext() fail.
+type DB struct {
+	Err error
+}
+
+func (db *DB) PingContext(ctx context.Context) error {
+	return db.Err
+}
@@ -0,0 +1,96 @@
+package mocks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"snippetbox.example.com/internal/models"
+)
+
+// The SessionModel mock keeps its sessions in memory, so that handler tests
+// can check that logging in records a session and that revoking it removes
+// the token from the session store.
+type SessionModel struct {
+	mu       sync.Mutex
+	nextID   int
+	sessions []models.Session
+}
+
+func (m *SessionModel) Insert(ctx context.Context, userID int, token, ip, userAgent string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	m.sessions = append(m.sessions, models.Session{
+		ID:        m.nextID,
+		UserID:    userID,
+		Token:     token,
+		IP:        ip,
+		UserAgent: userAgent,
+		Created:   time.Now(),
+		LastSeen:  time.Now(),
+		Expires:   expires,
+	})
+	return nil
+}
+
+func (m *SessionModel) Touch(ctx context.Context, token string) error {
+	return nil
+}
+
+func (m *SessionModel) All(ctx context.Context, userID int) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []models.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *SessionModel) Delete(ctx context.Context, userID, id int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.sessions {
+		if s.ID == id && s.UserID == userID {
+			m.sessions = append(m.sessions[:i], m.sessions[i+1:]...)
+			return s.Token, nil
+		}
+	}
+	return "", models.ErrNoRecord
+}
+
+func (m *SessionModel) DeleteToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, s := range m.sessions {
+		if s.Token == token {
+			m.sessions = append(m.sessions[:i], m.sessions[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *SessionModel) DeleteAll(ctx context.Context, userID int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tokens []string
+	var kept []models.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			tokens = append(tokens, s.Token)
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	m.sessions = kept
+	return tokens, nil
+}
@@ -1,34 +1,217 @@
 package mocks
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"snippetbox.example.com/internal/models"
 )
 
+// The mockUnsafeSnippet is owned by carol, and its title and content contain
+// characters which need escaping in HTML and XML.
+var mockUnsafeSnippet = models.Snippet{
+	ID:      3,
+	Title:   "Fish & <chips>",
+	Content: "if a < b && b > c {\n\t\"]]>\"\n}",
+	Format:  models.FormatCode,
+	Created: time.Now(),
+	Updated: time.Now(),
+	Expires: time.Now(),
+	UserID:  3,
+}
+
 var mockSnippet = models.Snippet{
 	ID:      1,
 	Title:   "An old silent Pond",
 	Content: "An old silent pond...",
+	Format:  models.FormatPlain,
+	Created: time.Now(),
+	Updated: time.Now(),
+	Expires: time.Now(),
+	UserID:  1,
+}
+
+// The mockMarkdownSnippet is a runbook written in Markdown, which includes a
+// fenced code block and some HTML which must not make it onto the page.
+var mockMarkdownSnippet = models.Snippet{
+	ID:      4,
+	Title:   "Restarting the web server",
+	Content: "# Restart\n\nRun **this** on the server:\n\n```bash\nsudo systemctl restart web\n```\n\n<script>alert(1)</script>\n",
+	Format:  models.FormatMarkdown,
+	Tags:    []string{"ops", "runbook"},
 	Created: time.Now(),
+	Updated: time.Now(),
 	Expires: time.Now(),
+	UserID:  1,
 }
 
-type SnippetModel struct{}
+// The mockFilesSnippet is a repro made up of several files.
+var mockFilesSnippet = models.Snippet{
+	ID:      5,
+	Title:   "Nil map panic",
+	Content: "Run `go run .` to see the panic.",
+	Format:  models.FormatMarkdown,
+	Tags:    []string{"go"},
+	Files: []models.SnippetFile{
+		{Name: "main.go", Language: "", Content: "package main\n\nfunc main() {\n\tvar m map[string]int\n\tm[\"a\"] = 1\n}\n"},
+		{Name: "go.mod", Language: "", Content: "module repro\n\ngo 1.23\n"},
+		{Name: "notes <1>.txt", Language: "text", Content: "</pre><script>alert(1)</script>"},
+	},
+	Created: time.Now(),
+	Updated: time.Now(),
+	Expires: time.Now(),
+	UserID:  1,
+}
+
+// The mockForkSnippet is carol's copy of mockSnippet.
+var mockForkSnippet = models.Snippet{
+	ID:         6,
+	Title:      "An old silent Pond",
+	Content:    "An old silent pond...",
+	Format:     models.FormatPlain,
+	ForkedFrom: 1,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now(),
+	UserID:     3,
+}
+
+// The mockOrphanSnippet is a fork of a snippet which no longer exists.
+var mockOrphanSnippet = models.Snippet{
+	ID:         7,
+	Title:      "Frog",
+	Content:    "A frog jumps in",
+	Format:     models.FormatPlain,
+	ForkedFrom: 2,
+	Created:    time.Now(),
+	Updated:    time.Now(),
+	Expires:    time.Now(),
+	UserID:     1,
+}
 
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// The SnippetModel mock records the audit entries passed to it in Audit, if
+// that's set, in the same way as the real model writes them in the same
+// transaction as the change. It also remembers the last snippet inserted, so
+// that it can be read back with Get as snippet 2.
+type SnippetModel struct {
+	Audit *AuditModel
+
+	mu       sync.Mutex
+	inserted *models.Snippet
+}
+
+func (m *SnippetModel) Insert(ctx context.Context, userID int, title string, content string, format string, files []models.SnippetFile, tags []string, expires int) (int, error) {
+	created := time.Now().UTC().Truncate(time.Second)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inserted = &models.Snippet{
+		ID:      2,
+		Title:   title,
+		Content: content,
+		Format:  format,
+		Files:   files,
+		Tags:    tags,
+		Created: created,
+		Updated: created,
+		Expires: created.AddDate(0, 0, expires),
+		UserID:  userID,
+	}
 	return 2, nil
 }
 
-func (m *SnippetModel) Get(id int) (models.Snippet, error) {
+func (m *SnippetModel) Get(ctx context.Context, id int) (models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 4:
+		return mockMarkdownSnippet, nil
+	case 5:
+		return mockFilesSnippet, nil
+	case 6:
+		return mockForkSnippet, nil
+	case 7:
+		return mockOrphanSnippet, nil
+	case 2:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.inserted != nil {
+			return *m.inserted, nil
+		}
+		return models.Snippet{}, models.ErrNoRecord
 	default:
 		return models.Snippet{}, models.ErrNoRecord
 	}
 }
 
-func (m *SnippetModel) Latest() ([]models.Snippet, error) {
+func (m *SnippetModel) Latest(ctx context.Context) ([]models.Snippet, error) {
 	return []models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) LatestByUser(ctx context.Context, userID int) ([]models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []models.Snippet{mockSnippet}, nil
+	case 3:
+		return []models.Snippet{mockUnsafeSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *SnippetModel) LatestByTag(ctx context.Context, tag string) ([]models.Snippet, error) {
+	switch tag {
+	case "ops", "runbook":
+		return []models.Snippet{mockMarkdownSnippet}, nil
+	case "go":
+		return []models.Snippet{mockFilesSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *SnippetModel) Page(ctx context.Context, page, pageSize int) ([]models.Snippet, int, error) {
+	if page == 1 {
+		return []models.Snippet{mockSnippet}, 1, nil
+	}
+	return nil, 1, nil
+}
+
+func (m *SnippetModel) Update(ctx context.Context, id int, title string, content string, format string, files []models.SnippetFile, tags []string, expires int) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int, audit *models.AuditEntry) error {
+	switch id {
+	case 1:
+		return m.Audit.record(ctx, audit)
+	default:
+		return models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) Fork(ctx context.Context, id int, userID int, expires int) (int, error) {
+	switch id {
+	case 1, 4, 5, 6, 7:
+		return 8, nil
+	default:
+		return 0, models.ErrNoRecord
+	}
+}
+
+func (m *SnippetModel) ForkCount(ctx context.Context, id int) (int, error) {
+	switch id {
+	case 1:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
@@ -0,0 +1,57 @@
+package mocks
+
+import (
+	"context"
+	"time"
+
+	"snippetbox.example.com/internal/models"
+)
+
+var mockToken = models.Token{
+	ID:      1,
+	UserID:  1,
+	Name:    "CI deploy",
+	Scope:   models.ScopeWrite,
+	Created: time.Now(),
+	Expires: time.Now().Add(30 * 24 * time.Hour),
+}
+
+type TokenModel struct{}
+
+func (m *TokenModel) Insert(ctx context.Context, userID int, name, scope string, expires int) (string, error) {
+	return "sbx_NEWTOKEN", nil
+}
+
+func (m *TokenModel) Authenticate(ctx context.Context, plaintext string) (models.Token, error) {
+	switch plaintext {
+	case "sbx_WRITETOKEN":
+		return mockToken, nil
+	case "sbx_READTOKEN":
+		token := mockToken
+		token.Scope = models.ScopeRead
+		return token, nil
+	case "sbx_CAROLTOKEN":
+		token := mockToken
+		token.ID = 2
+		token.UserID = 3
+		return token, nil
+	default:
+		return models.Token{}, models.ErrInvalidCredentials
+	}
+}
+
+func (m *TokenModel) All(ctx context.Context, userID int) ([]models.Token, error) {
+	switch userID {
+	case 1:
+		return []models.Token{mockToken}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *TokenModel) Delete(ctx context.Context, userID, id int) error {
+	if userID == 1 && id == 1 {
+		return nil
+	}
+	return models.ErrNoRecord
+}
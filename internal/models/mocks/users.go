@@ -1,10 +1,35 @@
 package mocks
 
-import "snippetbox.example.com/internal/models"
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
 
-type UserModel struct{}
+	"snippetbox.example.com/internal/models"
+)
 
-func (m *UserModel) Insert(name, email, password string) error {
+// The mock users. Alice is an ordinary user, Carol is an admin and Dave has
+// been disabled. Erin prefers the site in French, with times in Paris time.
+var mockUsers = []models.User{
+	{ID: 1, Name: "Alice Jones", Email: "alice@example.com", Created: time.Now(), Role: models.RoleUser},
+	{ID: 3, Name: "Carol Smith", Email: "carol@example.com", Created: time.Now(), Role: models.RoleAdmin},
+	{ID: 4, Name: "Dave Brown", Email: "dave@example.com", Created: time.Now(), Role: models.RoleUser, Disabled: true},
+	{ID: 5, Name: "Erin Martin", Email: "erin@example.com", Created: time.Now(), Role: models.RoleUser, Language: "fr", Timezone: "Europe/Paris"},
+}
+
+// The UserModel mock records the audit entries passed to it in Audit, if
+// that's set, in the same way as the real model writes them in the same
+// transaction as the change. It also remembers the external identities
+// linked with LinkExternal.
+type UserModel struct {
+	Audit *AuditModel
+
+	mu         sync.Mutex
+	identities map[string]int
+}
+
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) error {
 	switch email {
 	case "dupe@example.com":
 		return models.ErrDuplicateEmail
@@ -13,15 +38,21 @@ func (m *UserModel) Insert(name, email, password string) error {
 	}
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
-	if email == "alice@example.com" && password == "pa$$word" {
-		return 1, nil
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	if password != "pa$$word" {
+		return 0, models.ErrInvalidCredentials
+	}
+
+	for _, u := range mockUsers {
+		if u.Email == email {
+			return u.ID, nil
+		}
 	}
 
 	return 0, models.ErrInvalidCredentials
 }
 
-func (m *UserModel) Exists(id int) (bool, error) {
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
 	switch id {
 	case 1:
 		return true, nil
@@ -29,3 +60,92 @@ func (m *UserModel) Exists(id int) (bool, error) {
 		return false, nil
 	}
 }
+
+func (m *UserModel) AuthenticateExternal(ctx context.Context, issuer, subject, name, email string) (int, error) {
+	m.mu.Lock()
+	id, ok := m.identities[issuer+" "+subject]
+	m.mu.Unlock()
+
+	if ok {
+		u, err := m.Get(ctx, id)
+		if err == nil && u.Disabled {
+			return 0, models.ErrInvalidCredentials
+		}
+		return id, nil
+	}
+
+	for _, u := range mockUsers {
+		if u.Email == email {
+			if u.Disabled {
+				return 0, models.ErrInvalidCredentials
+			}
+			return 0, models.ErrLinkRequired
+		}
+	}
+	return 2, nil
+}
+
+func (m *UserModel) LinkExternal(ctx context.Context, userID int, issuer, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := issuer + " " + subject
+
+	if id, ok := m.identities[key]; ok {
+		if id != userID {
+			return models.ErrDuplicateIdentity
+		}
+		return nil
+	}
+
+	if m.identities == nil {
+		m.identities = map[string]int{}
+	}
+	m.identities[key] = userID
+	return nil
+}
+
+func (m *UserModel) Get(ctx context.Context, id int) (models.User, error) {
+	for _, u := range mockUsers {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return models.User{}, models.ErrNoRecord
+}
+
+func (m *UserModel) Search(ctx context.Context, query string) ([]models.User, error) {
+	var users []models.User
+	for _, u := range mockUsers {
+		if strings.Contains(u.Name, query) || strings.Contains(u.Email, query) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (m *UserModel) SetRole(ctx context.Context, id int, role string, audit *models.AuditEntry) error {
+	_, err := m.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return m.Audit.record(ctx, audit)
+}
+
+func (m *UserModel) SetDisabled(ctx context.Context, id int, disabled bool, audit *models.AuditEntry) error {
+	_, err := m.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return m.Audit.record(ctx, audit)
+}
+
+func (m *UserModel) SetLanguage(ctx context.Context, id int, language string) error {
+	_, err := m.Get(ctx, id)
+	return err
+}
+
+func (m *UserModel) SetTimezone(ctx context.Context, id int, timezone string) error {
+	_, err := m.Get(ctx, id)
+	return err
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SessionModelInterface interface {
+	Insert(ctx context.Context, userID int, token, ip, userAgent string, expires time.Time) error
+	Touch(ctx context.Context, token string) error
+	All(ctx context.Context, userID int) ([]Session, error)
+	Delete(ctx context.Context, userID, id int) (string, error)
+	DeleteToken(ctx context.Context, token string) error
+	DeleteAll(ctx context.Context, userID int) ([]string, error)
+}
+
+// Define a Session type to hold the metadata we track about each logged-in
+// session. The Token field holds the session token used by the session
+// store, and should never be shown to the user.
+type Session struct {
+	ID        int
+	UserID    int
+	Token     string
+	IP        string
+	UserAgent string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+}
+
+// Define a SessionModel type which wraps a sql.DB connection pool.
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// The Insert method records a new logged-in session for a user.
+func (m *SessionModel) Insert(ctx context.Context, userID int, token, ip, userAgent string, expires time.Time) error {
+	stmt := `INSERT INTO user_sessions (user_id, token, ip, user_agent, created, last_seen, expires)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), ?)`
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, token, ip, userAgent, expires.UTC())
+	return err
+}
+
+// The Touch method updates the last seen time for a session. To avoid writing
+// to the database on every single request, the time is only updated if it
+// is more than a minute old.
+func (m *SessionModel) Touch(ctx context.Context, token string) error {
+	stmt := `UPDATE user_sessions SET last_seen = UTC_TIMESTAMP()
+	WHERE token = ? AND last_seen < UTC_TIMESTAMP() - INTERVAL 1 MINUTE`
+
+	_, err := m.DB.ExecContext(ctx, stmt, token)
+	return err
+}
+
+// This will return all of the unexpired sessions for a user, with the most
+// recently used first.
+func (m *SessionModel) All(ctx context.Context, userID int) ([]Session, error) {
+	stmt := `SELECT id, user_id, token, ip, user_agent, created, last_seen, expires
+	FROM user_sessions WHERE user_id = ? AND expires > UTC_TIMESTAMP()
+	ORDER BY last_seen DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+
+	for rows.Next() {
+		var s Session
+
+		err = rows.Scan(&s.ID, &s.UserID, &s.Token, &s.IP, &s.UserAgent, &s.Created, &s.LastSeen, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// The Delete method removes a single session belonging to a user, and returns
+// its token so that the caller can remove it from the session store. If the
+// session doesn't exist (or belongs to somebody else) we return ErrNoRecord.
+func (m *SessionModel) Delete(ctx context.Context, userID, id int) (string, error) {
+	var token string
+
+	stmt := "SELECT token FROM user_sessions WHERE id = ? AND user_id = ?"
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, userID).Scan(&token)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		} else {
+			return "", err
+		}
+	}
+
+	_, err = m.DB.ExecContext(ctx, "DELETE FROM user_sessions WHERE id = ?", id)
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// The DeleteToken method removes the session with a specific token. It is
+// not an error if no such session exists.
+func (m *SessionModel) DeleteToken(ctx context.Context, token string) error {
+	_, err := m.DB.ExecContext(ctx, "DELETE FROM user_sessions WHERE token = ?", token)
+	return err
+}
+
+// The DeleteAll method removes every session belonging to a user, returning
+// their tokens so that the caller can remove them from the session store.
+func (m *SessionModel) DeleteAll(ctx context.Context, userID int) ([]string, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT token FROM user_sessions WHERE user_id = ? FOR UPDATE", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []string
+
+	for rows.Next() {
+		var token string
+
+		err = rows.Scan(&token)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_sessions WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
@@ -1,24 +1,67 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 )
 
+// Define the formats that a snippet's content can be in. Plain text and code
+// are both shown as they are, but code is shown in a monospace font, and
+// Markdown is rendered as HTML.
+const (
+	FormatPlain    = "plain"
+	FormatCode     = "code"
+	FormatMarkdown = "markdown"
+)
+
 type SnippetModelInterface interface {
-	Insert(title string, content string, expires int) (int, error)
-	Get(id int) (Snippet, error)
-	Latest() ([]Snippet, error)
+	Insert(ctx context.Context, userID int, title string, content string, format string, files []SnippetFile, tags []string, expires int) (int, error)
+	Get(ctx context.Context, id int) (Snippet, error)
+	Latest(ctx context.Context) ([]Snippet, error)
+	LatestByUser(ctx context.Context, userID int) ([]Snippet, error)
+	LatestByTag(ctx context.Context, tag string) ([]Snippet, error)
+	Page(ctx context.Context, page, pageSize int) ([]Snippet, int, error)
+	Update(ctx context.Context, id int, title string, content string, format string, files []SnippetFile, tags []string, expires int) error
+	Delete(ctx context.Context, id int, audit *AuditEntry) error
+	Fork(ctx context.Context, id int, userID int, expires int) (int, error)
+	ForkCount(ctx context.Context, id int) (int, error)
 }
 
-// Define a Snippet type to hold the data for an individual snippet.
+// Define a Snippet type to hold the data for an individual snippet. The
+// UserID field holds the ID of the user who created the snippet, or 0 for
+// snippets created before we started recording owners. The Format field is
+// one of the Format constants above. Files holds any files attached to the
+// snippet, in order, Tags holds its tags in alphabetical order, and
+// ForkedFrom holds the ID of the snippet that this one is a copy of, or 0 if
+// it isn't a fork. These are filled in by Get(), and the Latest methods fill
+// in Files too. Updated is the time the snippet was created or last edited.
+//
+// A fork keeps its ForkedFrom ID even after the original snippet has expired
+// or been deleted, so callers shouldn't assume that it still exists.
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID         int
+	Title      string
+	Content    string
+	Format     string
+	Files      []SnippetFile
+	Tags       []string
+	ForkedFrom int
+	Created    time.Time
+	Updated    time.Time
+	Expires    time.Time
+	UserID     int
+}
+
+// Define a SnippetFile type to hold one of the files in a snippet. A file's
+// name is unique within its snippet. The Language is the name of the language
+// to highlight the file as, or "" to work it out from the file name.
+type SnippetFile struct {
+	Name     string
+	Language string
+	Content  string
 }
 
 // Define a SnippetModel type which wraps a sql.DB connection pool.
@@ -26,20 +69,32 @@ type SnippetModel struct {
 	DB *sql.DB
 }
 
-// This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
+// This will insert a new snippet, owned by the given user, and its files and
+// tags into the database.
+func (m *SnippetModel) Insert(ctx context.Context, userID int, title string, content string, format string, files []SnippetFile, tags []string, expires int) (int, error) {
+	// The snippet, its files and its tags are inserted in a transaction, so
+	// that we never end up with half a snippet.
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	// Write the SQL statement we want to execute. I've split it over two lines
 	// for readability (which is why it's surrounded with backquotes instead
 	// of normal double quotes).
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-			VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	stmt := `INSERT INTO snippets (title, content, format, created, updated_at, expires, user_id)
+			VALUES(?, ?, ?, UTC_TIMESTAMP(), UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?)`
 
-	// Use the Exec() method on the embedded connection pool to execute the
-	// statement. The first parameter is the SQL statement, followed by the
-	// values for the placeholder parameters: title, content and expiry in
-	// that order. This method returns a sql.Result type, which contains some
-	// basic information about what happened when the statement was executed.
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	// Use the ExecContext() method on the transaction to execute the
+	// statement. Passing the request context means the query is abandoned if
+	// the client goes away, and lets the query show up in the request's
+	// trace. The next parameter is the SQL statement, followed by the values
+	// for the placeholder parameters: title, content, format, expiry and
+	// owner in that order. This method returns a sql.Result type, which
+	// contains some basic information about what happened when the statement
+	// was executed.
+	result, err := tx.ExecContext(ctx, stmt, title, content, format, expires, userID)
 	if err != nil {
 		return 0, err
 	}
@@ -51,24 +106,68 @@ func (m *SnippetModel) Insert(title string, content string, expires int) (int, e
 		return 0, err
 	}
 
+	err = insertFiles(ctx, tx, int(id), files)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertTags(ctx, tx, int(id), tags)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
 	// The ID returned has the type int64, so we convert it to an int type
 	// before returning.
 
 	return int(id), nil
 }
 
+// The insertFiles() function inserts a snippet's files, recording their
+// order in the position column.
+func insertFiles(ctx context.Context, tx *sql.Tx, snippetID int, files []SnippetFile) error {
+	stmt := `INSERT INTO snippet_files (snippet_id, position, name, language, content)
+	VALUES(?, ?, ?, ?, ?)`
+
+	for i, f := range files {
+		_, err := tx.ExecContext(ctx, stmt, snippetID, i, f.Name, f.Language, f.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The insertTags() function inserts a snippet's tags. The tags are expected
+// to be unique.
+func insertTags(ctx context.Context, tx *sql.Tx, snippetID int, tags []string) error {
+	for _, tag := range tags {
+		_, err := tx.ExecContext(ctx, "INSERT INTO snippet_tags (snippet_id, tag) VALUES(?, ?)", snippetID, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // This will return a specific snippet based on its id.
-func (m *SnippetModel) Get(id int) (Snippet, error) {
+func (m *SnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
 
 	// SQL statement we want to run.
-	stmt := `SELECT id, title, content, created, expires FROM snippets
+	stmt := `SELECT id, title, content, format, created, updated_at, expires, user_id, COALESCE(forked_from, 0) FROM snippets
 	WHERE expires > UTC_TIMESTAMP() and id = ?`
 
-	// Use the QueryRow() method on the connection pool to execute our
+	// Use the QueryRowContext() method on the connection pool to execute our
 	// SQL statement, passing in the untrusted id variable as the value for the
 	// placeholder parameter. This returns a pointer to a sql.Row object which
 	// holds the result from the database.
-	row := m.DB.QueryRow(stmt, id)
+	row := m.DB.QueryRowContext(ctx, stmt, id)
 
 	// Initialise a new zeroed Snippet struct.
 	var s Snippet
@@ -78,7 +177,7 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 	// to row.scan() are *pointers* to the place you want to copy the data into,
 	// and the number of arguments must be exactly the same as the number of
 	// columns returned by your statement.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Format, &s.Created, &s.Updated, &s.Expires, &s.UserID, &s.ForkedFrom)
 	if err != nil {
 		// If the query returns no rows, then row.Scan() will return a
 		// sql.ErrNoRows error. We use the errors.Is() function to check for that
@@ -91,29 +190,142 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 		}
 	}
 
+	// Then fetch the snippet's files and tags.
+	s.Files, err = m.files(ctx, s.ID)
+	if err != nil {
+		return Snippet{}, err
+	}
+
+	s.Tags, err = m.tags(ctx, s.ID)
+	if err != nil {
+		return Snippet{}, err
+	}
+
 	// if everything went OK, the return the filled Snippet struct
 
 	return s, nil
 }
 
-// This will return the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]Snippet, error) {
+// The files() method returns the files in a snippet, in order.
+func (m *SnippetModel) files(ctx context.Context, snippetID int) ([]SnippetFile, error) {
+	stmt := `SELECT name, language, content FROM snippet_files
+	WHERE snippet_id = ? ORDER BY position`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []SnippetFile
+
+	for rows.Next() {
+		var f SnippetFile
+
+		err = rows.Scan(&f.Name, &f.Language, &f.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// The listFiles() method fills in the files of a list of snippets. It reads
+// the files of every snippet in the list with a single query, rather than
+// one query for each snippet.
+func (m *SnippetModel) listFiles(ctx context.Context, snippets []Snippet) error {
+	if len(snippets) == 0 {
+		return nil
+	}
+
+	// Build a placeholder for each snippet ID, like "?, ?, ?", and the
+	// arguments to go with them.
+	ids := make([]any, len(snippets))
+	index := make(map[int]int, len(snippets))
+	for i, s := range snippets {
+		ids[i] = s.ID
+		index[s.ID] = i
+	}
+	placeholders := strings.Repeat("?, ", len(ids)-1) + "?"
+
+	stmt := `SELECT snippet_id, name, language, content FROM snippet_files
+	WHERE snippet_id IN (` + placeholders + `) ORDER BY snippet_id, position`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var snippetID int
+		var f SnippetFile
+
+		err = rows.Scan(&snippetID, &f.Name, &f.Language, &f.Content)
+		if err != nil {
+			return err
+		}
+
+		i := index[snippetID]
+		snippets[i].Files = append(snippets[i].Files, f)
+	}
+
+	return rows.Err()
+}
+
+// The tags() method returns the tags of a snippet, in alphabetical order.
+func (m *SnippetModel) tags(ctx context.Context, snippetID int) ([]string, error) {
+	rows, err := m.DB.QueryContext(ctx, "SELECT tag FROM snippet_tags WHERE snippet_id = ? ORDER BY tag", snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+
+	for rows.Next() {
+		var tag string
+
+		err = rows.Scan(&tag)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// This will return the 10 most recently created snippets, with their files.
+func (m *SnippetModel) Latest(ctx context.Context) ([]Snippet, error) {
 	// Write the SQL statement we want to execute.
-	stmt := `SELECT id, title, content, created, expires FROM snippets
+	stmt := `SELECT id, title, content, format, created, updated_at, expires, user_id FROM snippets
 	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
 
-	// Use the Query() method on the connection pool to execute our
+	// Use the QueryContext() method on the connection pool to execute our
 	// SQL statement. This returns a sql.Rows resultset containing the result of
 	// our query.
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.QueryContext(ctx, stmt)
 	if err != nil {
 		return nil, err
 	}
 
 	// We defer rows.close() to ensure the sql.rows resultset is
 	// alwasy properly closed begore the Latest() method returns. This defer
-	// statement should come *after* you check for an error from the Query()
-	// method. Otherwise, if Query() returns an error, you'll get a panic
+	// statement should come *after* you check for an error from the QueryContext()
+	// method. Otherwise, if QueryContext() returns an error, you'll get a panic
 	// trying to close a nil resultset.
 	defer rows.Close()
 
@@ -134,7 +346,7 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 		// must be pointers to the place you want to copy the data into, and the
 		// number of arguments must be exactly the same as the number of
 		// columns returned by your statement.
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Format, &s.Created, &s.Updated, &s.Expires, &s.UserID)
 		if err != nil {
 			return nil, err
 		}
@@ -149,6 +361,305 @@ func (m *SnippetModel) Latest() ([]Snippet, error) {
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+
+	// Then fetch the files of all the snippets at once.
+	err = m.listFiles(ctx, snippets)
+	if err != nil {
+		return nil, err
+	}
+
 	// If everything went ok then return the Snippets slice.
 	return snippets, nil
 }
+
+// The LatestByUser method returns the 10 most recently created unexpired
+// snippets owned by the given user, with their files.
+func (m *SnippetModel) LatestByUser(ctx context.Context, userID int) ([]Snippet, error) {
+	stmt := `SELECT id, title, content, format, created, updated_at, expires, user_id FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND user_id = ? ORDER BY id DESC LIMIT 10`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Format, &s.Created, &s.Updated, &s.Expires, &s.UserID)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.listFiles(ctx, snippets)
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// The LatestByTag method returns the 10 most recently created unexpired
+// snippets with the given tag, with their files.
+func (m *SnippetModel) LatestByTag(ctx context.Context, tag string) ([]Snippet, error) {
+	stmt := `SELECT snippets.id, title, content, format, created, updated_at, expires, user_id FROM snippets
+	INNER JOIN snippet_tags ON snippet_tags.snippet_id = snippets.id
+	WHERE expires > UTC_TIMESTAMP() AND snippet_tags.tag = ? ORDER BY snippets.id DESC LIMIT 10`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Format, &s.Created, &s.Updated, &s.Expires, &s.UserID)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.listFiles(ctx, snippets)
+	if err != nil {
+		return nil, err
+	}
+
+	return snippets, nil
+}
+
+// The Page method returns one page of unexpired snippets, newest first,
+// along with the total number of unexpired snippets. Pages are numbered
+// from 1.
+func (m *SnippetModel) Page(ctx context.Context, page, pageSize int) ([]Snippet, int, error) {
+	var total int
+
+	err := m.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM snippets WHERE expires > UTC_TIMESTAMP()").Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stmt := `SELECT id, title, content, format, created, updated_at, expires, user_id FROM snippets
+	WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT ? OFFSET ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var snippets []Snippet
+
+	for rows.Next() {
+		var s Snippet
+
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Format, &s.Created, &s.Updated, &s.Expires, &s.UserID)
+		if err != nil {
+			return nil, 0, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return snippets, total, nil
+}
+
+// The Update method changes the title, content and format of an unexpired
+// snippet, replaces its files and tags, and records when it was edited.
+// If expires is not zero, the snippet is also set to expire that many days
+// from now. If the snippet doesn't exist we return ErrNoRecord.
+func (m *SnippetModel) Update(ctx context.Context, id int, title string, content string, format string, files []SnippetFile, tags []string, expires int) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET title = ?, content = ?, format = ?, updated_at = UTC_TIMESTAMP(),
+	expires = IF(? > 0, DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), expires)
+	WHERE id = ? AND expires > UTC_TIMESTAMP()`
+
+	result, err := tx.ExecContext(ctx, stmt, title, content, format, expires, expires, id)
+	if err != nil {
+		return err
+	}
+
+	// MySQL reports the number of rows changed rather than matched, so an
+	// update which changes nothing looks the same as a missing snippet.
+	// Check whether the snippet exists to tell the two apart.
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists bool
+
+		stmt = "SELECT EXISTS(SELECT true FROM snippets WHERE id = ? AND expires > UTC_TIMESTAMP())"
+
+		err = tx.QueryRowContext(ctx, stmt, id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM snippet_files WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	err = insertFiles(ctx, tx, id, files)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM snippet_tags WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	err = insertTags(ctx, tx, id, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The Delete method removes a snippet, its files and its tags. If audit isn't nil, it's
+// added to the audit trail in the same transaction, for when a moderator
+// deletes somebody else's snippet. If the snippet doesn't exist we return
+// ErrNoRecord.
+func (m *SnippetModel) Delete(ctx context.Context, id int, audit *AuditEntry) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM snippets WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM snippet_files WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM snippet_tags WHERE snippet_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, audit)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The Fork method copies an unexpired snippet, its files and its tags into a
+// new snippet owned by the given user, which expires that many days from now.
+// It returns the ID of the new snippet, or ErrNoRecord if there's nothing to
+// copy.
+func (m *SnippetModel) Fork(ctx context.Context, id int, userID int, expires int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Copy the snippet in a single statement, so that there's no chance of it
+	// changing between reading it and writing the copy.
+	stmt := `INSERT INTO snippets (title, content, format, created, updated_at, expires, user_id, forked_from)
+	SELECT title, content, format, UTC_TIMESTAMP(), UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?, id
+	FROM snippets WHERE id = ? AND expires > UTC_TIMESTAMP()`
+
+	result, err := tx.ExecContext(ctx, stmt, expires, userID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrNoRecord
+	}
+
+	forkID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO snippet_files (snippet_id, position, name, language, content)
+	SELECT ?, position, name, language, content FROM snippet_files WHERE snippet_id = ?`
+
+	_, err = tx.ExecContext(ctx, stmt, forkID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO snippet_tags (snippet_id, tag)
+	SELECT ?, tag FROM snippet_tags WHERE snippet_id = ?`
+
+	_, err = tx.ExecContext(ctx, stmt, forkID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(forkID), nil
+}
+
+// The ForkCount method returns the number of unexpired forks of a snippet.
+// Forks of forks aren't counted.
+func (m *SnippetModel) ForkCount(ctx context.Context, id int) (int, error) {
+	var count int
+
+	stmt := "SELECT COUNT(*) FROM snippets WHERE forked_from = ? AND expires > UTC_TIMESTAMP()"
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
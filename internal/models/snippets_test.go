@@ -0,0 +1,145 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"snippetbox.example.com/internal/assert"
+)
+
+func TestSnippetModelFork(t *testing.T) {
+	db := newTestDB(t)
+	m := SnippetModel{db}
+	ctx := context.Background()
+
+	files := []SnippetFile{
+		{Name: "main.go", Language: "go", Content: "package main"},
+		{Name: "go.mod", Content: "module repro"},
+	}
+
+	id, err := m.Insert(ctx, 1, "Nil map panic", "Run it", FormatMarkdown, files, []string{"go", "maps"}, 7)
+	assert.NilError(t, err)
+
+	// The fork is a copy of the snippet, its files, in the same order, and
+	// its tags, owned by the user who forked it.
+	forkID, err := m.Fork(ctx, id, 2, 365)
+	assert.NilError(t, err)
+
+	fork, err := m.Get(ctx, forkID)
+	assert.NilError(t, err)
+	assert.Equal(t, fork.Title, "Nil map panic")
+	assert.Equal(t, fork.Format, FormatMarkdown)
+	assert.Equal(t, fork.UserID, 2)
+	assert.Equal(t, fork.ForkedFrom, id)
+	assert.Equal(t, len(fork.Files), 2)
+	assert.Equal(t, fork.Files[0].Name, "main.go")
+	assert.Equal(t, fork.Files[1].Name, "go.mod")
+	assert.Equal(t, strings.Join(fork.Tags, " "), "go maps")
+
+	original, err := m.Get(ctx, id)
+	assert.NilError(t, err)
+	assert.Equal(t, original.ForkedFrom, 0)
+
+	// Lists of snippets include each snippet's own files, in order.
+	snippets, err := m.Latest(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 2)
+	for _, s := range snippets {
+		assert.Equal(t, len(s.Files), 2)
+		assert.Equal(t, s.Files[0].Name, "main.go")
+		assert.Equal(t, s.Files[1].Name, "go.mod")
+	}
+
+	count, err := m.ForkCount(ctx, id)
+	assert.NilError(t, err)
+	assert.Equal(t, count, 1)
+
+	// Once the original has gone the fork still records where it came from,
+	// but the original can't be forked again.
+	err = m.Delete(ctx, id, nil)
+	assert.NilError(t, err)
+
+	fork, err = m.Get(ctx, forkID)
+	assert.NilError(t, err)
+	assert.Equal(t, fork.ForkedFrom, id)
+
+	_, err = m.Fork(ctx, id, 2, 365)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestSnippetModelUpdate(t *testing.T) {
+	db := newTestDB(t)
+	m := SnippetModel{db}
+	ctx := context.Background()
+
+	id, err := m.Insert(ctx, 1, "Frog", "A frog jumps in", FormatPlain, nil, nil, 7)
+	assert.NilError(t, err)
+
+	s, err := m.Get(ctx, id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Updated.Equal(s.Created), true)
+
+	// Backdate the snippet, so that we can tell when Update() has changed
+	// its updated_at time without having to wait.
+	_, err = db.Exec("UPDATE snippets SET created = '2024-01-01 00:00:00', updated_at = '2024-01-01 00:00:00' WHERE id = ?", id)
+	assert.NilError(t, err)
+
+	err = m.Update(ctx, id, "Frog", "An old silent pond", FormatPlain, nil, nil, 0)
+	assert.NilError(t, err)
+
+	s, err = m.Get(ctx, id)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Content, "An old silent pond")
+	assert.Equal(t, s.Created.Year(), 2024)
+	assert.Equal(t, s.Updated.After(s.Created), true)
+
+	// The list queries include the updated time too.
+	snippets, err := m.Latest(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, snippets[0].Updated.Equal(s.Updated), true)
+
+	err = m.Update(ctx, 999, "Frog", "", FormatPlain, nil, nil, 0)
+	assert.Equal(t, errors.Is(err, ErrNoRecord), true)
+}
+
+func TestSnippetModelTags(t *testing.T) {
+	db := newTestDB(t)
+	m := SnippetModel{db}
+	ctx := context.Background()
+
+	id, err := m.Insert(ctx, 1, "Deploy log", "All good", FormatPlain, nil, []string{"deploy", "ops"}, 7)
+	assert.NilError(t, err)
+
+	otherID, err := m.Insert(ctx, 1, "Restart", "Run it", FormatPlain, nil, []string{"ops"}, 7)
+	assert.NilError(t, err)
+
+	s, err := m.Get(ctx, id)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Join(s.Tags, " "), "deploy ops")
+
+	// The latest snippets with a tag are newest first.
+	snippets, err := m.LatestByTag(ctx, "ops")
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 2)
+	assert.Equal(t, snippets[0].ID, otherID)
+	assert.Equal(t, snippets[1].ID, id)
+
+	// Updating a snippet replaces its tags.
+	err = m.Update(ctx, id, "Deploy log", "All good", FormatPlain, nil, []string{"deploy"}, 0)
+	assert.NilError(t, err)
+
+	snippets, err = m.LatestByTag(ctx, "ops")
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 1)
+	assert.Equal(t, snippets[0].ID, otherID)
+
+	// Deleting a snippet removes its tags too.
+	err = m.Delete(ctx, otherID, nil)
+	assert.NilError(t, err)
+
+	snippets, err = m.LatestByTag(ctx, "ops")
+	assert.NilError(t, err)
+	assert.Equal(t, len(snippets), 0)
+}
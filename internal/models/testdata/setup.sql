@@ -2,22 +2,98 @@ CREATE TABLE snippets (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
     title VARCHAR(100) NOT NULL,
     content TEXT NOT NULL,
+    format VARCHAR(20) NOT NULL DEFAULT 'code',
     created DATETIME NOT NULL,
-    expires DATETIME NOT NULL
+    updated_at DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    forked_from INTEGER
 );
 
 CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+CREATE INDEX idx_snippets_forked_from ON snippets(forked_from);
+
+CREATE TABLE snippet_files (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    snippet_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    language VARCHAR(50) NOT NULL DEFAULT '',
+    content MEDIUMTEXT NOT NULL
+);
+
+ALTER TABLE snippet_files ADD CONSTRAINT snippet_files_uc_snippet_id_name UNIQUE (snippet_id, name);
+
+CREATE TABLE snippet_tags (
+    snippet_id INTEGER NOT NULL,
+    tag VARCHAR(30) NOT NULL,
+    PRIMARY KEY (snippet_id, tag)
+);
+
+CREATE INDEX idx_snippet_tags_tag ON snippet_tags(tag);
 
 CREATE TABLE users (
     id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
     name VARCHAR(255) NOT NULL,
     email VARCHAR(255) NOT NULL,
     hashed_password CHAR(60) NOT NULL,
-    created DATETIME NOT NULL
+    created DATETIME NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'user',
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    language VARCHAR(35) NOT NULL DEFAULT '',
+    timezone VARCHAR(64) NOT NULL DEFAULT ''
 );
 
 ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
 
+CREATE TABLE user_identities (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL
+);
+
+ALTER TABLE user_identities ADD CONSTRAINT user_identities_uc_issuer_subject UNIQUE (issuer, subject);
+
+CREATE TABLE user_sessions (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    token CHAR(43) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL,
+    last_seen DATETIME NOT NULL,
+    expires DATETIME NOT NULL
+);
+
+ALTER TABLE user_sessions ADD CONSTRAINT user_sessions_uc_token UNIQUE (token);
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
+
+CREATE TABLE tokens (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    hash CHAR(64) NOT NULL,
+    scope VARCHAR(10) NOT NULL,
+    created DATETIME NOT NULL,
+    expires DATETIME NOT NULL,
+    last_used DATETIME
+);
+
+ALTER TABLE tokens ADD CONSTRAINT tokens_uc_hash UNIQUE (hash);
+CREATE INDEX idx_tokens_user_id ON tokens(user_id);
+
+CREATE TABLE audit_log (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    actor_id INTEGER NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    detail VARCHAR(255) NOT NULL,
+    created DATETIME NOT NULL
+);
+
 INSERT INTO users (name, email, hashed_password, created) VALUES (
     'Alice Jones',
     'alice@example.com',
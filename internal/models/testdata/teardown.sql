@@ -1,3 +1,15 @@
+DROP TABLE audit_log;
+
+DROP TABLE tokens;
+
+DROP TABLE user_sessions;
+
+DROP TABLE user_identities;
+
 DROP TABLE users;
 
-DROP TABLE snippets;
\ No newline at end of file
+DROP TABLE snippets;
+
+DROP TABLE snippet_files;
+
+DROP TABLE snippet_tags;
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Define the scopes that a personal access token can be granted. A token
+// with the write scope can also be used for reading.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+type TokenModelInterface interface {
+	Insert(ctx context.Context, userID int, name, scope string, expires int) (string, error)
+	Authenticate(ctx context.Context, plaintext string) (Token, error)
+	All(ctx context.Context, userID int) ([]Token, error)
+	Delete(ctx context.Context, userID, id int) error
+}
+
+// Define a Token type to hold the data for a personal access token. Note that
+// we only ever store a hash of the token itself, so the plain-text token is
+// not part of this struct.
+type Token struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scope    string
+	Created  time.Time
+	Expires  time.Time
+	LastUsed time.Time
+}
+
+// Define a TokenModel type which wraps a sql.DB connection pool.
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// Returns the SHA-256 hash of a plain-text token, hex encoded. Tokens contain
+// 160 bits of randomness so a fast hash is fine here (unlike passwords, where
+// we need bcrypt).
+func hashToken(plaintext string) string {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(hash[:])
+}
+
+// The Insert method generates a new token for a user, which expires after the
+// given number of days. The plain-text token is returned so that it can be
+// shown to the user; only its hash is stored in the database.
+func (m *TokenModel) Insert(ctx context.Context, userID int, name, scope string, expires int) (string, error) {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	// Prefix the token so that it is easy to recognise (for example, by
+	// secret scanners) if it leaks.
+	plaintext := "sbx_" + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	stmt := `INSERT INTO tokens (user_id, name, hash, scope, created, expires)
+	VALUES(?, ?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+
+	_, err = m.DB.ExecContext(ctx, stmt, userID, name, hashToken(plaintext), scope, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// The Authenticate method looks up an unexpired token from its plain-text
+// value and records that it has been used. If there is no matching token we
+// return the ErrInvalidCredentials error.
+func (m *TokenModel) Authenticate(ctx context.Context, plaintext string) (Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, expires, last_used FROM tokens
+	WHERE hash = ? AND expires > UTC_TIMESTAMP()`
+
+	var t Token
+	var lastUsed sql.NullTime
+
+	err := m.DB.QueryRowContext(ctx, stmt, hashToken(plaintext)).Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created, &t.Expires, &lastUsed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Token{}, ErrInvalidCredentials
+		} else {
+			return Token{}, err
+		}
+	}
+	t.LastUsed = lastUsed.Time
+
+	_, err = m.DB.ExecContext(ctx, "UPDATE tokens SET last_used = UTC_TIMESTAMP() WHERE id = ?", t.ID)
+	if err != nil {
+		return Token{}, err
+	}
+
+	return t, nil
+}
+
+// This will return all of the tokens belonging to a user, including expired
+// ones, with the newest first.
+func (m *TokenModel) All(ctx context.Context, userID int) ([]Token, error) {
+	stmt := `SELECT id, user_id, name, scope, created, expires, last_used FROM tokens
+	WHERE user_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []Token
+
+	for rows.Next() {
+		var t Token
+		var lastUsed sql.NullTime
+
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Created, &t.Expires, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		t.LastUsed = lastUsed.Time
+
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// The Delete method revokes a token belonging to a user. If the token doesn't
+// exist (or belongs to somebody else) we return ErrNoRecord.
+func (m *TokenModel) Delete(ctx context.Context, userID, id int) error {
+	result, err := m.DB.ExecContext(ctx, "DELETE FROM tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The tracing decorators in this file wrap each of the model interfaces, and
+// record an OpenTelemetry span around every method call. They are kept
+// separate from the models themselves so that the SQL code stays readable,
+// and so that tracing can be left out of the picture entirely in tests.
+
+const tracerName = "snippetbox.example.com/internal/models"
+
+// The startSpan() helper starts a client span for a database call. The span
+// is a child of whatever span is in ctx, normally the one for the HTTP
+// request.
+func startSpan(ctx context.Context, tracer trace.Tracer, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mysql")),
+	)
+}
+
+// The endSpan() helper ends a span, marking it as failed if err is an
+// unexpected error. Our sentinel errors, like ErrNoRecord, describe normal
+// outcomes rather than failures, so they are only recorded as an attribute.
+func endSpan(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNoRecord), errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrDuplicateEmail):
+		span.SetAttributes(attribute.String("snippetbox.result", err.Error()))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// The TracedSnippetModel type wraps a SnippetModelInterface,
+// recording a span for every method call.
+type TracedSnippetModel struct {
+	next   SnippetModelInterface
+	tracer trace.Tracer
+}
+
+func NewTracedSnippetModel(next SnippetModelInterface, tp trace.TracerProvider) *TracedSnippetModel {
+	return &TracedSnippetModel{next: next, tracer: tp.Tracer(tracerName)}
+}
+
+func (m *TracedSnippetModel) Insert(ctx context.Context, userID int, title string, content string, format string, files []SnippetFile, tags []string, expires int) (int, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.Insert")
+	v, err := m.next.Insert(ctx, userID, title, content, format, files, tags, expires)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedSnippetModel) Get(ctx context.Context, id int) (Snippet, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.Get")
+	v, err := m.next.Get(ctx, id)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedSnippetModel) Latest(ctx context.Context) ([]Snippet, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.Latest")
+	v, err := m.next.Latest(ctx)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedSnippetModel) LatestByUser(ctx context.Context, userID int) ([]Snippet, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.LatestByUser")
+	v, err := m.next.LatestByUser(ctx, userID)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedSnippetModel) LatestByTag(ctx context.Context, tag string) ([]Snippet, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.LatestByTag")
+	v, err := m.next.LatestByTag(ctx, tag)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedSnippetModel) Page(ctx context.Context, page, pageSize int) ([]Snippet, int, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.Page")
+	v, n, err := m.next.Page(ctx, page, pageSize)
+	endSpan(span, err)
+	return v, n, err
+}
+
+func (m *TracedSnippetModel) Update(ctx context.Context, id int, title string, content string, format string, files []SnippetFile, tags []string, expires int) error {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.Update")
+	err := m.next.Update(ctx, id, title, content, format, files, tags, expires)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedSnippetModel) Delete(ctx context.Context, id int, audit *AuditEntry) error {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.Delete")
+	err := m.next.Delete(ctx, id, audit)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedSnippetModel) Fork(ctx context.Context, id int, userID int, expires int) (int, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.Fork")
+	forkID, err := m.next.Fork(ctx, id, userID, expires)
+	endSpan(span, err)
+	return forkID, err
+}
+
+func (m *TracedSnippetModel) ForkCount(ctx context.Context, id int) (int, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SnippetModel.ForkCount")
+	count, err := m.next.ForkCount(ctx, id)
+	endSpan(span, err)
+	return count, err
+}
+
+// The TracedUserModel type wraps a UserModelInterface,
+// recording a span for every method call.
+type TracedUserModel struct {
+	next   UserModelInterface
+	tracer trace.Tracer
+}
+
+func NewTracedUserModel(next UserModelInterface, tp trace.TracerProvider) *TracedUserModel {
+	return &TracedUserModel{next: next, tracer: tp.Tracer(tracerName)}
+}
+
+func (m *TracedUserModel) Insert(ctx context.Context, name, email, password string) error {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.Insert")
+	err := m.next.Insert(ctx, name, email, password)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedUserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.Authenticate")
+	v, err := m.next.Authenticate(ctx, email, password)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedUserModel) Exists(ctx context.Context, id int) (bool, error) {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.Exists")
+	v, err := m.next.Exists(ctx, id)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedUserModel) AuthenticateExternal(ctx context.Context, issuer, subject, name, email string) (int, error) {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.AuthenticateExternal")
+	v, err := m.next.AuthenticateExternal(ctx, issuer, subject, name, email)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedUserModel) LinkExternal(ctx context.Context, userID int, issuer, subject string) error {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.LinkExternal")
+	err := m.next.LinkExternal(ctx, userID, issuer, subject)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedUserModel) Get(ctx context.Context, id int) (User, error) {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.Get")
+	v, err := m.next.Get(ctx, id)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedUserModel) Search(ctx context.Context, query string) ([]User, error) {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.Search")
+	v, err := m.next.Search(ctx, query)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedUserModel) SetRole(ctx context.Context, id int, role string, audit *AuditEntry) error {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.SetRole")
+	err := m.next.SetRole(ctx, id, role, audit)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedUserModel) SetDisabled(ctx context.Context, id int, disabled bool, audit *AuditEntry) error {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.SetDisabled")
+	err := m.next.SetDisabled(ctx, id, disabled, audit)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedUserModel) SetLanguage(ctx context.Context, id int, language string) error {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.SetLanguage")
+	err := m.next.SetLanguage(ctx, id, language)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedUserModel) SetTimezone(ctx context.Context, id int, timezone string) error {
+	ctx, span := startSpan(ctx, m.tracer, "UserModel.SetTimezone")
+	err := m.next.SetTimezone(ctx, id, timezone)
+	endSpan(span, err)
+	return err
+}
+
+// The TracedSessionModel type wraps a SessionModelInterface,
+// recording a span for every method call.
+type TracedSessionModel struct {
+	next   SessionModelInterface
+	tracer trace.Tracer
+}
+
+func NewTracedSessionModel(next SessionModelInterface, tp trace.TracerProvider) *TracedSessionModel {
+	return &TracedSessionModel{next: next, tracer: tp.Tracer(tracerName)}
+}
+
+func (m *TracedSessionModel) Insert(ctx context.Context, userID int, token, ip, userAgent string, expires time.Time) error {
+	ctx, span := startSpan(ctx, m.tracer, "SessionModel.Insert")
+	err := m.next.Insert(ctx, userID, token, ip, userAgent, expires)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedSessionModel) Touch(ctx context.Context, token string) error {
+	ctx, span := startSpan(ctx, m.tracer, "SessionModel.Touch")
+	err := m.next.Touch(ctx, token)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedSessionModel) All(ctx context.Context, userID int) ([]Session, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SessionModel.All")
+	v, err := m.next.All(ctx, userID)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedSessionModel) Delete(ctx context.Context, userID, id int) (string, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SessionModel.Delete")
+	v, err := m.next.Delete(ctx, userID, id)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedSessionModel) DeleteToken(ctx context.Context, token string) error {
+	ctx, span := startSpan(ctx, m.tracer, "SessionModel.DeleteToken")
+	err := m.next.DeleteToken(ctx, token)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedSessionModel) DeleteAll(ctx context.Context, userID int) ([]string, error) {
+	ctx, span := startSpan(ctx, m.tracer, "SessionModel.DeleteAll")
+	v, err := m.next.DeleteAll(ctx, userID)
+	endSpan(span, err)
+	return v, err
+}
+
+// The TracedTokenModel type wraps a TokenModelInterface,
+// recording a span for every method call.
+type TracedTokenModel struct {
+	next   TokenModelInterface
+	tracer trace.Tracer
+}
+
+func NewTracedTokenModel(next TokenModelInterface, tp trace.TracerProvider) *TracedTokenModel {
+	return &TracedTokenModel{next: next, tracer: tp.Tracer(tracerName)}
+}
+
+func (m *TracedTokenModel) Insert(ctx context.Context, userID int, name, scope string, expires int) (string, error) {
+	ctx, span := startSpan(ctx, m.tracer, "TokenModel.Insert")
+	v, err := m.next.Insert(ctx, userID, name, scope, expires)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedTokenModel) Authenticate(ctx context.Context, plaintext string) (Token, error) {
+	ctx, span := startSpan(ctx, m.tracer, "TokenModel.Authenticate")
+	v, err := m.next.Authenticate(ctx, plaintext)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedTokenModel) All(ctx context.Context, userID int) ([]Token, error) {
+	ctx, span := startSpan(ctx, m.tracer, "TokenModel.All")
+	v, err := m.next.All(ctx, userID)
+	endSpan(span, err)
+	return v, err
+}
+
+func (m *TracedTokenModel) Delete(ctx context.Context, userID, id int) error {
+	ctx, span := startSpan(ctx, m.tracer, "TokenModel.Delete")
+	err := m.next.Delete(ctx, userID, id)
+	endSpan(span, err)
+	return err
+}
+
+// The TracedAuditModel type wraps a AuditModelInterface,
+// recording a span for every method call.
+type TracedAuditModel struct {
+	next   AuditModelInterface
+	tracer trace.Tracer
+}
+
+func NewTracedAuditModel(next AuditModelInterface, tp trace.TracerProvider) *TracedAuditModel {
+	return &TracedAuditModel{next: next, tracer: tp.Tracer(tracerName)}
+}
+
+func (m *TracedAuditModel) Insert(ctx context.Context, actorID int, action, target, detail string) error {
+	ctx, span := startSpan(ctx, m.tracer, "AuditModel.Insert")
+	err := m.next.Insert(ctx, actorID, action, target, detail)
+	endSpan(span, err)
+	return err
+}
+
+func (m *TracedAuditModel) Latest(ctx context.Context) ([]AuditEntry, error) {
+	ctx, span := startSpan(ctx, m.tracer, "AuditModel.Latest")
+	v, err := m.next.Latest(ctx)
+	endSpan(span, err)
+	return v, err
+}
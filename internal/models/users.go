@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"strings"
@@ -10,10 +11,26 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Define the roles that a user can have. Moderators can delete any snippet,
+// and admins can also manage users.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type UserModelInterface interface {
-	Insert(name, email, password string) error
-	Authenticate(email, password string) (int, error)
-	Exists(id int) (bool, error)
+	Insert(ctx context.Context, name, email, password string) error
+	Authenticate(ctx context.Context, email, password string) (int, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	AuthenticateExternal(ctx context.Context, issuer, subject, name, email string) (int, error)
+	LinkExternal(ctx context.Context, userID int, issuer, subject string) error
+	Get(ctx context.Context, id int) (User, error)
+	Search(ctx context.Context, query string) ([]User, error)
+	SetRole(ctx context.Context, id int, role string, audit *AuditEntry) error
+	SetDisabled(ctx context.Context, id int, disabled bool, audit *AuditEntry) error
+	SetLanguage(ctx context.Context, id int, language string) error
+	SetTimezone(ctx context.Context, id int, timezone string) error
 }
 
 // Define a User struct.  The field names and types align
@@ -24,6 +41,10 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	Role           string
+	Disabled       bool
+	Language       string
+	Timezone       string
 }
 
 // Define a new UserModel struct which wraps a database connection pool.
@@ -32,7 +53,7 @@ type UserModel struct {
 }
 
 // The Insert method will add a new record to the "users" table.
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) error {
 	// Create a bcrypt hash of the plain-text password.
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
@@ -42,7 +63,7 @@ func (m *UserModel) Insert(name, email, password string) error {
 	stmt := `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
 
 	// Use the exec method to insert the user details and hashed password in the users table.
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	_, err = m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
 	if err != nil {
 		// If this returns an error, we use the errors.As() function to check
 		// whether the error has the type *mysql.MySQLError. If it does, the
@@ -64,15 +85,17 @@ func (m *UserModel) Insert(name, email, password string) error {
 
 // This method will verify whether a user exists with the provided email
 // address and password, returning the relevant user ID they do.
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
 	// Retrieve the id and hashed password associated with the given email. If
 	// no matching email exists we return the ErrInvalidCredentials error.
 	var id int
 	var hashedPassword []byte
 
-	stmt := "SELECT id, hashed_password FROM users WHERE email = ?"
+	// Note that disabled users can't log in, and get exactly the same error
+	// as for a wrong password.
+	stmt := "SELECT id, hashed_password FROM users WHERE email = ? AND disabled = FALSE"
 
-	err := m.DB.QueryRow(stmt, email).Scan(&id, &hashedPassword)
+	err := m.DB.QueryRowContext(ctx, stmt, email).Scan(&id, &hashedPassword)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, ErrInvalidCredentials
@@ -80,6 +103,12 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 			return 0, err
 		}
 	}
+	// Users who were created by logging in with an external identity provider
+	// don't have a password, so they can't log in this way.
+	if len(hashedPassword) == 0 {
+		return 0, ErrInvalidCredentials
+	}
+
 	// Check whether the hashed password and plain-text password provided match.
 	// If they dont, we return the ErrInvalidCredentials error.
 	err = bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
@@ -95,11 +124,249 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 }
 
 // This method will check if a user exists given a specific ID.
-func (m *UserModel) Exists(id int) (bool, error) {
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
 	var exists bool
 
 	stmt := "SELECT EXISTS(SELECT true FROM users WHERE id = ?)"
 
-	err := m.DB.QueryRow(stmt, id).Scan(&exists)
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&exists)
 	return exists, err
 }
+
+// The AuthenticateExternal method returns the ID of the user for an identity
+// asserted by an external identity provider. An identity we haven't seen
+// before is linked to a brand new user, which is created just-in-time without
+// a password.
+//
+// We never link a new identity to an existing user just because the email
+// addresses match. We don't confirm the email addresses that people sign up
+// with, so anybody could have created that account, and linking it would hand
+// it to whoever controls the identity (or the identity to whoever created the
+// account). Instead it returns ErrLinkRequired, and the owner of the account
+// has to log in and link the identity with LinkExternal().
+//
+// Like Authenticate(), it returns ErrInvalidCredentials if the user has been
+// disabled.
+func (m *UserModel) AuthenticateExternal(ctx context.Context, issuer, subject, name, email string) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// If we have seen this identity before, we're done.
+	var id int
+	var disabled bool
+
+	stmt := `SELECT users.id, users.disabled FROM user_identities
+	INNER JOIN users ON users.id = user_identities.user_id
+	WHERE user_identities.issuer = ? AND user_identities.subject = ?`
+
+	err = tx.QueryRowContext(ctx, stmt, issuer, subject).Scan(&id, &disabled)
+	if err == nil {
+		if disabled {
+			return 0, ErrInvalidCredentials
+		}
+		return id, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	// Otherwise check for an existing user with the same email address, and
+	// create one if there isn't one.
+	err = tx.QueryRowContext(ctx, "SELECT id, disabled FROM users WHERE email = ? FOR UPDATE", email).Scan(&id, &disabled)
+	if err == nil && disabled {
+		return 0, ErrInvalidCredentials
+	} else if err == nil {
+		return 0, ErrLinkRequired
+	} else if errors.Is(err, sql.ErrNoRows) {
+		stmt = `INSERT INTO users (name, email, hashed_password, created) VALUES(?, ?, '', UTC_TIMESTAMP())`
+
+		result, err := tx.ExecContext(ctx, stmt, name, email)
+		if err != nil {
+			return 0, err
+		}
+
+		newID, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		id = int(newID)
+	} else if err != nil {
+		return 0, err
+	}
+
+	stmt = `INSERT INTO user_identities (user_id, issuer, subject, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err = tx.ExecContext(ctx, stmt, id, issuer, subject)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// The LinkExternal method links an identity asserted by an external identity
+// provider to an existing user, so that they can log in with it from then on.
+// It should only be called for the logged-in user, who has shown that they
+// control both the account and the identity. Linking an identity to the user
+// it's already linked to does nothing, but if it's linked to somebody else we
+// return ErrDuplicateIdentity.
+func (m *UserModel) LinkExternal(ctx context.Context, userID int, issuer, subject string) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var linkedID int
+
+	stmt := "SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ? FOR UPDATE"
+
+	err = tx.QueryRowContext(ctx, stmt, issuer, subject).Scan(&linkedID)
+	if err == nil {
+		if linkedID != userID {
+			return ErrDuplicateIdentity
+		}
+		return nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	stmt = `INSERT INTO user_identities (user_id, issuer, subject, created) VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err = tx.ExecContext(ctx, stmt, userID, issuer, subject)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// The Get method returns the details of a specific user.
+func (m *UserModel) Get(ctx context.Context, id int) (User, error) {
+	var u User
+
+	stmt := "SELECT id, name, email, created, role, disabled, language, timezone FROM users WHERE id = ?"
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Role, &u.Disabled, &u.Language, &u.Timezone)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return User{}, ErrNoRecord
+		} else {
+			return User{}, err
+		}
+	}
+
+	return u, nil
+}
+
+// The Search method returns up to 100 users whose name or email address
+// contains the query string. An empty query matches every user.
+func (m *UserModel) Search(ctx context.Context, query string) ([]User, error) {
+	// Escape the LIKE wildcards in the query so that they match literally.
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+
+	stmt := `SELECT id, name, email, created, role, disabled FROM users
+	WHERE name LIKE ? OR email LIKE ? ORDER BY id LIMIT 100`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, pattern, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+
+	for rows.Next() {
+		var u User
+
+		err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.Created, &u.Role, &u.Disabled)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// The SetRole method changes the role of a user. If audit isn't nil, it's
+// added to the audit trail in the same transaction. If the user doesn't
+// exist we return ErrNoRecord.
+func (m *UserModel) SetRole(ctx context.Context, id int, role string, audit *AuditEntry) error {
+	return m.update(ctx, id, audit, "UPDATE users SET role = ? WHERE id = ?", role, id)
+}
+
+// The SetDisabled method disables or re-enables a user. If audit isn't nil,
+// it's added to the audit trail in the same transaction. If the user doesn't
+// exist we return ErrNoRecord.
+func (m *UserModel) SetDisabled(ctx context.Context, id int, disabled bool, audit *AuditEntry) error {
+	return m.update(ctx, id, audit, "UPDATE users SET disabled = ? WHERE id = ?", disabled, id)
+}
+
+// The SetLanguage method records the locale that a user wants the site shown
+// in, like "fr", or "" to go by their browser's settings. If the user doesn't
+// exist we return ErrNoRecord.
+func (m *UserModel) SetLanguage(ctx context.Context, id int, language string) error {
+	return m.update(ctx, id, nil, "UPDATE users SET language = ? WHERE id = ?", language, id)
+}
+
+// The SetTimezone method records the IANA timezone that a user wants times
+// shown in, like "Europe/London". If the user doesn't exist we return
+// ErrNoRecord.
+func (m *UserModel) SetTimezone(ctx context.Context, id int, timezone string) error {
+	return m.update(ctx, id, nil, "UPDATE users SET timezone = ? WHERE id = ?", timezone, id)
+}
+
+// update executes an UPDATE statement on the user with the given ID, which is
+// expected to exist, and records the audit entry if there is one. Both happen
+// in one transaction, so that a change is never saved without its audit
+// entry.
+func (m *UserModel) update(ctx context.Context, id int, audit *AuditEntry, stmt string, args ...any) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	// Note that MySQL reports rows changed rather than rows matched, so
+	// setting a value to what it already is reports 0 rows. We check that
+	// the user exists to tell the two cases apart.
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		var exists bool
+
+		err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT true FROM users WHERE id = ?)", id).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNoRecord
+		}
+	}
+
+	err = insertAuditEntry(ctx, tx, audit)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
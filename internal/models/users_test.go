@@ -1,6 +1,8 @@
 package models
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"snippetbox.example.com/internal/assert"
@@ -42,10 +44,126 @@ func TestUserModelExists(t *testing.T) {
 
 			// Call the UserModel.Exists() method and check that the return
 			// value and error match the expected values for the sub-test.
-			exists, err := m.Exists(tt.userID)
+			exists, err := m.Exists(context.Background(), tt.userID)
 
 			assert.Equal(t, exists, tt.want)
 			assert.NilError(t, err)
 		})
 	}
 }
+
+func TestUserModelAuthenticateExternal(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	// An identity with the same email address as an existing user isn't
+	// linked to that user until they link it themselves.
+	_, err := m.AuthenticateExternal(context.Background(), "https://idp.example.com", "alice-sub", "Alice", "alice@example.com")
+	assert.Equal(t, err, ErrLinkRequired)
+
+	err = m.LinkExternal(context.Background(), 1, "https://idp.example.com", "alice-sub")
+	assert.NilError(t, err)
+
+	id, err := m.AuthenticateExternal(context.Background(), "https://idp.example.com", "alice-sub", "Alice", "alice@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 1)
+
+	// Linking it again does nothing, but it can't be linked to anybody else.
+	err = m.LinkExternal(context.Background(), 1, "https://idp.example.com", "alice-sub")
+	assert.NilError(t, err)
+
+	err = m.LinkExternal(context.Background(), 2, "https://idp.example.com", "alice-sub")
+	assert.Equal(t, err, ErrDuplicateIdentity)
+
+	// An identity with a new email address should get a new user, which can't
+	// log in with a password.
+	id, err = m.AuthenticateExternal(context.Background(), "https://idp.example.com", "bob-sub", "Bob", "bob@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 2)
+
+	_, err = m.Authenticate(context.Background(), "bob@example.com", "")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	// Once linked, the identity is found by its subject even if the email
+	// address changes.
+	id, err = m.AuthenticateExternal(context.Background(), "https://idp.example.com", "bob-sub", "Bob", "robert@example.com")
+	assert.NilError(t, err)
+	assert.Equal(t, id, 2)
+
+	// Disabled users can't log in, whether or not the identity is already
+	// linked to them.
+	err = m.SetDisabled(context.Background(), 1, true, nil)
+	assert.NilError(t, err)
+
+	_, err = m.AuthenticateExternal(context.Background(), "https://idp.example.com", "alice-sub", "Alice", "alice@example.com")
+	assert.Equal(t, err, ErrInvalidCredentials)
+
+	_, err = m.AuthenticateExternal(context.Background(), "https://idp.example.com", "alice-other-sub", "Alice", "alice@example.com")
+	assert.Equal(t, err, ErrInvalidCredentials)
+}
+
+func TestUserModelSetLanguage(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	user, err := m.Get(context.Background(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Language, "")
+
+	err = m.SetLanguage(context.Background(), 1, "fr")
+	assert.NilError(t, err)
+
+	user, err = m.Get(context.Background(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Language, "fr")
+
+	err = m.SetLanguage(context.Background(), 99, "fr")
+	assert.Equal(t, err, ErrNoRecord)
+}
+
+func TestUserModelSetTimezone(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+
+	err := m.SetTimezone(context.Background(), 1, "America/New_York")
+	assert.NilError(t, err)
+
+	user, err := m.Get(context.Background(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Timezone, "America/New_York")
+
+	err = m.SetTimezone(context.Background(), 99, "America/New_York")
+	assert.Equal(t, err, ErrNoRecord)
+}
+
+func TestUserModelSetRole(t *testing.T) {
+	db := newTestDB(t)
+	m := UserModel{db}
+	audit := AuditModel{db}
+
+	err := m.SetRole(context.Background(), 1, RoleModerator, &AuditEntry{ActorID: 1, Action: "user.role", Target: "user:1", Detail: RoleModerator})
+	assert.NilError(t, err)
+
+	user, err := m.Get(context.Background(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Role, RoleModerator)
+
+	entries, err := audit.Latest(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Action, "user.role")
+
+	// If the audit entry can't be written (here because the action is too
+	// long for its column) the role change is rolled back too.
+	err = m.SetRole(context.Background(), 1, RoleAdmin, &AuditEntry{ActorID: 1, Action: strings.Repeat("x", 51), Target: "user:1"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	user, err = m.Get(context.Background(), 1)
+	assert.NilError(t, err)
+	assert.Equal(t, user.Role, RoleModerator)
+
+	err = m.SetRole(context.Background(), 99, RoleAdmin, nil)
+	assert.Equal(t, err, ErrNoRecord)
+}
@@ -0,0 +1,229 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// verifySignature checks the signature on a compact-serialised JWT and
+// returns its decoded payload.
+func (p *Provider) verifySignature(ctx context.Context, rawToken string) ([]byte, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+
+	key, err := p.keys.get(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only accept the algorithms that we explicitly support, and make sure
+	// that the algorithm matches the type of key. This stops "alg": "none"
+	// and algorithm confusion attacks.
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch header.Alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: key type does not match algorithm", ErrInvalidToken)
+		}
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return nil, fmt.Errorf("%w: key type does not match algorithm", ErrInvalidToken)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, hash[:], r, s) {
+			return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	return payload, nil
+}
+
+// get returns the key with the given ID, fetching the JWKS from the
+// provider if we don't already have it and haven't fetched it recently.
+func (ks *keySet) get(ctx context.Context, kid string) (any, error) {
+	key, ok, stale := ks.lookup(kid)
+	if ok {
+		return key, nil
+	}
+
+	if stale {
+		// Callers which miss at the same time share one fetch. It isn't
+		// cancelled when the first caller goes away, since the others may be
+		// waiting for it.
+		_, err, _ := ks.group.Do("jwks", func() (any, error) {
+			return nil, ks.refresh(context.WithoutCancel(ctx))
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok, _ = ks.lookup(kid)
+		if ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, kid)
+}
+
+// lookup returns the key with the given ID if we have it, and whether the
+// keys are old enough to be fetched again.
+func (ks *keySet) lookup(kid string) (key any, ok bool, stale bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok = ks.keys[kid]
+	return key, ok, time.Since(ks.fetched) >= minRefreshInterval
+}
+
+// refresh fetches the JWKS and replaces the keys we have, unless another
+// caller has done so within the last minRefreshInterval. Failed fetches count
+// too, so that a provider which is down isn't asked again on every login.
+func (ks *keySet) refresh(ctx context.Context) error {
+	ks.mu.Lock()
+	if time.Since(ks.fetched) < minRefreshInterval {
+		ks.mu.Unlock()
+		return nil
+	}
+	ks.fetched = time.Now()
+	ks.mu.Unlock()
+
+	keys, err := ks.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// The jsonWebKey struct holds the fields of a JWK that we support.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (ks *keySet) fetch(ctx context.Context) (map[string]any, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err := getJSON(ctx, ks.client, ks.url, &jwks)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetching jwks: %w", err)
+	}
+
+	keys := make(map[string]any)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys that we don't understand rather than failing, as
+			// providers may publish keys of types we don't support.
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("rsa key too small")
+		}
+		return pub, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		// Converting the key to crypto/ecdh checks that the point is
+		// actually on the curve.
+		if _, err := pub.ECDH(); err != nil {
+			return nil, err
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
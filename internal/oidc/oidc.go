@@ -0,0 +1,313 @@
+// Package oidc implements the parts of OpenID Connect that we need to log
+// users in with an external identity provider: discovery, the authorization
+// code flow with PKCE, and verification of RS256- or ES256-signed ID tokens
+// against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Errors returned when an ID token fails verification.
+var (
+	ErrInvalidToken  = errors.New("oidc: invalid id token")
+	ErrNonceMismatch = errors.New("oidc: nonce mismatch")
+)
+
+// Config holds the settings needed to talk to an identity provider.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+
+	// HTTPClient is used for all requests to the provider. If it is nil then
+	// a client with a 10 second timeout is used.
+	HTTPClient *http.Client
+}
+
+// Claims holds the ID token claims that we care about.
+type Claims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// The providerMetadata struct holds the fields that we use from the
+// provider's discovery document.
+type providerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is a configured OpenID Connect identity provider. It is safe for
+// concurrent use.
+type Provider struct {
+	config   Config
+	client   *http.Client
+	metadata providerMetadata
+	keys     *keySet
+
+	// now returns the current time, and can be replaced in tests.
+	now func() time.Time
+}
+
+// NewProvider fetches the discovery document for the issuer in cfg and
+// returns a Provider which uses the endpoints it describes.
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	discoveryURL := strings.TrimSuffix(cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+
+	var metadata providerMetadata
+	err := getJSON(ctx, client, discoveryURL, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetching discovery document: %w", err)
+	}
+
+	// The spec requires the issuer in the discovery document to exactly match
+	// the URL that we used to find it.
+	if metadata.Issuer != cfg.IssuerURL {
+		return nil, fmt.Errorf("oidc: issuer %q does not match configured issuer %q", metadata.Issuer, cfg.IssuerURL)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing required endpoints")
+	}
+
+	p := &Provider{
+		config:   cfg,
+		client:   client,
+		metadata: metadata,
+		keys:     &keySet{client: client, url: metadata.JWKSURI},
+		now:      time.Now,
+	}
+	return p, nil
+}
+
+// RandomString returns a URL-safe random string, suitable for use as a state,
+// nonce or PKCE code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL to send the user to in order to log in. The
+// PKCE code challenge is derived from codeVerifier using the S256 method.
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	challenge := sha256.Sum256([]byte(codeVerifier))
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", "openid email profile")
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange swaps an authorization code for tokens at the provider's token
+// endpoint, and returns the raw (unverified) ID token.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	rs, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request: %w", err)
+	}
+	defer rs.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(rs.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("oidc: token request: %w", err)
+	}
+	if rs.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: token request: unexpected status %d: %s", rs.StatusCode, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	err = json.Unmarshal(body, &tokens)
+	if err != nil {
+		return "", fmt.Errorf("oidc: token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("oidc: token response did not contain an id_token")
+	}
+
+	return tokens.IDToken, nil
+}
+
+// The idTokenClaims struct is used to decode the payload of an ID token.
+type idTokenClaims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// The aud claim may be either a single string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	var ss []string
+	err := json.Unmarshal(b, &ss)
+	if err != nil {
+		return err
+	}
+	*a = ss
+	return nil
+}
+
+// Allow a little clock skew between us and the provider.
+const clockSkew = time.Minute
+
+// Verify checks the signature and claims of a raw ID token, including that it
+// was issued in response to the request with the given nonce, and returns
+// the claims.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	payload, err := p.verifySignature(ctx, rawIDToken)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	var c idTokenClaims
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed claims: %v", ErrInvalidToken, err)
+	}
+
+	if c.Issuer != p.metadata.Issuer {
+		return Claims{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.Issuer)
+	}
+	if c.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	if !slices.Contains(c.Audience, p.config.ClientID) {
+		return Claims{}, fmt.Errorf("%w: token was not issued for this client", ErrInvalidToken)
+	}
+	if len(c.Audience) > 1 && c.AuthorizedBy != p.config.ClientID {
+		return Claims{}, fmt.Errorf("%w: unexpected authorized party %q", ErrInvalidToken, c.AuthorizedBy)
+	}
+
+	now := p.now()
+	if now.After(time.Unix(c.Expiry, 0).Add(clockSkew)) {
+		return Claims{}, fmt.Errorf("%w: token has expired", ErrInvalidToken)
+	}
+	if time.Unix(c.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return Claims{}, fmt.Errorf("%w: token was issued in the future", ErrInvalidToken)
+	}
+
+	if c.Nonce != nonce {
+		return Claims{}, ErrNonceMismatch
+	}
+
+	claims := Claims{
+		Issuer:        c.Issuer,
+		Subject:       c.Subject,
+		Email:         c.Email,
+		EmailVerified: c.EmailVerified,
+		Name:          c.Name,
+	}
+	return claims, nil
+}
+
+// getJSON makes a GET request and decodes a JSON response body into dst.
+func getJSON(ctx context.Context, client *http.Client, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	rs, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", rs.StatusCode, url)
+	}
+
+	return json.NewDecoder(io.LimitReader(rs.Body, 1<<20)).Decode(dst)
+}
+
+// The keySet type caches the provider's signing keys. The keys are refetched
+// when we see a token signed with a key ID that we don't recognise, which
+// is how providers handle key rotation.
+//
+// Anybody can send us a token with a made-up key ID, so the keys are
+// refetched at most once every minRefreshInterval, and concurrent refetches
+// are collapsed into one. The fetch happens without holding mu, so that
+// tokens signed with keys we already have can still be checked meanwhile.
+type keySet struct {
+	client *http.Client
+	url    string
+
+	mu      sync.Mutex
+	keys    map[string]any
+	fetched time.Time
+
+	group singleflight.Group
+}
+
+// minRefreshInterval is the shortest time between fetches of the JWKS.
+const minRefreshInterval = time.Minute
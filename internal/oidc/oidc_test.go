@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"snippetbox.example.com/internal/assert"
+	"snippetbox.example.com/internal/oidc/oidctest"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	srv := oidctest.NewServer("snippetbox", "s3cret")
+	t.Cleanup(srv.Close)
+
+	p, err := NewProvider(context.Background(), Config{
+		IssuerURL:    srv.URL,
+		ClientID:     "snippetbox",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://snippetbox.example.com/user/login/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, srv
+}
+
+func TestNewProviderIssuerMismatch(t *testing.T) {
+	srv := oidctest.NewServer("snippetbox", "s3cret")
+	defer srv.Close()
+
+	_, err := NewProvider(context.Background(), Config{IssuerURL: srv.URL + "/"})
+	if err == nil {
+		t.Fatal("expected an error for a mismatched issuer")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p, srv := newTestProvider(t)
+
+	validClaims := func() map[string]any {
+		now := time.Now()
+		return map[string]any{
+			"iss":            srv.URL,
+			"sub":            "1234",
+			"aud":            "snippetbox",
+			"exp":            now.Add(time.Minute).Unix(),
+			"iat":            now.Unix(),
+			"nonce":          "n-0S6_WzA2Mj",
+			"email":          "alice@example.com",
+			"email_verified": true,
+		}
+	}
+
+	sign := func(modify func(map[string]any)) string {
+		claims := validClaims()
+		if modify != nil {
+			modify(claims)
+		}
+		token, err := srv.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{
+			name:  "Valid",
+			token: sign(nil),
+		},
+		{
+			name:  "Audience array",
+			token: sign(func(c map[string]any) { c["aud"] = []string{"snippetbox", "other"}; c["azp"] = "snippetbox" }),
+		},
+		{
+			name:    "Audience array without azp",
+			token:   sign(func(c map[string]any) { c["aud"] = []string{"snippetbox", "other"} }),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Wrong audience",
+			token:   sign(func(c map[string]any) { c["aud"] = "someone-else" }),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Wrong issuer",
+			token:   sign(func(c map[string]any) { c["iss"] = "https://evil.example.com" }),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Expired",
+			token:   sign(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Issued in the future",
+			token:   sign(func(c map[string]any) { c["iat"] = time.Now().Add(time.Hour).Unix() }),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Wrong nonce",
+			token:   sign(func(c map[string]any) { c["nonce"] = "replayed" }),
+			wantErr: ErrNonceMismatch,
+		},
+		{
+			name: "Tampered payload",
+			token: func() string {
+				parts := strings.Split(sign(nil), ".")
+				other := strings.Split(sign(func(c map[string]any) { c["email"] = "mallory@example.com" }), ".")
+				return parts[0] + "." + other[1] + "." + parts[2]
+			}(),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "Algorithm none",
+			token: func() string {
+				parts := strings.Split(sign(nil), ".")
+				header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"oidctest"}`))
+				return header + "." + parts[1] + "."
+			}(),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "Malformed",
+			token:   "not-a-jwt",
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := p.Verify(context.Background(), tt.token, "n-0S6_WzA2Mj")
+
+			if tt.wantErr != nil {
+				assert.Equal(t, errors.Is(err, tt.wantErr), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, claims.Subject, "1234")
+			assert.Equal(t, claims.Email, "alice@example.com")
+			assert.Equal(t, claims.EmailVerified, true)
+		})
+	}
+}
+
+// Tokens with key IDs that we don't know about must not make us fetch the
+// JWKS on every request.
+func TestKeySetRefreshLimit(t *testing.T) {
+	p, srv := newTestProvider(t)
+
+	token, err := srv.Sign(map[string]any{
+		"iss":   srv.URL,
+		"sub":   "1234",
+		"aud":   "snippetbox",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": "n",
+	})
+	assert.NilError(t, err)
+
+	// A token with a made-up key ID, which can't be verified whatever the
+	// signature is.
+	parts := strings.Split(token, ".")
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"made-up"}`))
+	unknownKey := header + "." + parts[1] + "." + parts[2]
+
+	// The first token fetches the keys.
+	_, err = p.Verify(context.Background(), token, "n")
+	assert.NilError(t, err)
+	assert.Equal(t, srv.JWKSRequests(), 1)
+
+	// Unknown key IDs are rejected without fetching the keys again, and
+	// valid tokens still work.
+	for range 10 {
+		_, err = p.Verify(context.Background(), unknownKey, "n")
+		assert.Equal(t, errors.Is(err, ErrInvalidToken), true)
+	}
+	_, err = p.Verify(context.Background(), token, "n")
+	assert.NilError(t, err)
+	assert.Equal(t, srv.JWKSRequests(), 1)
+
+	// Once the keys are old enough they are fetched again, but only once.
+	p.keys.mu.Lock()
+	p.keys.fetched = time.Now().Add(-minRefreshInterval)
+	p.keys.mu.Unlock()
+
+	for range 10 {
+		_, err = p.Verify(context.Background(), unknownKey, "n")
+		assert.Equal(t, errors.Is(err, ErrInvalidToken), true)
+	}
+	assert.Equal(t, srv.JWKSRequests(), 2)
+}
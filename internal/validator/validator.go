@@ -15,11 +15,34 @@ import (
 // https://html.spec.whatwg.org/multipage/input.html#valid-e-mail-address
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// The FileNameRX pattern checks that a file name can be used as it is in a URL
+// path and in a zip file: it can't contain slashes, backslashes or control
+// characters, and can't be made up only of dots, like "." and "..".
+var FileNameRX = regexp.MustCompile(`^[^/\\\x00-\x1f\x7f]*[^./\\\x00-\x1f\x7f][^/\\\x00-\x1f\x7f]*$`)
+
+// The TagRX pattern checks that a snippet tag is made up of lowercase letters,
+// digits and dashes, and doesn't start with a dash, like "go" or "deploy-notes".
+var TagRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
 // Define a struct which contains a map of validation error messages
 // for our form fields.
+//
+// The messages are recorded as message catalog keys, like
+// "validation.blank", rather than as finished sentences, so that they can be
+// shown in the user's own language. See the Error type.
 type Validator struct {
-	NonFieldErrors []string
-	FieldErrors    map[string]string
+	NonFieldErrors []Error
+	FieldErrors    map[string]*Error
+}
+
+// An Error is a validation error message, made up of a message catalog key and
+// any arguments which the message needs, like the 100 in "This field cannot
+// be more than 100 characters long". FieldErrors holds pointers so that a
+// missing entry is nil, which {{with .Form.FieldErrors.title}} in a template
+// treats as false.
+type Error struct {
+	Key  string
+	Args []any
 }
 
 // Valid() returns true if the FieldErrors map doesn't contain any entries.
@@ -28,28 +51,28 @@ func (v *Validator) Valid() bool {
 }
 
 // AddNonFieldError() adds an error message to the NonFildeErrors slice.
-func (v *Validator) AddNonFieldError(message string) {
-	v.NonFieldErrors = append(v.NonFieldErrors, message)
+func (v *Validator) AddNonFieldError(message string, args ...any) {
+	v.NonFieldErrors = append(v.NonFieldErrors, Error{Key: message, Args: args})
 }
 
 // AddFieldError() adds an error message to the FieldErrors map (so long
 // as no entry exists for the given key)
-func (v *Validator) AddFieldError(key, message string) {
+func (v *Validator) AddFieldError(key, message string, args ...any) {
 	// Note: we need to initialise the map first if it isnt already initialised
 	if v.FieldErrors == nil {
-		v.FieldErrors = make(map[string]string)
+		v.FieldErrors = make(map[string]*Error)
 	}
 
 	if _, exists := v.FieldErrors[key]; !exists {
-		v.FieldErrors[key] = message
+		v.FieldErrors[key] = &Error{Key: message, Args: args}
 	}
 }
 
 // CheckField() adds an error message to the FieldErrors map only if a
 // validation check is not 'OK'.
-func (v *Validator) CheckField(ok bool, key, message string) {
+func (v *Validator) CheckField(ok bool, key, message string, args ...any) {
 	if !ok {
-		v.AddFieldError(key, message)
+		v.AddFieldError(key, message, args...)
 	}
 }
 
@@ -2,5 +2,15 @@ package ui
 
 import "embed"
 
-//go:embed "static" "html"
+// The static files are served with a precompressed ".gz" copy where it's
+// worthwhile. Run "go generate ./ui" after changing them. The stylesheet for
+// highlighted code is generated too, so it's written first.
+//
+//go:generate go run highlight.go
+//go:generate go run precompress.go
+
+// The message catalogs for each locale are in the locales directory, like
+// "locales/fr.json".
+//
+//go:embed "static" "html" "locales"
 var Files embed.FS
@@ -0,0 +1,30 @@
+//go:build ignore
+
+// The highlight program writes static/css/highlight.css, the stylesheet for
+// the highlighted code blocks in Markdown snippets. It's run by
+// "go generate ./ui", and the output is committed like the other static
+// files. Run it again if markdown.Style is changed.
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+
+	"snippetbox.example.com/internal/markdown"
+)
+
+func main() {
+	var buf bytes.Buffer
+	buf.WriteString("/* Generated by highlight.go. DO NOT EDIT. */\n")
+
+	err := markdown.WriteCSS(&buf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = os.WriteFile("static/css/highlight.css", buf.Bytes(), 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+//go:build ignore
+
+// The precompress program writes a gzipped copy of each compressible file in
+// the static directory, next to the original with a ".gz" extension, so that
+// the server can send it without compressing it on every request. It's run
+// by "go generate ./ui" whenever the static files change, and the output is
+// committed, because it has to be present when ui.Files is embedded.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Only text-based formats are worth compressing. Images like PNGs are
+// compressed already.
+var extensions = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".svg":  true,
+	".ico":  true,
+	".txt":  true,
+	".json": true,
+}
+
+func main() {
+	err := filepath.WalkDir("static", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		// Remove any compressed copy whose original has gone.
+		if strings.HasSuffix(path, ".gz") {
+			if _, err := os.Stat(strings.TrimSuffix(path, ".gz")); os.IsNotExist(err) {
+				log.Printf("removing %s", path)
+				return os.Remove(path)
+			}
+			return nil
+		}
+
+		if !extensions[filepath.Ext(path)] {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		// The gzip header is left without a name or modification time, so
+		// that running the program again produces exactly the same output.
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		_, err = zw.Write(data)
+		if err != nil {
+			return err
+		}
+		err = zw.Close()
+		if err != nil {
+			return err
+		}
+
+		// Don't bother keeping a compressed copy which saves less than 10%.
+		if buf.Len() > len(data)*9/10 {
+			os.Remove(path + ".gz")
+			return nil
+		}
+
+		log.Printf("writing %s.gz (%d -> %d bytes)", path, len(data), buf.Len())
+		return os.WriteFile(path+".gz", buf.Bytes(), 0644)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
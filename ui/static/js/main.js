@@ -5,4 +5,36 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+// If the server doesn't know which timezone we're in yet, tell it, so that
+// times are shown in local time from the next page onwards.
+if (document.body.hasAttribute("data-detect-timezone") && window.fetch && window.Intl) {
+	var timezone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+	var csrfToken = document.querySelector("input[name='csrf_token']");
+	if (timezone && csrfToken) {
+		fetch("/timezone", {
+			method: "POST",
+			credentials: "same-origin",
+			body: new URLSearchParams({timezone: timezone, csrf_token: csrfToken.value})
+		});
+	}
+}
+// Add and remove files on the create snippet page without sending the form
+// to the server. The new file's fields are copied from the <template>, and
+// numbered after the ones that are already there.
+var addFile = document.querySelector("button[name='add_file']");
+var fileTemplate = document.getElementById("file-template");
+if (addFile && fileTemplate) {
+	var nextFile = parseInt(addFile.getAttribute("data-next-file"), 10);
+	addFile.addEventListener("click", function(e) {
+		e.preventDefault();
+		addFile.insertAdjacentHTML("beforebegin", fileTemplate.innerHTML.replace(/INDEX/g, nextFile));
+		nextFile++;
+	});
+	addFile.form.addEventListener("click", function(e) {
+		if (e.target.name == "remove_file") {
+			e.preventDefault();
+			e.target.closest(".file").remove();
+		}
+	});
+}